@@ -0,0 +1,17 @@
+package api
+
+import _ "embed"
+
+// The sources of the events registered in the schema registry for topics that publish
+// protobuf-encoded events. Every file declares a single message, so that the subject of a topic
+// knows only the event published to it.
+var (
+	//go:embed events/add_new_unread_message.proto
+	AddNewUnreadMessageProto string
+
+	//go:embed events/adjust_unread_counter.proto
+	AdjustUnreadCounterProto string
+
+	//go:embed events/remove_unread_message.proto
+	RemoveUnreadMessageProto string
+)
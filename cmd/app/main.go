@@ -1,7 +1,26 @@
 package main
 
-import "github.com/orochi-keydream/dialogue-service/internal/app"
+import (
+	"log/slog"
+	"os"
+
+	"github.com/orochi-keydream/dialogue-service/internal/app"
+)
 
 func main() {
-	app.Run()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		}
+	}
+
+	err := app.Run()
+
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/app"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/migrator"
+)
+
+const migrateUsage = "usage: migrate up|down|status --config <path> [--skip-citus]"
+
+// runMigrate applies or rolls back the embedded migrations or prints their status.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+
+	var (
+		configPath = fs.String("config", "", "Specifies the path to the config file.")
+		skipCitus  = fs.Bool("skip-citus", false, "Skip the migrations distributing tables with Citus.")
+	)
+
+	_ = fs.Parse(args)
+
+	// The command may come before or after the flags.
+	command := fs.Arg(0)
+
+	if fs.NArg() > 0 {
+		_ = fs.Parse(fs.Args()[1:])
+	}
+
+	if command == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	cfg := config.LoadConfigFromFile(*configPath)
+
+	if cfg.Database.InMemory {
+		fmt.Fprintln(os.Stderr, "the database is configured to be kept in memory, there is nothing to migrate")
+		return 2
+	}
+
+	migrationsConfig := cfg.Database.Migrations
+	migrationsConfig.SkipCitus = migrationsConfig.SkipCitus || *skipCitus
+
+	conn, err := app.NewConn(cfg.Database)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	defer conn.Close()
+
+	m, err := migrator.New(conn, migrationsConfig)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	switch command {
+	case "up":
+		results, err := m.Up(ctx)
+
+		for _, result := range results {
+			fmt.Printf("OK   %v (%v)\n", result.Source.Path, result.Duration.Round(time.Millisecond))
+		}
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if len(results) == 0 {
+			fmt.Println("no migrations to apply")
+		}
+	case "down":
+		result, err := m.Down(ctx)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fmt.Printf("OK   %v (%v)\n", result.Source.Path, result.Duration.Round(time.Millisecond))
+	case "status":
+		statuses, err := m.Status(ctx)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		for _, status := range statuses {
+			appliedAt := "Pending"
+
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+
+			fmt.Printf("%-25v %v\n", appliedAt, status.Source.Path)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
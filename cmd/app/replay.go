@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/app"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/replay"
+)
+
+// runReplay republishes failed dialogue commands and prints the result as JSON.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+
+	var (
+		configPath    = fs.String("config", "", "Specifies the path to the config file.")
+		topic         = fs.String("topic", "", "Topic to read failed commands from (the dead-letter topic by default).")
+		partition     = fs.Int("partition", -1, "Partition to read from (all partitions by default).")
+		fromOffset    = fs.Int64("from-offset", -1, "First offset to read.")
+		toOffset      = fs.Int64("to-offset", -1, "Last offset to read.")
+		command       = fs.String("command", "", "Replay only commands of the given type, e.g. CommitMessage.")
+		correlationId = fs.String("correlation-id", "", "Replay only the command with the given correlation ID.")
+		fromTime      = fs.String("from", "", "Replay only records produced at or after the given RFC 3339 time.")
+		toTime        = fs.String("to", "", "Replay only records produced at or before the given RFC 3339 time.")
+		dryRun        = fs.Bool("dry-run", false, "Handle matching commands in a rolled back transaction without republishing them.")
+	)
+
+	_ = fs.Parse(args)
+
+	cfg := config.LoadConfigFromFile(*configPath)
+
+	filter := replay.Filter{
+		Topic:         *topic,
+		Command:       *command,
+		CorrelationId: *correlationId,
+	}
+
+	if *partition >= 0 {
+		p := int32(*partition)
+		filter.Partition = &p
+	}
+
+	if *fromOffset >= 0 {
+		filter.FromOffset = fromOffset
+	}
+
+	if *toOffset >= 0 {
+		filter.ToOffset = toOffset
+	}
+
+	var err error
+
+	if *fromTime != "" {
+		filter.FromTime, err = time.Parse(time.RFC3339, *fromTime)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --from: %v\n", err)
+			return 2
+		}
+	}
+
+	if *toTime != "" {
+		filter.ToTime, err = time.Parse(time.RFC3339, *toTime)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --to: %v\n", err)
+			return 2
+		}
+	}
+
+	// An in-memory broker lives in the process of the service, so the command always talks to the cluster.
+	cfg.Kafka.InMemory = false
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// Dry-runs handle commands the same way the service does, while nothing else of the service is
+	// wired, so that replaying never migrates the database.
+	replayer, err := app.NewReplayer(cfg)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	result, err := replayer.Replay(ctx, filter, *dryRun)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err = encoder.Encode(result); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/replay"
+	"github.com/orochi-keydream/dialogue-service/internal/proto/dialogue"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type DialogueAdminService struct {
+	dialogue.UnimplementedDialogueAdminServiceServer
+
+	replayer *replay.Replayer
+}
+
+func NewDialogueAdminService(replayer *replay.Replayer) *DialogueAdminService {
+	return &DialogueAdminService{
+		replayer: replayer,
+	}
+}
+
+func (s *DialogueAdminService) ReplayDeadLettersV1(
+	ctx context.Context,
+	req *dialogue.ReplayDeadLettersV1Request,
+) (*dialogue.ReplayDeadLettersV1Response, error) {
+	filter := replay.Filter{
+		Topic:         req.Topic,
+		Partition:     req.Partition,
+		FromOffset:    req.FromOffset,
+		ToOffset:      req.ToOffset,
+		Command:       req.Command,
+		CorrelationId: req.CorrelationId,
+	}
+
+	if req.FromTime != nil {
+		filter.FromTime = req.FromTime.AsTime()
+	}
+
+	if req.ToTime != nil {
+		filter.ToTime = req.ToTime.AsTime()
+	}
+
+	result, err := s.replayer.Replay(ctx, filter, req.DryRun)
+
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	records := make([]*dialogue.ReplayDeadLettersV1Response_Record, len(result.Records))
+
+	for i, record := range result.Records {
+		records[i] = &dialogue.ReplayDeadLettersV1Response_Record{
+			Partition:       record.Partition,
+			Offset:          record.Offset,
+			Timestamp:       timestamppb.New(record.Timestamp),
+			Command:         record.Command,
+			CorrelationId:   record.CorrelationId,
+			Error:           record.Error,
+			ValidationError: record.ValidationError,
+			Replayed:        record.Replayed,
+			HandlingError:   record.HandlingError,
+		}
+	}
+
+	resp := &dialogue.ReplayDeadLettersV1Response{
+		Matched:  int32(result.Matched),
+		Replayed: int32(result.Replayed),
+		Records:  records,
+	}
+
+	return resp, nil
+}
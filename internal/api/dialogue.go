@@ -2,6 +2,10 @@ package api
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/orochi-keydream/dialogue-service/internal/model"
 	"github.com/orochi-keydream/dialogue-service/internal/proto/dialogue"
@@ -23,32 +27,47 @@ func NewDialogueService(appService *service.AppService) *DialogueService {
 }
 
 func (s *DialogueService) GetMessagesV1(ctx context.Context, req *dialogue.GetMessagesV1Request) (*dialogue.GetMessagesV1Response, error) {
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+
+	cursor, err := decodePageToken(req.PageToken)
+
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	cmd := model.GetMessagesCommand{
-		FromUserId: model.UserId(req.FromUserId),
-		ToUserId:   model.UserId(req.ToUserId),
+		FromUserId:    model.UserId(req.FromUserId),
+		ToUserId:      model.UserId(req.ToUserId),
+		IncludeFailed: req.IncludeFailed,
+		Limit:         int(req.PageSize),
+		Cursor:        cursor,
 	}
 
-	messages, err := s.appService.GetMessages(ctx, cmd)
+	page, err := s.appService.GetMessages(ctx, cmd)
 
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 
-	items := make([]*dialogue.GetMessagesV1Response_Message, len(messages))
+	items := make([]*dialogue.GetMessagesV1Response_Message, len(page.Messages))
 
-	for i, message := range messages {
+	for i, message := range page.Messages {
 		item := &dialogue.GetMessagesV1Response_Message{
 			MessageId:  int64(message.MessageId),
 			FromUserId: string(message.FromUserId),
 			ToUserId:   string(message.ToUserId),
 			Text:       message.Text,
+			State:      mapMessageState(message.State),
 		}
 
 		items[i] = item
 	}
 
 	resp := &dialogue.GetMessagesV1Response{
-		Messages: items,
+		Messages:      items,
+		NextPageToken: encodePageToken(page.Next),
 	}
 
 	return resp, nil
@@ -69,3 +88,71 @@ func (s *DialogueService) SendMessageV1(ctx context.Context, req *dialogue.SendM
 
 	return &dialogue.SendMessageV1Response{}, nil
 }
+
+func (s *DialogueService) ReadMessagesV1(ctx context.Context, req *dialogue.ReadMessagesV1Request) (*dialogue.ReadMessagesV1Response, error) {
+	cmd := model.ReadMessagesCommand{
+		UserId:            model.UserId(req.UserId),
+		PeerUserId:        model.UserId(req.PeerUserId),
+		LastReadMessageId: model.MessageId(req.LastReadMessageId),
+	}
+
+	err := s.appService.ReadMessages(ctx, cmd)
+
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &dialogue.ReadMessagesV1Response{}, nil
+}
+
+func mapMessageState(state model.MessageState) dialogue.MessageState {
+	switch state {
+	case model.MessageStateSent:
+		return dialogue.MessageState_MESSAGE_STATE_SENT
+	case model.MessageStatePending:
+		return dialogue.MessageState_MESSAGE_STATE_PENDING
+	case model.MessageStateRemoved:
+		return dialogue.MessageState_MESSAGE_STATE_FAILED
+	default:
+		return dialogue.MessageState_MESSAGE_STATE_UNSPECIFIED
+	}
+}
+
+// Page tokens are opaque to clients, they hold the time the last message of the page was sent in
+// microseconds and its ID.
+func encodePageToken(cursor *model.MessageCursor) string {
+	if cursor == nil {
+		return ""
+	}
+
+	token := fmt.Sprintf("%d:%d", cursor.SentAt.UnixMicro(), cursor.MessageId)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+func decodePageToken(token string) (*model.MessageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+		return nil, errors.New("invalid page_token")
+	}
+
+	var sentAt, messageId int64
+
+	_, err = fmt.Sscanf(string(decoded), "%d:%d", &sentAt, &messageId)
+
+	if err != nil {
+		return nil, errors.New("invalid page_token")
+	}
+
+	cursor := &model.MessageCursor{
+		SentAt:    time.UnixMicro(sentAt).UTC(),
+		MessageId: model.MessageId(messageId),
+	}
+
+	return cursor, nil
+}
@@ -3,9 +3,13 @@ package app
 import (
 	"database/sql"
 	"fmt"
+	"github.com/IBM/sarama"
 	"github.com/orochi-keydream/dialogue-service/internal/jobs"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka"
 	"github.com/orochi-keydream/dialogue-service/internal/kafka/consumer"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/memory"
 	"github.com/orochi-keydream/dialogue-service/internal/kafka/producer"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/replay"
 	"golang.org/x/net/context"
 	"log/slog"
 	"net"
@@ -15,11 +19,16 @@ import (
 	"syscall"
 
 	"github.com/orochi-keydream/dialogue-service/internal/api"
+	"github.com/orochi-keydream/dialogue-service/internal/archive"
+	"github.com/orochi-keydream/dialogue-service/internal/blob"
 	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/counter"
 	"github.com/orochi-keydream/dialogue-service/internal/interceptor"
 	"github.com/orochi-keydream/dialogue-service/internal/log"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/outbox"
 	"github.com/orochi-keydream/dialogue-service/internal/proto/dialogue"
-	"github.com/orochi-keydream/dialogue-service/internal/repository"
+	"github.com/orochi-keydream/dialogue-service/internal/schemaregistry"
 	"github.com/orochi-keydream/dialogue-service/internal/service"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
@@ -27,65 +36,339 @@ import (
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
-func Run() {
-	ctx, cancel := context.WithCancel(context.Background())
+// inMemoryPartitions is the number of partitions of every topic of the in-memory broker.
+const inMemoryPartitions = 3
 
-	cfg := config.LoadConfig()
+// App holds the wired components of the service. Run serves it on the ports from the config,
+// while tests can start it and serve the gRPC server on a listener of their own.
+type App struct {
+	cfg                     config.Config
+	repositories            *repositories
+	broker                  kafka.IBroker
+	appService              *service.AppService
+	outboxService           *service.OutboxService
+	sagaReaper              *service.SagaReaper
+	reconciler              *service.Reconciler
+	partitionManager        *service.PartitionManager
+	archiver                *service.Archiver
+	replicaMonitor          *service.ReplicaMonitor
+	dialogueCommandConsumer *consumer.DialogueCommandConsumer
+	replayer                *replay.Replayer
+}
 
-	addLogger()
+func New(ctx context.Context, cfg config.Config) (*App, error) {
+	if cfg.Database.Migrations.OnStartup && !cfg.Database.InMemory {
+		err := applyMigrations(ctx, cfg.Database)
 
-	conn := NewConn(cfg.Database)
-	dialogueRepository := repository.NewDialogueRepository(conn)
-	outboxRepository := repository.NewOutboxRepository(conn)
-	commandRepository := repository.NewCommandRepository(conn)
-	transactionManager := repository.NewTransactionManager(conn)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	counterCommandProducer, err := producer.NewCounterCommandProducer(cfg.Kafka)
+	repos, err := newRepositories(cfg.Database, cfg.Replica)
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	appService := service.NewAppService(dialogueRepository, outboxRepository, commandRepository, transactionManager)
-	outboxService := service.NewOutboxService(outboxRepository, counterCommandProducer, transactionManager)
+	outboxRouter, err := producer.NewRouter(cfg.Kafka.Producers)
 
-	wg := &sync.WaitGroup{}
+	if err != nil {
+		return nil, err
+	}
+
+	schemaRegistry := newSchemaRegistry(cfg.Kafka.SchemaRegistry)
+	outboxRegistry := outbox.NewRegistry(cfg.Service.Name, outboxRouter, schemaRegistry)
+	err = outbox.RegisterEvents(ctx, outboxRegistry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	broker := newBroker(cfg.Kafka)
+	syncProducer, err := broker.NewSyncProducer()
+
+	if err != nil {
+		return nil, err
+	}
+
+	outboxProducer := producer.NewOutboxProducer(syncProducer, outboxRouter)
+
+	var messageArchive service.IMessageArchive
+
+	if cfg.Archive.Dir != "" {
+		messageArchive = archive.NewArchive(blob.NewLocalStore(cfg.Archive.Dir), repos.archiveIndex)
+	}
+
+	appService := service.NewAppService(
+		repos.dialogue,
+		repos.outbox,
+		repos.command,
+		repos.unread,
+		messageArchive,
+		repos.transactionManager,
+		outboxRegistry)
+	outboxService := service.NewOutboxService(repos.outbox, outboxProducer, repos.transactionManager)
+
+	dialogueCommandsConfig := cfg.Kafka.Consumers.DialogueCommands
+	deadLetterProducer := producer.NewDeadLetterProducer(syncProducer, dialogueCommandsConfig.DeadLetterTopic, dialogueCommandsConfig.GroupId)
+
+	dialogueCommandConsumer := consumer.NewDialogueCommandConsumer(
+		appService,
+		deadLetterProducer,
+		dialogueCommandsConfig)
+
+	sagaReaper, err := service.NewSagaReaper(
+		appService,
+		repos.dialogue,
+		repos.outbox,
+		repos.transactionManager,
+		outboxRegistry,
+		cfg.Saga)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var reconciler *service.Reconciler
+
+	counterClient := newCounterClient(cfg.Counter, cfg.Kafka.InMemory)
+
+	if cfg.Reconciliation.Enabled && counterClient != nil {
+		reconciler = service.NewReconciler(
+			repos.unread,
+			repos.outbox,
+			repos.command,
+			repos.transactionManager,
+			outboxRegistry,
+			counterClient,
+			cfg.Reconciliation)
+	}
+
+	var archiver *service.Archiver
 
-	dialogueCommandConsumer := consumer.NewDialogueCommandConsumer(appService)
+	if messageArchive != nil {
+		archiver = service.NewArchiver(repos.dialogue, messageArchive, repos.leaderLock, cfg.Archive)
+	}
+
+	var partitionManager *service.PartitionManager
+
+	if repos.partitions != nil {
+		partitionManager = service.NewPartitionManager(repos.partitions, cfg.Partitioning)
+	}
+
+	var replicaMonitor *service.ReplicaMonitor
 
-	wg.Add(1)
-	err = consumer.RunDialogueCommandConsumer(ctx, cfg.Kafka, dialogueCommandConsumer, wg)
+	if repos.replica != nil {
+		replicaMonitor = service.NewReplicaMonitor(repos.replica, cfg.Replica)
+	}
+
+	replayer := newReplayer(broker, syncProducer, dialogueCommandConsumer, dialogueCommandsConfig)
+
+	a := &App{
+		cfg:                     cfg,
+		repositories:            repos,
+		broker:                  broker,
+		appService:              appService,
+		outboxService:           outboxService,
+		sagaReaper:              sagaReaper,
+		reconciler:              reconciler,
+		partitionManager:        partitionManager,
+		archiver:                archiver,
+		replicaMonitor:          replicaMonitor,
+		dialogueCommandConsumer: dialogueCommandConsumer,
+		replayer:                replayer,
+	}
+
+	return a, nil
+}
+
+// Start runs the consumer and the jobs in background until ctx is cancelled. wg is done once the
+// consumer is stopped.
+func (a *App) Start(ctx context.Context, wg *sync.WaitGroup) error {
+	err := consumer.RunDialogueCommandConsumer(
+		ctx,
+		a.broker,
+		a.cfg.Kafka.Consumers.DialogueCommands,
+		a.dialogueCommandConsumer,
+		wg)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	outboxJob := jobs.NewOutboxJob(outboxService)
+	outboxJob := jobs.NewOutboxJob(a.outboxService, a.cfg.Outbox.Interval)
 	outboxJob.Start(ctx)
 
-	grpcDialogueService := api.NewDialogueService(appService)
+	sagaReaperJob := jobs.NewSagaReaperJob(a.sagaReaper, a.cfg.Saga.Interval)
+	sagaReaperJob.Start(ctx)
 
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Service.GrpcPort))
+	if a.reconciler != nil {
+		reconciliationJob := jobs.NewReconciliationJob(a.reconciler, a.cfg.Reconciliation.Interval)
+		reconciliationJob.Start(ctx)
+	} else {
+		slog.Info("Reconciliation of unread counters is disabled or the counter service is not configured")
+	}
+
+	if a.partitionManager != nil {
+		partitionMaintenanceJob := jobs.NewPartitionMaintenanceJob(a.partitionManager, a.cfg.Partitioning.Interval)
+		partitionMaintenanceJob.Start(ctx)
+	}
+
+	if a.archiver != nil {
+		archiveJob := jobs.NewArchiveJob(a.archiver, a.cfg.Archive.Interval)
+		archiveJob.Start(ctx)
+	} else {
+		slog.Info("Archive not configured, archival of messages is disabled")
+	}
+
+	if a.replicaMonitor != nil {
+		replicaMonitorJob := jobs.NewReplicaMonitorJob(a.replicaMonitor, a.cfg.Replica.Interval)
+		replicaMonitorJob.Start(ctx)
+	} else {
+		slog.Info("Replica not configured, the history of chats is read from the primary")
+	}
+
+	return nil
+}
+
+// NewReplayer wires only what replaying failed dialogue commands needs: the broker, the repositories
+// and the handler of dialogue commands. Unlike New, it never applies migrations, registers no schemas
+// and starts nothing, the history of chats is not read from the replica and no outbox messages can be
+// added.
+func NewReplayer(cfg config.Config) (*replay.Replayer, error) {
+	repos, err := newRepositories(cfg.Database, config.ReplicaConfig{})
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	server := grpc.NewServer(
+	broker := newBroker(cfg.Kafka)
+	syncProducer, err := broker.NewSyncProducer()
+
+	if err != nil {
+		return nil, err
+	}
+
+	appService := service.NewAppService(
+		repos.dialogue,
+		repos.outbox,
+		repos.command,
+		repos.unread,
+		nil,
+		repos.transactionManager,
+		nil)
+
+	dialogueCommandsConfig := cfg.Kafka.Consumers.DialogueCommands
+	deadLetterProducer := producer.NewDeadLetterProducer(syncProducer, dialogueCommandsConfig.DeadLetterTopic, dialogueCommandsConfig.GroupId)
+
+	dialogueCommandConsumer := consumer.NewDialogueCommandConsumer(
+		appService,
+		deadLetterProducer,
+		dialogueCommandsConfig)
+
+	return newReplayer(broker, syncProducer, dialogueCommandConsumer, dialogueCommandsConfig), nil
+}
+
+func newReplayer(
+	broker kafka.IBroker,
+	syncProducer sarama.SyncProducer,
+	dialogueCommandConsumer *consumer.DialogueCommandConsumer,
+	cfg config.ConsumerConfig,
+) *replay.Replayer {
+	return replay.NewReplayer(broker, syncProducer, dialogueCommandConsumer, cfg.DeadLetterTopic, cfg.Topic)
+}
+
+// NewGrpcServer creates a server with the public services of the app registered.
+func (a *App) NewGrpcServer() *grpc.Server {
+	server := newGrpcServer()
+
+	dialogue.RegisterDialogueServiceServer(server, api.NewDialogueService(a.appService))
+	reflection.Register(server)
+
+	return server
+}
+
+// NewAdminGrpcServer creates a server with the admin service of the app registered. It must not be
+// reachable by clients of the public services.
+func (a *App) NewAdminGrpcServer() *grpc.Server {
+	server := newGrpcServer()
+
+	dialogue.RegisterDialogueAdminServiceServer(server, api.NewDialogueAdminService(a.replayer))
+	reflection.Register(server)
+
+	return server
+}
+
+func newGrpcServer() *grpc.Server {
+	return grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
 			interceptor.LoggingInterceptor,
 			interceptor.ErrorInterceptor,
 		),
 	)
+}
 
-	dialogue.RegisterDialogueServiceServer(server, grpcDialogueService)
-	reflection.Register(server)
+func Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	go func() {
-		err = server.Serve(listener)
+	cfg := config.LoadConfig()
+
+	addLogger()
+
+	a, err := New(ctx, cfg)
+
+	if err != nil {
+		return err
+	}
+
+	wg := &sync.WaitGroup{}
+
+	err = a.Start(ctx, wg)
+
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Service.GrpcPort))
+
+	if err != nil {
+		return err
+	}
+
+	server := a.NewGrpcServer()
+
+	var adminServer *grpc.Server
+
+	if cfg.Service.AdminGrpcPort != 0 {
+		adminListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Service.AdminGrpcPort))
 
 		if err != nil {
-			panic(err)
+			return err
+		}
+
+		adminServer = a.NewAdminGrpcServer()
+
+		go func() {
+			serveErr := adminServer.Serve(adminListener)
+
+			if serveErr != nil {
+				panic(serveErr)
+			}
+		}()
+	} else {
+		slog.Info("Admin port not configured, the admin service is disabled")
+	}
+
+	metricsServer := metrics.NewServer(cfg.Service.MetricsPort)
+	go metrics.Serve(metricsServer)
+
+	go func() {
+		serveErr := server.Serve(listener)
+
+		if serveErr != nil {
+			panic(serveErr)
 		}
 	}()
 
@@ -95,12 +378,20 @@ func Run() {
 	select {
 	case <-sigterm:
 		server.GracefulStop()
+
+		if adminServer != nil {
+			adminServer.GracefulStop()
+		}
+
+		_ = metricsServer.Shutdown(ctx)
 		cancel()
 	}
 
 	wg.Wait()
 
 	slog.Info("Gracefully shut down")
+
+	return nil
 }
 
 func addLogger() {
@@ -110,7 +401,43 @@ func addLogger() {
 	slog.SetDefault(logger)
 }
 
-func NewConn(cfg config.DatabaseConfig) *sql.DB {
+func newBroker(cfg config.KafkaConfig) kafka.IBroker {
+	if cfg.InMemory {
+		return memory.NewBroker(inMemoryPartitions)
+	}
+
+	return kafka.NewCluster(cfg)
+}
+
+func newSchemaRegistry(cfg config.SchemaRegistryConfig) outbox.ISchemaRegistry {
+	if cfg.InMemory {
+		return schemaregistry.NewInMemoryRegistry()
+	}
+
+	if cfg.Url == "" {
+		return nil
+	}
+
+	return schemaregistry.NewClient(cfg)
+}
+
+// newCounterClient returns nil if the counter service is not configured. The fake counter service is
+// used only along with the in-memory broker: its counters are never updated, so reconciling against it
+// would send adjustments for every unread counter to the real counter service.
+func newCounterClient(cfg config.CounterConfig, kafkaInMemory bool) service.ICounterClient {
+	if !cfg.InMemory {
+		return nil
+	}
+
+	if !kafkaInMemory {
+		slog.Warn("In-memory counter service requires the in-memory broker, it is ignored")
+		return nil
+	}
+
+	return counter.NewFakeClient()
+}
+
+func NewConn(cfg config.DatabaseConfig) (*sql.DB, error) {
 	connStr := fmt.Sprintf(
 		"host=%v port=%v user=%v password=%v dbname=%v",
 		cfg.Host,
@@ -119,11 +446,5 @@ func NewConn(cfg config.DatabaseConfig) *sql.DB {
 		cfg.Password,
 		cfg.DatabaseName)
 
-	conn, err := sql.Open("pgx", connStr)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return conn
+	return sql.Open("pgx", connStr)
 }
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+)
+
+func TestNew_ReconcilesOnlyIfEnabled(t *testing.T) {
+	cfg := config.LoadConfigFromFile(filepath.Join("..", "..", "configs", "standalone.yml"))
+
+	a, err := New(context.Background(), cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.reconciler != nil {
+		t.Error("reconciliation is enabled by default")
+	}
+
+	cfg.Reconciliation.Enabled = true
+
+	a, err = New(context.Background(), cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.reconciler == nil {
+		t.Error("reconciliation is not enabled by the flag")
+	}
+}
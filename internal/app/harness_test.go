@@ -0,0 +1,441 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/consumer"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/memory"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/outbox"
+	"github.com/orochi-keydream/dialogue-service/internal/proto/dialogue"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	awaitTimeout = 5 * time.Second
+	pollInterval = 5 * time.Millisecond
+
+	addNewUnreadMessageType = "com.orochi-keydream.dialogue.add_new_unread_message.v1"
+)
+
+// replyFunc decides how the simulated counter service replies to the attempt-th delivery of the
+// command, starting from 1. An empty command means no reply.
+type replyFunc func(cmd outbox.AddNewUnreadMessageDto, attempt int) []consumer.MessageCommand
+
+func commitAll(outbox.AddNewUnreadMessageDto, int) []consumer.MessageCommand {
+	return []consumer.MessageCommand{consumer.MessageCommandCommitMessage}
+}
+
+func rollbackAll(outbox.AddNewUnreadMessageDto, int) []consumer.MessageCommand {
+	return []consumer.MessageCommand{consumer.MessageCommandRollbackMessage}
+}
+
+// harness runs the app wired the same way as Run does, with the data and the broker kept in memory,
+// and serves its gRPC services over an in-process connection.
+type harness struct {
+	t      *testing.T
+	ctx    context.Context
+	cfg    config.Config
+	app    *App
+	broker *memory.Broker
+	client dialogue.DialogueServiceClient
+}
+
+// newHarness starts the app with the standalone config adjusted by configure and a simulated
+// counter service replying to the commands it receives with reply.
+func newHarness(t *testing.T, reply replyFunc, configure ...func(cfg *config.Config)) *harness {
+	t.Helper()
+
+	cfg := config.LoadConfigFromFile(filepath.Join("..", "..", "configs", "standalone.yml"))
+	cfg.Outbox.Interval = 10 * time.Millisecond
+	// The reaper is run by the tests when needed.
+	cfg.Saga.Interval = time.Hour
+	cfg.Kafka.Consumers.DialogueCommands.BatchLinger = time.Millisecond
+	cfg.Kafka.Consumers.DialogueCommands.Retry.InitialBackoff = time.Millisecond
+	cfg.Kafka.Consumers.DialogueCommands.Retry.MaxBackoff = time.Millisecond
+
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a, err := New(ctx, cfg)
+
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	wg := &sync.WaitGroup{}
+
+	err = a.Start(ctx, wg)
+
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := a.NewGrpcServer()
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	h := &harness{
+		t:      t,
+		ctx:    ctx,
+		cfg:    cfg,
+		app:    a,
+		broker: a.broker.(*memory.Broker),
+		client: dialogue.NewDialogueServiceClient(conn),
+	}
+
+	h.runCounterService(wg, reply)
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+		server.Stop()
+		cancel()
+		wg.Wait()
+	})
+
+	return h
+}
+
+// runCounterService consumes the commands published for the counter service and replies to them.
+func (h *harness) runCounterService(wg *sync.WaitGroup, reply replyFunc) {
+	cg, err := h.broker.NewConsumerGroup(config.ConsumerConfig{GroupId: "counter-service"})
+
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	producer, err := h.broker.NewSyncProducer()
+
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	handler := &counterService{
+		h:        h,
+		producer: producer,
+		reply:    reply,
+		attempts: make(map[string]int),
+	}
+
+	topic := h.cfg.Kafka.Producers[model.OutboxMessageTypeAddNewUnreadMessage.String()].Topic
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		defer func() {
+			_ = cg.Close()
+		}()
+
+		for h.ctx.Err() == nil {
+			_ = cg.Consume(h.ctx, []string{topic}, handler)
+		}
+	}()
+}
+
+type counterService struct {
+	h        *harness
+	producer sarama.SyncProducer
+	reply    replyFunc
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func (s *counterService) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (s *counterService) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (s *counterService) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if header(msg, outbox.HeaderType) == addNewUnreadMessageType {
+			err := s.handle(msg)
+
+			if err != nil {
+				s.h.t.Errorf("counter service failed to handle message: %v", err)
+			}
+		}
+
+		session.MarkMessage(msg, "")
+	}
+
+	return nil
+}
+
+func (s *counterService) handle(msg *sarama.ConsumerMessage) error {
+	cmd := outbox.AddNewUnreadMessageDto{}
+	err := json.Unmarshal(msg.Value, &cmd)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.attempts[cmd.CorrelationId]++
+	attempt := s.attempts[cmd.CorrelationId]
+	s.mu.Unlock()
+
+	for _, command := range s.reply(cmd, attempt) {
+		err = s.send(cmd, command)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *counterService) send(cmd outbox.AddNewUnreadMessageDto, command consumer.MessageCommand) error {
+	payload, err := json.Marshal(consumer.CommitMessagePayload{MessageId: cmd.MessageId})
+
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(consumer.Message{
+		CorrelationId: cmd.CorrelationId,
+		Command:       command,
+		Version:       1,
+		Payload:       payload,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: s.h.cfg.Kafka.Consumers.DialogueCommands.Topic,
+		Key:   sarama.StringEncoder(cmd.ChatId),
+		Value: sarama.ByteEncoder(value),
+	})
+
+	return err
+}
+
+// sendMessage sends the message through the API and returns its ID.
+func (h *harness) sendMessage(from, to model.UserId, text string) model.MessageId {
+	h.t.Helper()
+
+	_, err := h.client.SendMessageV1(h.ctx, &dialogue.SendMessageV1Request{
+		FromUserId: string(from),
+		ToUserId:   string(to),
+		Text:       text,
+	})
+
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	var id model.MessageId
+
+	for _, msg := range h.getMessages(from, to, false) {
+		if msg.Text == text {
+			id = max(id, model.MessageId(msg.MessageId))
+		}
+	}
+
+	if id == 0 {
+		h.t.Fatalf("sent message %q is not visible to the sender", text)
+	}
+
+	return id
+}
+
+func (h *harness) getMessages(viewer, peer model.UserId, includeFailed bool) []*dialogue.GetMessagesV1Response_Message {
+	h.t.Helper()
+
+	resp, err := h.client.GetMessagesV1(h.ctx, &dialogue.GetMessagesV1Request{
+		FromUserId:    string(viewer),
+		ToUserId:      string(peer),
+		IncludeFailed: includeFailed,
+	})
+
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	return resp.Messages
+}
+
+// awaitState waits until the message reaches the state.
+func (h *harness) awaitState(id model.MessageId, state model.MessageState) *model.Message {
+	h.t.Helper()
+
+	var msg *model.Message
+
+	ok := poll(func() bool {
+		var err error
+		msg, err = h.app.repositories.dialogue.GetMessage(h.ctx, id)
+
+		if err != nil {
+			h.t.Fatal(err)
+		}
+
+		return msg.State == state
+	})
+
+	if !ok {
+		h.t.Fatalf("message %v is in state %v, want %v", id, msg.State, state)
+	}
+
+	return msg
+}
+
+// awaitPublished waits until count commands for the counter service are published and returns them.
+func (h *harness) awaitPublished(count int) []outbox.AddNewUnreadMessageDto {
+	h.t.Helper()
+
+	var published []outbox.AddNewUnreadMessageDto
+
+	ok := poll(func() bool {
+		published = h.published()
+		return len(published) >= count
+	})
+
+	if !ok {
+		h.t.Fatalf("got %v published commands, want %v", len(published), count)
+	}
+
+	return published
+}
+
+// published returns the commands for the counter service published from the outbox.
+func (h *harness) published() []outbox.AddNewUnreadMessageDto {
+	h.t.Helper()
+
+	topic := h.cfg.Kafka.Producers[model.OutboxMessageTypeAddNewUnreadMessage.String()].Topic
+
+	var published []outbox.AddNewUnreadMessageDto
+
+	for _, msg := range h.topicMessages(topic) {
+		if header(msg, outbox.HeaderType) != addNewUnreadMessageType {
+			continue
+		}
+
+		cmd := outbox.AddNewUnreadMessageDto{}
+		err := json.Unmarshal(msg.Value, &cmd)
+
+		if err != nil {
+			h.t.Fatal(err)
+		}
+
+		published = append(published, cmd)
+	}
+
+	return published
+}
+
+func (h *harness) topicMessages(topic string) []*sarama.ConsumerMessage {
+	reader, err := h.broker.NewReader()
+
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	partitions, err := reader.Partitions(topic)
+
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	var messages []*sarama.ConsumerMessage
+
+	for _, partition := range partitions {
+		messages = append(messages, h.broker.Messages(topic, partition)...)
+	}
+
+	return messages
+}
+
+// awaitOutboxDrained waits until every outbox message is published.
+func (h *harness) awaitOutboxDrained() {
+	h.t.Helper()
+
+	var unsent []*model.OutboxMessage
+
+	ok := poll(func() bool {
+		var err error
+		unsent, err = h.app.repositories.outbox.GetUnsent(h.ctx)
+
+		if err != nil {
+			h.t.Fatal(err)
+		}
+
+		return len(unsent) == 0
+	})
+
+	if !ok {
+		h.t.Fatalf("%v outbox messages are still unsent", len(unsent))
+	}
+}
+
+// reap runs the saga reaper once.
+func (h *harness) reap() {
+	h.t.Helper()
+
+	err := h.app.sagaReaper.Reap(h.ctx)
+
+	if err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func poll(condition func() bool) bool {
+	deadline := time.Now().Add(awaitTimeout)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	return true
+}
+
+func header(msg *sarama.ConsumerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
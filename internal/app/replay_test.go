@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+)
+
+func TestNewReplayer_NeverAppliesMigrations(t *testing.T) {
+	cfg := config.LoadConfigFromFile(filepath.Join("..", "..", "configs", "local.yml"))
+
+	// Nothing listens on the port, so applying migrations would fail.
+	cfg.Database.Host = "127.0.0.1"
+	cfg.Database.Port = 1
+	cfg.Database.Migrations.OnStartup = true
+	cfg.Kafka.InMemory = true
+
+	_, err := New(context.Background(), cfg)
+
+	if err == nil {
+		t.Fatal("app started without the database to migrate")
+	}
+
+	_, err = NewReplayer(cfg)
+
+	if err != nil {
+		t.Fatalf("failed to create the replayer: %v", err)
+	}
+}
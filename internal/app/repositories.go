@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/orochi-keydream/dialogue-service/internal/archive"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/migrator"
+	"github.com/orochi-keydream/dialogue-service/internal/repository"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+	"github.com/orochi-keydream/dialogue-service/internal/service"
+)
+
+type dialogueRepository interface {
+	service.IDialogueRepository
+	service.IPendingMessageRepository
+	service.IArchivableMessageRepository
+}
+
+type unreadRepository interface {
+	service.IReadWatermarkRepository
+	service.IUnreadAggregateRepository
+}
+
+type repositories struct {
+	dialogue           dialogueRepository
+	outbox             service.IOutboxRepository
+	command            service.ICommandRepository
+	unread             unreadRepository
+	transactionManager service.ITransactionManager
+	archiveIndex       archive.IIndex
+	leaderLock         service.ILeaderLock
+	// partitions is nil when the data is kept in memory.
+	partitions service.IPartitionRepository
+	// replica is nil when no replica is configured.
+	replica service.IReplicaRouter
+}
+
+// newRepositories connects to the database unless the data is configured to be kept in memory.
+// The history of chats is read from the replica if one is configured.
+func newRepositories(cfg config.DatabaseConfig, replicaCfg config.ReplicaConfig) (*repositories, error) {
+	if cfg.InMemory {
+		store := memory.NewStore()
+
+		return &repositories{
+			dialogue:           memory.NewDialogueRepository(store),
+			outbox:             memory.NewOutboxRepository(store),
+			command:            memory.NewCommandRepository(store),
+			unread:             memory.NewUnreadRepository(store),
+			transactionManager: memory.NewTransactionManager(store),
+			archiveIndex:       memory.NewArchiveIndexRepository(store),
+			leaderLock:         memory.NewLeaderLock(),
+		}, nil
+	}
+
+	conn, err := NewConn(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transactionManager, err := repository.NewTransactionManager(conn, cfg.Transaction)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var replicaConn *sql.DB
+
+	if replicaCfg.Host != "" {
+		replicaConn, err = NewConn(replicaCfg.DatabaseConfig)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The replica may lag behind by up to max_lag plus the time until the next check notices it lags more.
+	router := repository.NewConnectionRouter(conn, replicaConn, replicaCfg.MaxLag+replicaCfg.Interval)
+
+	repos := &repositories{
+		dialogue:           repository.NewDialogueRepository(conn, router),
+		outbox:             repository.NewOutboxRepository(conn),
+		command:            repository.NewCommandRepository(conn),
+		unread:             repository.NewUnreadRepository(conn),
+		transactionManager: transactionManager,
+		archiveIndex:       repository.NewArchiveIndexRepository(conn),
+		leaderLock:         repository.NewAdvisoryLock(conn),
+		partitions:         repository.NewPartitionRepository(conn),
+	}
+
+	if replicaConn != nil {
+		repos.replica = router
+	}
+
+	return repos, nil
+}
+
+// applyMigrations applies pending migrations to the database. It refuses to apply them if a manual
+// migration is pending, since it would block writes while every replica starts.
+func applyMigrations(ctx context.Context, cfg config.DatabaseConfig) error {
+	conn, err := NewConn(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	m, err := migrator.New(conn, cfg.Migrations)
+
+	if err != nil {
+		return err
+	}
+
+	manual, err := m.PendingManual(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if len(manual) > 0 {
+		return fmt.Errorf("migrations %v must be applied with the migrate command while the service is stopped", manual)
+	}
+
+	_, err = m.Up(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/consumer"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/outbox"
+	"github.com/orochi-keydream/dialogue-service/internal/proto/dialogue"
+)
+
+const (
+	alice model.UserId = "alice"
+	bob   model.UserId = "bob"
+)
+
+func TestSaga_CommittedMessageBecomesVisibleToPeer(t *testing.T) {
+	h := newHarness(t, commitAll)
+
+	id := h.sendMessage(alice, bob, "hello")
+
+	msg := h.awaitState(id, model.MessageStateSent)
+	h.awaitOutboxDrained()
+
+	published := h.awaitPublished(1)
+
+	if published[0].MessageId != int64(id) || published[0].UserId != string(bob) {
+		t.Errorf("got published command %+v for message %v", published[0], id)
+	}
+
+	if published[0].CorrelationId != msg.CorrelationId {
+		t.Errorf("got correlation ID %v, want %v", published[0].CorrelationId, msg.CorrelationId)
+	}
+
+	messages := h.getMessages(bob, alice, false)
+
+	if len(messages) != 1 || messages[0].State != dialogue.MessageState_MESSAGE_STATE_SENT {
+		t.Fatalf("got %v messages visible to the peer, want the sent one", messages)
+	}
+}
+
+func TestSaga_PendingMessageIsHiddenFromPeer(t *testing.T) {
+	none := func(outbox.AddNewUnreadMessageDto, int) []consumer.MessageCommand { return nil }
+	h := newHarness(t, none)
+
+	id := h.sendMessage(alice, bob, "hello")
+	h.awaitPublished(1)
+
+	if messages := h.getMessages(bob, alice, false); len(messages) != 0 {
+		t.Errorf("got %v messages visible to the peer, want none", len(messages))
+	}
+
+	messages := h.getMessages(alice, bob, false)
+
+	if len(messages) != 1 || messages[0].State != dialogue.MessageState_MESSAGE_STATE_PENDING {
+		t.Errorf("got %v messages visible to the sender, want the pending one", messages)
+	}
+
+	h.awaitState(id, model.MessageStatePending)
+}
+
+func TestSaga_RolledBackMessageIsHiddenFromPeer(t *testing.T) {
+	h := newHarness(t, rollbackAll)
+
+	id := h.sendMessage(alice, bob, "hello")
+
+	h.awaitState(id, model.MessageStateRemoved)
+
+	if messages := h.getMessages(bob, alice, true); len(messages) != 0 {
+		t.Errorf("got %v messages visible to the peer, want none", len(messages))
+	}
+
+	messages := h.getMessages(alice, bob, true)
+
+	if len(messages) != 1 || messages[0].State != dialogue.MessageState_MESSAGE_STATE_FAILED {
+		t.Errorf("got %v messages visible to the sender, want the failed one", messages)
+	}
+}
+
+func TestSaga_DuplicateRepliesAreHandledOnce(t *testing.T) {
+	twice := func(outbox.AddNewUnreadMessageDto, int) []consumer.MessageCommand {
+		return []consumer.MessageCommand{consumer.MessageCommandCommitMessage, consumer.MessageCommandCommitMessage}
+	}
+
+	h := newHarness(t, twice)
+
+	id := h.sendMessage(alice, bob, "hello")
+	h.awaitState(id, model.MessageStateSent)
+	h.awaitPublished(1)
+
+	if deadLetters := h.topicMessages(h.cfg.Kafka.Consumers.DialogueCommands.DeadLetterTopic); len(deadLetters) != 0 {
+		t.Errorf("got %v dead letters, want none", len(deadLetters))
+	}
+}
+
+func TestSaga_StuckMessageIsReemitted(t *testing.T) {
+	secondAttempt := func(_ outbox.AddNewUnreadMessageDto, attempt int) []consumer.MessageCommand {
+		if attempt < 2 {
+			return nil
+		}
+
+		return []consumer.MessageCommand{consumer.MessageCommandCommitMessage}
+	}
+
+	h := newHarness(t, secondAttempt, func(cfg *config.Config) {
+		cfg.Saga.PendingTimeout = time.Millisecond
+	})
+
+	id := h.sendMessage(alice, bob, "hello")
+	h.awaitPublished(1)
+
+	time.Sleep(2 * h.cfg.Saga.PendingTimeout)
+	h.reap()
+
+	h.awaitState(id, model.MessageStateSent)
+
+	published := h.awaitPublished(2)
+
+	if published[0].CorrelationId != published[1].CorrelationId {
+		t.Errorf("re-emitted command has correlation ID %v, want %v", published[1].CorrelationId, published[0].CorrelationId)
+	}
+}
+
+func TestSaga_StuckMessageIsRolledBackAfterReemits(t *testing.T) {
+	none := func(outbox.AddNewUnreadMessageDto, int) []consumer.MessageCommand { return nil }
+
+	h := newHarness(t, none, func(cfg *config.Config) {
+		cfg.Saga.PendingTimeout = time.Millisecond
+		cfg.Saga.MaxReemits = 1
+		cfg.Saga.Resolution = "rollback"
+	})
+
+	id := h.sendMessage(alice, bob, "hello")
+	published := h.awaitPublished(1)
+
+	time.Sleep(2 * h.cfg.Saga.PendingTimeout)
+	h.reap()
+	h.awaitPublished(2)
+
+	time.Sleep(2 * h.cfg.Saga.PendingTimeout)
+	h.reap()
+
+	h.awaitState(id, model.MessageStateRemoved)
+	h.awaitOutboxDrained()
+
+	// The counter service may have added the unread message without its reply reaching the service.
+	compensations := h.topicMessages(h.cfg.Kafka.Producers[model.OutboxMessageTypeRemoveUnreadMessage.String()].Topic)
+
+	if len(compensations) != 1 {
+		t.Fatalf("got %v compensations, want 1", len(compensations))
+	}
+
+	var compensation outbox.RemoveUnreadMessageDto
+
+	if err := json.Unmarshal(compensations[0].Value, &compensation); err != nil {
+		t.Fatal(err)
+	}
+
+	if compensation.CorrelationId != published[0].CorrelationId || compensation.MessageId != int64(id) {
+		t.Errorf("got compensation %+v, want one of message %v with correlation ID %v", compensation, id, published[0].CorrelationId)
+	}
+}
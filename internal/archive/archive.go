@@ -0,0 +1,265 @@
+// Package archive keeps the messages moved out of the database. Messages of a chat are stored in one
+// gzipped JSON Lines blob per month they were sent in, and the blobs are listed in an index kept in
+// the database, so reading a page of history only fetches the blobs the page overlaps and never lists
+// the blob store.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/blob"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+const blobSuffix = ".jsonl.gz"
+
+type IBlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// IIndex keeps the blobs of every chat.
+type IIndex interface {
+	GetBlobs(ctx context.Context, chatId model.ChatId) ([]*model.ArchiveBlob, error)
+	GetNewestSentAt(ctx context.Context, chatId model.ChatId) (time.Time, bool, error)
+	SaveBlob(ctx context.Context, blob *model.ArchiveBlob) error
+}
+
+type Archive struct {
+	blobs IBlobStore
+	index IIndex
+}
+
+func NewArchive(blobs IBlobStore, index IIndex) *Archive {
+	return &Archive{
+		blobs: blobs,
+		index: index,
+	}
+}
+
+// Write adds the messages of the chat to the blobs of the months they were sent in. A blob is rewritten
+// with the messages it already holds, so a chat has a single blob per month however many runs archive
+// its messages. The blob is written before it is saved in the index, and its key depends on the month
+// only, so an interrupted write is completed by the next one. Writes must not run concurrently.
+func (a *Archive) Write(ctx context.Context, chatId model.ChatId, messages []*model.Message) error {
+	var months []time.Time
+
+	byMonth := make(map[time.Time][]*model.Message)
+
+	for _, msg := range messages {
+		month := model.ArchiveMonth(msg.SentAt)
+
+		if _, ok := byMonth[month]; !ok {
+			months = append(months, month)
+		}
+
+		byMonth[month] = append(byMonth[month], msg)
+	}
+
+	for _, month := range months {
+		err := a.writeMonth(ctx, chatId, month, byMonth[month])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Archive) writeMonth(ctx context.Context, chatId model.ChatId, month time.Time, messages []*model.Message) error {
+	key := blobKey(chatId, month)
+
+	stored, err := a.read(ctx, key)
+
+	if err != nil && !errors.Is(err, blob.ErrNotFound) {
+		return err
+	}
+
+	// A message archived again, e.g. after an interrupted run, replaces the stored one.
+	merged := slices.DeleteFunc(stored, func(stored *model.Message) bool {
+		return slices.ContainsFunc(messages, func(msg *model.Message) bool { return msg.MessageId == stored.MessageId })
+	})
+
+	merged = append(merged, messages...)
+	slices.SortFunc(merged, model.CompareMessages)
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	encoder := json.NewEncoder(gz)
+
+	for _, msg := range merged {
+		err = encoder.Encode(newMessageDto(msg))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = gz.Close()
+
+	if err != nil {
+		return err
+	}
+
+	err = a.blobs.Put(ctx, key, buf.Bytes())
+
+	if err != nil {
+		return err
+	}
+
+	return a.index.SaveBlob(ctx, &model.ArchiveBlob{
+		ChatId:       chatId,
+		Month:        month,
+		Key:          key,
+		FromSentAt:   merged[len(merged)-1].SentAt,
+		ToSentAt:     merged[0].SentAt,
+		MessageCount: len(merged),
+	})
+}
+
+// GetVisibleMessages returns at most limit archived messages of the chat following the cursor,
+// visible to the viewer, newest first. Zero limit returns every message.
+func (a *Archive) GetVisibleMessages(
+	ctx context.Context,
+	chatId model.ChatId,
+	viewerId model.UserId,
+	viewerStates []model.MessageState,
+	cursor *model.MessageCursor,
+	limit int,
+) ([]*model.Message, error) {
+	blobs, err := a.index.GetBlobs(ctx, chatId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(blobs, func(a, b *model.ArchiveBlob) int { return b.Month.Compare(a.Month) })
+
+	var messages []*model.Message
+
+	for _, b := range blobs {
+		if cursor != nil && b.FromSentAt.After(cursor.SentAt) {
+			continue
+		}
+
+		// Blobs hold separate months and are visited from the newest, so once the page is full the
+		// rest holds older messages only.
+		if limit > 0 && len(messages) >= limit {
+			break
+		}
+
+		read, err := a.read(ctx, b.Key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range read {
+			if cursor.Admits(msg) && msg.VisibleTo(viewerId, viewerStates) {
+				messages = append(messages, msg)
+			}
+		}
+
+		slices.SortFunc(messages, model.CompareMessages)
+	}
+
+	if limit > 0 && len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+// NewestSentAt returns the time the newest archived message of the chat was sent, if there are any.
+func (a *Archive) NewestSentAt(ctx context.Context, chatId model.ChatId) (time.Time, bool, error) {
+	return a.index.GetNewestSentAt(ctx, chatId)
+}
+
+func (a *Archive) read(ctx context.Context, key string) ([]*model.Message, error) {
+	data, err := a.blobs.Get(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %v: %w", key, err)
+	}
+
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(nil, 1024*1024)
+
+	var messages []*model.Message
+
+	for scanner.Scan() {
+		dto := messageDto{}
+		err = json.Unmarshal(scanner.Bytes(), &dto)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob %v: %w", key, err)
+		}
+
+		messages = append(messages, dto.toModel())
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read blob %v: %w", key, err)
+	}
+
+	return messages, nil
+}
+
+func blobKey(chatId model.ChatId, month time.Time) string {
+	return "chats/" + url.PathEscape(string(chatId)) + "/" + month.Format("2006-01") + blobSuffix
+}
+
+type messageDto struct {
+	MessageId     int64     `json:"messageId"`
+	ChatId        string    `json:"chatId"`
+	SentAt        time.Time `json:"sentAt"`
+	FromUserId    string    `json:"fromUserId"`
+	ToUserId      string    `json:"toUserId"`
+	Text          string    `json:"text"`
+	State         int32     `json:"state"`
+	CorrelationId string    `json:"correlationId,omitempty"`
+}
+
+func newMessageDto(msg *model.Message) messageDto {
+	return messageDto{
+		MessageId:     int64(msg.MessageId),
+		ChatId:        string(msg.ChatId),
+		SentAt:        msg.SentAt,
+		FromUserId:    string(msg.FromUserId),
+		ToUserId:      string(msg.ToUserId),
+		Text:          msg.Text,
+		State:         int32(msg.State),
+		CorrelationId: msg.CorrelationId,
+	}
+}
+
+func (dto messageDto) toModel() *model.Message {
+	return &model.Message{
+		MessageId:     model.MessageId(dto.MessageId),
+		ChatId:        model.ChatId(dto.ChatId),
+		SentAt:        dto.SentAt,
+		FromUserId:    model.UserId(dto.FromUserId),
+		ToUserId:      model.UserId(dto.ToUserId),
+		Text:          dto.Text,
+		State:         model.MessageState(dto.State),
+		CorrelationId: dto.CorrelationId,
+	}
+}
@@ -0,0 +1,156 @@
+package archive
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/blob"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+)
+
+const chatId model.ChatId = "alice_bob"
+
+func TestGetVisibleMessages_PagesAcrossBlobs(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newArchive(t)
+	start := time.Date(2023, time.January, 31, 22, 0, 0, 0, time.UTC)
+
+	// Two batches with overlapping ranges across two months, the way a message resolved late ends up in
+	// a later batch.
+	write(t, a, newMessage(1, start), newMessage(2, start.Add(time.Hour)), newMessage(4, start.Add(3*time.Hour)))
+	write(t, a, newMessage(3, start.Add(2*time.Hour)), newMessage(5, start.Add(4*time.Hour)))
+
+	var (
+		cursor *model.MessageCursor
+		got    []model.MessageId
+	)
+
+	for {
+		page, err := a.GetVisibleMessages(ctx, chatId, "bob", nil, cursor, 2)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, msg := range page {
+			got = append(got, msg.MessageId)
+		}
+
+		if len(page) < 2 {
+			break
+		}
+
+		cursor = model.NewMessageCursor(page[len(page)-1])
+	}
+
+	want := []model.MessageId{5, 4, 3, 2, 1}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got messages %v, want %v", got, want)
+	}
+
+	newest, ok, err := a.NewestSentAt(ctx, chatId)
+
+	if err != nil || !ok || newest.Before(start.Add(4*time.Hour)) {
+		t.Errorf("got newest archived message sent at %v, %v, %v", newest, ok, err)
+	}
+}
+
+func TestWrite_CompactsBatchesOfMonthIntoOneBlob(t *testing.T) {
+	ctx := context.Background()
+	a, index := newArchive(t)
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	write(t, a, newMessage(1, start), newMessage(2, start.Add(time.Hour)))
+	write(t, a, newMessage(3, start.Add(2*time.Hour)))
+	write(t, a, newMessage(4, start.AddDate(0, 1, 0)))
+
+	blobs, err := index.GetBlobs(ctx, chatId)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blobs) != 2 {
+		t.Fatalf("got %v blobs, want one per month", len(blobs))
+	}
+
+	for _, b := range blobs {
+		if b.Month.Equal(model.ArchiveMonth(start)) && b.MessageCount != 3 {
+			t.Errorf("got %v messages in the blob of the first month, want 3", b.MessageCount)
+		}
+	}
+}
+
+func TestGetVisibleMessages_ReturnsRewrittenMessagesOnce(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newArchive(t)
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	failed := newMessage(2, start.Add(time.Hour))
+	failed.State = model.MessageStateRemoved
+
+	write(t, a, newMessage(1, start), failed)
+	write(t, a, newMessage(1, start))
+
+	messages, err := a.GetVisibleMessages(ctx, chatId, "bob", nil, nil, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 1 || messages[0].MessageId != 1 {
+		t.Errorf("got %v messages visible to the peer, want the sent one once", len(messages))
+	}
+
+	messages, err = a.GetVisibleMessages(ctx, chatId, "alice", []model.MessageState{model.MessageStateRemoved}, nil, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 2 {
+		t.Errorf("got %v messages visible to the sender, want 2", len(messages))
+	}
+}
+
+func TestNewestSentAt_EmptyArchive(t *testing.T) {
+	a, _ := newArchive(t)
+
+	_, ok, err := a.NewestSentAt(context.Background(), chatId)
+
+	if err != nil || ok {
+		t.Errorf("got %v, %v for an empty archive", ok, err)
+	}
+}
+
+func newArchive(t *testing.T) (*Archive, *memory.ArchiveIndexRepository) {
+	index := memory.NewArchiveIndexRepository(memory.NewStore())
+
+	return NewArchive(blob.NewLocalStore(t.TempDir()), index), index
+}
+
+func write(t *testing.T, a *Archive, messages ...*model.Message) {
+	t.Helper()
+
+	err := a.Write(context.Background(), chatId, messages)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newMessage(id model.MessageId, sentAt time.Time) *model.Message {
+	return &model.Message{
+		MessageId:  id,
+		ChatId:     chatId,
+		SentAt:     sentAt,
+		FromUserId: "alice",
+		ToUserId:   "bob",
+		Text:       "hello",
+		State:      model.MessageStateSent,
+	}
+}
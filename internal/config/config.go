@@ -1,41 +1,124 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Service  ServiceConfig  `yaml:"service"`
-	Kafka    KafkaConfig    `yaml:"kafka"`
-	Database DatabaseConfig `yaml:"database"`
+	Service        ServiceConfig        `yaml:"service"`
+	Kafka          KafkaConfig          `yaml:"kafka"`
+	Database       DatabaseConfig       `yaml:"database"`
+	Replica        ReplicaConfig        `yaml:"replica"`
+	Outbox         OutboxConfig         `yaml:"outbox"`
+	Saga           SagaConfig           `yaml:"saga"`
+	Counter        CounterConfig        `yaml:"counter"`
+	Reconciliation ReconciliationConfig `yaml:"reconciliation"`
+	Partitioning   PartitioningConfig   `yaml:"partitioning"`
+	Archive        ArchiveConfig        `yaml:"archive"`
 }
 
+// ServiceConfig sets the ports of the service. The admin service is served on AdminGrpcPort apart from
+// the public one, so that the port can be kept reachable by operators only. It is not served if the
+// port is not set.
 type ServiceConfig struct {
-	GrpcPort int `yaml:"grpc_port"`
+	Name          string `yaml:"name" env-default:"dialogue-service"`
+	GrpcPort      int    `yaml:"grpc_port"`
+	AdminGrpcPort int    `yaml:"admin_grpc_port"`
+	MetricsPort   int    `yaml:"metrics_port"`
 }
 
+// DatabaseConfig points to Postgres, InMemory keeps the data in memory instead and loses it on restart.
 type DatabaseConfig struct {
-	Host         string `yaml:"host"`
-	Port         int    `yaml:"port"`
-	DatabaseName string `yaml:"dbname"`
-	User         string `yaml:"user"`
-	Password     string `yaml:"password"`
+	InMemory     bool              `yaml:"in_memory"`
+	Host         string            `yaml:"host"`
+	Port         int               `yaml:"port"`
+	DatabaseName string            `yaml:"dbname"`
+	User         string            `yaml:"user"`
+	Password     string            `yaml:"password"`
+	Transaction  TransactionConfig `yaml:"transaction"`
+	Migrations   MigrationsConfig  `yaml:"migrations"`
 }
 
+// ReplicaConfig points to a read replica of the database serving the history of chats. The history is
+// read from the primary while the replica lags behind by more than MaxLag or cannot be reached, the lag
+// is checked every Interval. The replica is not used if Host is not set.
+type ReplicaConfig struct {
+	DatabaseConfig `yaml:",inline"`
+	MaxLag         time.Duration `yaml:"max_lag" env-default:"5s"`
+	Interval       time.Duration `yaml:"interval" env-default:"5s"`
+}
+
+// MigrationsConfig enables applying the embedded migrations when the service starts. SkipCitus
+// skips the migrations distributing tables, so that plain Postgres can be used.
+type MigrationsConfig struct {
+	OnStartup bool `yaml:"on_startup"`
+	SkipCitus bool `yaml:"skip_citus"`
+}
+
+// TransactionConfig sets the isolation level of transactions: read_committed, repeatable_read or
+// serializable. Transactions failing to serialize are retried up to MaxRetries times, waiting
+// RetryBackoff before the first retry and twice as long before every next one, up to MaxRetryBackoff.
+type TransactionConfig struct {
+	Isolation       string        `yaml:"isolation" env-default:"read_committed"`
+	MaxRetries      int           `yaml:"max_retries" env-default:"3"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" env-default:"50ms"`
+	MaxRetryBackoff time.Duration `yaml:"max_retry_backoff" env-default:"1s"`
+}
+
+// OutboxConfig sets how often unsent outbox messages are published.
+type OutboxConfig struct {
+	Interval time.Duration `yaml:"interval" env-default:"5s"`
+}
+
+// KafkaConfig points to the cluster, InMemory replaces it with a broker kept in the process.
 type KafkaConfig struct {
-	Brokers   []string        `yaml:"brokers"`
-	Producers ProducerConfigs `yaml:"producers"`
-	Consumers ConsumerConfigs `yaml:"consumers"`
+	InMemory       bool                 `yaml:"in_memory"`
+	Brokers        []string             `yaml:"brokers"`
+	Security       SecurityConfig       `yaml:"security"`
+	SchemaRegistry SchemaRegistryConfig `yaml:"schema_registry"`
+	Producers      ProducerConfigs      `yaml:"producers"`
+	Consumers      ConsumerConfigs      `yaml:"consumers"`
+}
+
+// SecurityConfig applies to every connection to the cluster.
+type SecurityConfig struct {
+	Tls  TlsConfig  `yaml:"tls"`
+	Sasl SaslConfig `yaml:"sasl"`
+}
+
+type TlsConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CaFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
-type ProducerConfigs struct {
-	CounterCommands ProducerConfig `yaml:"counter_commands"`
+// SaslConfig enables SASL authentication when Mechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512.
+type SaslConfig struct {
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
 }
 
+type SchemaRegistryConfig struct {
+	Url      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	InMemory bool   `yaml:"in_memory"`
+}
+
+// ProducerConfigs maps an outbox message type name to the destination it is published to.
+type ProducerConfigs map[string]ProducerConfig
+
 type ProducerConfig struct {
-	Topic string `yaml:"topic"`
+	Topic   string            `yaml:"topic"`
+	Format  string            `yaml:"format"`
+	Headers map[string]string `yaml:"headers"`
 }
 
 type ConsumerConfigs struct {
@@ -43,7 +126,93 @@ type ConsumerConfigs struct {
 }
 
 type ConsumerConfig struct {
-	Topic string `yaml:"topic"`
+	Topic             string        `yaml:"topic"`
+	DeadLetterTopic   string        `yaml:"dead_letter_topic"`
+	GroupId           string        `yaml:"group_id" env-default:"dialogue-service"`
+	InitialOffset     string        `yaml:"initial_offset" env-default:"oldest"`
+	RebalanceStrategy string        `yaml:"rebalance_strategy" env-default:"sticky"`
+	SessionTimeout    time.Duration `yaml:"session_timeout" env-default:"10s"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" env-default:"3s"`
+	MaxProcessingTime time.Duration `yaml:"max_processing_time" env-default:"100ms"`
+	Fetch             FetchConfig   `yaml:"fetch"`
+	Workers           int           `yaml:"workers" env-default:"8"`
+	BatchSize         int           `yaml:"batch_size" env-default:"100"`
+	BatchLinger       time.Duration `yaml:"batch_linger" env-default:"10ms"`
+	Retry             RetryConfig   `yaml:"retry"`
+}
+
+// FetchConfig limits the number of bytes requested from a broker at once, zero MaxBytes means no limit.
+type FetchConfig struct {
+	MinBytes     int32 `yaml:"min_bytes" env-default:"1"`
+	DefaultBytes int32 `yaml:"default_bytes" env-default:"1048576"`
+	MaxBytes     int32 `yaml:"max_bytes"`
+}
+
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts" env-default:"3"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" env-default:"100ms"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env-default:"5s"`
+}
+
+// SagaConfig controls how messages stuck in the pending state are handled. After MaxReemits
+// re-emissions of the saga command a message is resolved by either a rollback or a commit. A rollback
+// publishes a remove_unread_message compensation with the correlation ID of the saga, so that the
+// counter service undoes the unread message if it has added it.
+type SagaConfig struct {
+	Interval       time.Duration `yaml:"interval" env-default:"30s"`
+	PendingTimeout time.Duration `yaml:"pending_timeout" env-default:"1m"`
+	MaxReemits     int           `yaml:"max_reemits" env-default:"3"`
+	Resolution     string        `yaml:"resolution" env-default:"rollback"`
+	BatchSize      int           `yaml:"batch_size" env-default:"100"`
+}
+
+// CounterConfig replaces the counter service with a fake kept in memory if InMemory is set. The fake is
+// used only along with the in-memory broker. The service cannot read counters from the real counter
+// service yet, since it exposes no API to read them.
+type CounterConfig struct {
+	InMemory bool `yaml:"in_memory"`
+}
+
+// ReconciliationConfig controls the job comparing unread counters with the messages, it runs only if
+// Enabled is set and the counter service is configured. Chats with messages sent within SettleTime are
+// left for the next run.
+//
+// Unread messages are counted from the read watermarks, which only read receipts sent by clients through
+// ReadMessagesV1 advance. Enable the job once clients send them: counters of recipients who have never
+// sent one are not reconciled.
+type ReconciliationConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Interval   time.Duration `yaml:"interval" env-default:"10m"`
+	BatchSize  int           `yaml:"batch_size" env-default:"500"`
+	SettleTime time.Duration `yaml:"settle_time" env-default:"1m"`
+}
+
+// PartitioningConfig controls the job maintaining monthly partitions of the messages table. Partitions
+// are created PremakeMonths ahead, and the ones that ended more than RetentionMonths ago are detached.
+// Zero RetentionMonths keeps every partition attached.
+//
+// Retention drops data from the service: messages of a detached partition are no longer read by it.
+// A partition is therefore detached only once the archiver has moved all its messages, and one with
+// messages left is kept past the retention period.
+type PartitioningConfig struct {
+	Interval        time.Duration `yaml:"interval" env-default:"1h"`
+	PremakeMonths   int           `yaml:"premake_months" env-default:"3"`
+	RetentionMonths int           `yaml:"retention_months"`
+}
+
+// ArchiveConfig controls the job moving messages sent more than Age ago from the database to the
+// archive kept in Dir. Only failed messages and messages read by the recipient are moved. Archival
+// is disabled if Dir is not set.
+//
+// Archived messages are deleted from the shared database, so every replica has to read the archive
+// from the same place. Shared confirms that Dir is a volume mounted by all the replicas, the service
+// refuses to start otherwise unless the data is kept in memory.
+type ArchiveConfig struct {
+	Dir       string        `yaml:"dir"`
+	Shared    bool          `yaml:"shared"`
+	Age       time.Duration `yaml:"age" env-default:"8760h"`
+	Interval  time.Duration `yaml:"interval" env-default:"1h"`
+	BatchSize int           `yaml:"batch_size" env-default:"1000"`
 }
 
 var (
@@ -52,16 +221,30 @@ var (
 
 func init() {
 	flag.StringVar(&configPath, "config", "", "Specifies the path to the config file.")
-	flag.Parse()
 }
 
+// LoadConfig loads the config from the file specified by the command-line flag.
 func LoadConfig() Config {
-	if configPath == "" {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	return LoadConfigFromFile(configPath)
+}
+
+func LoadConfigFromFile(path string) Config {
+	if path == "" {
 		panic("path to a config file not specified")
 	}
 
 	var config Config
-	err := cleanenv.ReadConfig(configPath, &config)
+	err := cleanenv.ReadConfig(path, &config)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = config.validate()
 
 	if err != nil {
 		panic(err)
@@ -69,3 +252,21 @@ func LoadConfig() Config {
 
 	return config
 }
+
+func (c Config) validate() error {
+	consumerConfig := c.Kafka.Consumers.DialogueCommands
+
+	if consumerConfig.Topic == "" {
+		return errors.New("topic of dialogue commands not specified")
+	}
+
+	if consumerConfig.DeadLetterTopic == "" {
+		return errors.New("dead letter topic of dialogue commands not specified")
+	}
+
+	if c.Archive.Dir != "" && !c.Archive.Shared && !c.Database.InMemory {
+		return errors.New("archive dir is not confirmed to be shared by all the replicas")
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	cases := []struct {
+		name      string
+		consumer  ConsumerConfig
+		archive   ArchiveConfig
+		inMemory  bool
+		expectErr bool
+	}{
+		{
+			name:     "topics specified",
+			consumer: ConsumerConfig{Topic: "dialogue_commands", DeadLetterTopic: "dialogue_commands_dlq"},
+		},
+		{
+			name:      "topic missing",
+			consumer:  ConsumerConfig{DeadLetterTopic: "dialogue_commands_dlq"},
+			expectErr: true,
+		},
+		{
+			name:      "dead letter topic missing",
+			consumer:  ConsumerConfig{Topic: "dialogue_commands"},
+			expectErr: true,
+		},
+		{
+			name:     "shared archive",
+			consumer: ConsumerConfig{Topic: "dialogue_commands", DeadLetterTopic: "dialogue_commands_dlq"},
+			archive:  ArchiveConfig{Dir: "/var/lib/archive", Shared: true},
+		},
+		{
+			name:      "archive not confirmed to be shared",
+			consumer:  ConsumerConfig{Topic: "dialogue_commands", DeadLetterTopic: "dialogue_commands_dlq"},
+			archive:   ArchiveConfig{Dir: "/var/lib/archive"},
+			expectErr: true,
+		},
+		{
+			name:     "local archive with data in memory",
+			consumer: ConsumerConfig{Topic: "dialogue_commands", DeadLetterTopic: "dialogue_commands_dlq"},
+			archive:  ArchiveConfig{Dir: "/tmp/archive"},
+			inMemory: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var config Config
+			config.Kafka.Consumers.DialogueCommands = c.consumer
+			config.Archive = c.archive
+			config.Database.InMemory = c.inMemory
+
+			err := config.validate()
+
+			if c.expectErr && err == nil {
+				t.Error("expected an error")
+			}
+
+			if !c.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
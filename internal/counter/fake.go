@@ -0,0 +1,50 @@
+package counter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+// FakeClient keeps unread counters in memory. It is used in tests and when the service runs
+// without the counter service.
+type FakeClient struct {
+	mu     sync.Mutex
+	counts map[model.UnreadKey]int64
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		counts: make(map[model.UnreadKey]int64),
+	}
+}
+
+func (c *FakeClient) Set(key model.UnreadKey, count int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[key] = count
+}
+
+func (c *FakeClient) Adjust(key model.UnreadKey, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[key] += delta
+}
+
+func (c *FakeClient) GetUnreadCounts(_ context.Context, keys []model.UnreadKey) (map[model.UnreadKey]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[model.UnreadKey]int64, len(keys))
+
+	for _, key := range keys {
+		if count, ok := c.counts[key]; ok {
+			counts[key] = count
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,75 @@
+// Package fixture sets up the data shared by the tests of several packages.
+package fixture
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// IMessageGetter is the part of a dialogue repository the assertions read messages with.
+type IMessageGetter interface {
+	GetMessage(ctx context.Context, id model.MessageId) (*model.Message, error)
+}
+
+// AddMessage adds a message from alice to bob sent at sentAt in the state given.
+func AddMessage(t *testing.T, repository *memory.DialogueRepository, sentAt time.Time, state model.MessageState) model.MessageId {
+	t.Helper()
+
+	id, err := repository.AddMessage(context.Background(), &model.Message{
+		ChatId:     "alice_bob",
+		SentAt:     sentAt,
+		FromUserId: "alice",
+		ToUserId:   "bob",
+		Text:       "hello",
+		State:      state,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// AddPendingMessage adds a message from alice to bob sent just now and waiting for the saga to end.
+func AddPendingMessage(t *testing.T, repository *memory.DialogueRepository) model.MessageId {
+	t.Helper()
+
+	return AddMessage(t, repository, time.Now().UTC(), model.MessageStatePending)
+}
+
+// AssertState fails the test if the message is not in the state wanted.
+func AssertState(t *testing.T, repository IMessageGetter, id model.MessageId, want model.MessageState) {
+	t.Helper()
+
+	msg, err := repository.GetMessage(context.Background(), id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.State != want {
+		t.Errorf("message %v state is %v, want %v", id, msg.State, want)
+	}
+}
+
+// HistogramSamples returns the number and the sum of the samples the histogram has observed.
+func HistogramSamples(t *testing.T, observer prometheus.Observer) (uint64, float64) {
+	t.Helper()
+
+	var metric dto.Metric
+
+	err := observer.(prometheus.Metric).Write(&metric)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/orochi-keydream/dialogue-service/internal/log"
+	"github.com/orochi-keydream/dialogue-service/internal/tracing"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
@@ -22,7 +23,7 @@ func LoggingInterceptor(
 	requestId := ""
 	ok := false
 
-	requestIdList := md.Get("x-request-id")
+	requestIdList := md.Get(tracing.RequestIdKey)
 
 	if len(requestIdList) > 0 {
 		requestId = requestIdList[0]
@@ -34,12 +35,33 @@ func LoggingInterceptor(
 		requestId = uuid.NewString()
 	}
 
+	traceContext := tracing.TraceContext{}
+
+	if traceParentList := md.Get(tracing.TraceParentKey); len(traceParentList) > 0 {
+		traceParent, valid := tracing.ChildTraceParent(traceParentList[0])
+
+		if valid {
+			traceContext.TraceParent = traceParent
+		} else {
+			slog.WarnContext(ctx, fmt.Sprintf("Invalid traceparent %q provided so that a new trace will be started", traceParentList[0]))
+		}
+	}
+
+	// The tracestate of the caller is kept only along with a valid traceparent.
+	if traceContext.TraceParent == "" {
+		traceContext.TraceParent = tracing.NewTraceParent()
+	} else if traceStateList := md.Get(tracing.TraceStateKey); len(traceStateList) > 0 {
+		traceContext.TraceState = traceStateList[0]
+	}
+
 	attrs := []slog.Attr{
-		slog.String("x-request-id", requestId),
+		slog.String(tracing.RequestIdKey, requestId),
 		slog.String("endpoint", info.FullMethod),
 	}
 
 	ctx = log.AddToContext(ctx, attrs)
+	ctx = tracing.WithRequestId(ctx, requestId)
+	ctx = tracing.WithTraceContext(ctx, traceContext)
 
 	slog.InfoContext(ctx, fmt.Sprintf("%s endpoint called", info.FullMethod))
 
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/service"
+)
+
+type ArchiveJob struct {
+	archiver *service.Archiver
+	interval time.Duration
+}
+
+func NewArchiveJob(archiver *service.Archiver, interval time.Duration) *ArchiveJob {
+	return &ArchiveJob{archiver, interval}
+}
+
+func (j *ArchiveJob) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				j.Process(ctx)
+				time.Sleep(j.interval)
+			}
+		}
+	}()
+}
+
+func (j *ArchiveJob) Process(ctx context.Context) {
+	err := j.archiver.Archive(ctx)
+
+	if err != nil {
+		slog.Error(err.Error())
+	}
+}
@@ -10,10 +10,11 @@ import (
 
 type OutboxJob struct {
 	outboxService *service.OutboxService
+	interval      time.Duration
 }
 
-func NewOutboxJob(outboxService *service.OutboxService) *OutboxJob {
-	return &OutboxJob{outboxService}
+func NewOutboxJob(outboxService *service.OutboxService, interval time.Duration) *OutboxJob {
+	return &OutboxJob{outboxService, interval}
 }
 
 func (oj *OutboxJob) Start(ctx context.Context) {
@@ -24,7 +25,7 @@ func (oj *OutboxJob) Start(ctx context.Context) {
 				return
 			default:
 				oj.Process(ctx)
-				time.Sleep(time.Second * 5)
+				time.Sleep(oj.interval)
 			}
 		}
 	}()
@@ -36,4 +37,10 @@ func (oj *OutboxJob) Process(ctx context.Context) {
 	if err != nil {
 		slog.Error(err.Error())
 	}
+
+	err = oj.outboxService.ReportBacklog(ctx)
+
+	if err != nil {
+		slog.Error(err.Error())
+	}
 }
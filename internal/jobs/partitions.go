@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/service"
+)
+
+type PartitionMaintenanceJob struct {
+	partitionManager *service.PartitionManager
+	interval         time.Duration
+}
+
+func NewPartitionMaintenanceJob(partitionManager *service.PartitionManager, interval time.Duration) *PartitionMaintenanceJob {
+	return &PartitionMaintenanceJob{partitionManager, interval}
+}
+
+func (j *PartitionMaintenanceJob) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				j.Process(ctx)
+				time.Sleep(j.interval)
+			}
+		}
+	}()
+}
+
+func (j *PartitionMaintenanceJob) Process(ctx context.Context) {
+	err := j.partitionManager.Maintain(ctx)
+
+	if err != nil {
+		slog.Error(err.Error())
+	}
+}
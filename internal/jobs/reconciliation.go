@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/service"
+)
+
+type ReconciliationJob struct {
+	reconciler *service.Reconciler
+	interval   time.Duration
+}
+
+func NewReconciliationJob(reconciler *service.Reconciler, interval time.Duration) *ReconciliationJob {
+	return &ReconciliationJob{reconciler, interval}
+}
+
+func (j *ReconciliationJob) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				j.Process(ctx)
+				time.Sleep(j.interval)
+			}
+		}
+	}()
+}
+
+func (j *ReconciliationJob) Process(ctx context.Context) {
+	err := j.reconciler.Reconcile(ctx)
+
+	if err != nil {
+		slog.Error(err.Error())
+	}
+}
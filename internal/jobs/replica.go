@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/service"
+)
+
+type ReplicaMonitorJob struct {
+	replicaMonitor *service.ReplicaMonitor
+	interval       time.Duration
+}
+
+func NewReplicaMonitorJob(replicaMonitor *service.ReplicaMonitor, interval time.Duration) *ReplicaMonitorJob {
+	return &ReplicaMonitorJob{replicaMonitor, interval}
+}
+
+func (j *ReplicaMonitorJob) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				j.Process(ctx)
+				time.Sleep(j.interval)
+			}
+		}
+	}()
+}
+
+func (j *ReplicaMonitorJob) Process(ctx context.Context) {
+	err := j.replicaMonitor.Check(ctx)
+
+	if err != nil {
+		slog.Error(err.Error())
+	}
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/service"
+)
+
+type SagaReaperJob struct {
+	sagaReaper *service.SagaReaper
+	interval   time.Duration
+}
+
+func NewSagaReaperJob(sagaReaper *service.SagaReaper, interval time.Duration) *SagaReaperJob {
+	return &SagaReaperJob{sagaReaper, interval}
+}
+
+func (j *SagaReaperJob) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				j.Process(ctx)
+				time.Sleep(j.interval)
+			}
+		}
+	}()
+}
+
+func (j *SagaReaperJob) Process(ctx context.Context) {
+	err := j.sagaReaper.Reap(ctx)
+
+	if err != nil {
+		slog.Error(err.Error())
+	}
+}
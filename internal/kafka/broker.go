@@ -0,0 +1,174 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+)
+
+// IBroker creates the clients the service talks to Kafka with. Cluster connects to real brokers,
+// the memory package provides an in-process stand-in.
+type IBroker interface {
+	NewSyncProducer() (sarama.SyncProducer, error)
+	NewConsumerGroup(consumerConfig config.ConsumerConfig) (sarama.ConsumerGroup, error)
+	NewReader() (IReader, error)
+}
+
+// IReader reads partitions directly, bypassing consumer groups.
+type IReader interface {
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partition int32, time int64) (int64, error)
+	ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error)
+	Close() error
+}
+
+type Cluster struct {
+	cfg config.KafkaConfig
+}
+
+func NewCluster(cfg config.KafkaConfig) *Cluster {
+	return &Cluster{
+		cfg: cfg,
+	}
+}
+
+func (c *Cluster) NewSyncProducer() (sarama.SyncProducer, error) {
+	cfg, err := NewConfig(c.cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Producer.Return.Successes = true
+
+	return sarama.NewSyncProducer(c.cfg.Brokers, cfg)
+}
+
+func (c *Cluster) NewConsumerGroup(consumerConfig config.ConsumerConfig) (sarama.ConsumerGroup, error) {
+	cfg, err := newConsumerGroupConfig(c.cfg, consumerConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sarama.NewConsumerGroup(c.cfg.Brokers, consumerConfig.GroupId, cfg)
+}
+
+func (c *Cluster) NewReader() (IReader, error) {
+	cfg, err := NewConfig(c.cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient(c.cfg.Brokers, cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return &clusterReader{
+		client:   client,
+		consumer: consumer,
+	}, nil
+}
+
+type clusterReader struct {
+	client   sarama.Client
+	consumer sarama.Consumer
+}
+
+func (r *clusterReader) Partitions(topic string) ([]int32, error) {
+	return r.client.Partitions(topic)
+}
+
+func (r *clusterReader) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	return r.client.GetOffset(topic, partition, time)
+}
+
+func (r *clusterReader) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	return r.consumer.ConsumePartition(topic, partition, offset)
+}
+
+func (r *clusterReader) Close() error {
+	_ = r.consumer.Close()
+
+	return r.client.Close()
+}
+
+func newConsumerGroupConfig(kafkaConfig config.KafkaConfig, consumerConfig config.ConsumerConfig) (*sarama.Config, error) {
+	cfg, err := NewConfig(kafkaConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Consumer.Offsets.Initial, err = InitialOffset(consumerConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch consumerConfig.RebalanceStrategy {
+	case sarama.RangeBalanceStrategyName:
+		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRange()}
+	case sarama.RoundRobinBalanceStrategyName:
+		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	case "", sarama.StickyBalanceStrategyName:
+		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
+	case "cooperative-sticky":
+		return nil, fmt.Errorf("cooperative rebalancing is not supported by the Kafka client, use sticky instead")
+	default:
+		return nil, fmt.Errorf("unsupported rebalance strategy: %v", consumerConfig.RebalanceStrategy)
+	}
+
+	if consumerConfig.SessionTimeout > 0 {
+		cfg.Consumer.Group.Session.Timeout = consumerConfig.SessionTimeout
+	}
+
+	if consumerConfig.HeartbeatInterval > 0 {
+		cfg.Consumer.Group.Heartbeat.Interval = consumerConfig.HeartbeatInterval
+	}
+
+	if consumerConfig.MaxProcessingTime > 0 {
+		cfg.Consumer.MaxProcessingTime = consumerConfig.MaxProcessingTime
+	}
+
+	if consumerConfig.Fetch.MinBytes > 0 {
+		cfg.Consumer.Fetch.Min = consumerConfig.Fetch.MinBytes
+	}
+
+	if consumerConfig.Fetch.DefaultBytes > 0 {
+		cfg.Consumer.Fetch.Default = consumerConfig.Fetch.DefaultBytes
+	}
+
+	cfg.Consumer.Fetch.Max = consumerConfig.Fetch.MaxBytes
+
+	err = cfg.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// InitialOffset returns the offset a consumer group starts from when it has no committed offset.
+func InitialOffset(consumerConfig config.ConsumerConfig) (int64, error) {
+	switch consumerConfig.InitialOffset {
+	case "", "oldest":
+		return sarama.OffsetOldest, nil
+	case "newest":
+		return sarama.OffsetNewest, nil
+	default:
+		return 0, fmt.Errorf("unsupported initial offset: %v", consumerConfig.InitialOffset)
+	}
+}
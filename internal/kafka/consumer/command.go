@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+// ErrMalformedCommand marks commands that can never be handled, so that they are moved to the
+// dead-letter topic without retries. Other errors are considered transient.
+var ErrMalformedCommand = errors.New("malformed command")
+
+// currentVersion is the version of command schemas this consumer understands. Commands
+// without a version are treated as version 1 which was published before versioning was introduced.
+const currentVersion = 1
+
+type MessageCommand string
+
+const (
+	MessageCommandCommitMessage   MessageCommand = "CommitMessage"
+	MessageCommandRollbackMessage MessageCommand = "RollbackMessage"
+)
+
+type Message struct {
+	CorrelationId string          `json:"correlationId"`
+	Command       MessageCommand  `json:"command"`
+	Version       int             `json:"version"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+type CommitMessagePayload struct {
+	MessageId int64 `json:"messageId"`
+}
+
+type RollbackMessagePayload struct {
+	MessageId int64 `json:"messageId"`
+}
+
+func IsMalformed(err error) bool {
+	return errors.Is(err, ErrMalformedCommand)
+}
+
+func malformed(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrMalformedCommand, fmt.Sprintf(format, args...))
+}
+
+// DecodeCommand parses and validates a dialogue command and maps it to one of the model commands
+// without handling it. Every error returned is ErrMalformedCommand.
+func DecodeCommand(msg []byte) (any, error) {
+	message := Message{}
+	err := json.Unmarshal(msg, &message)
+
+	if err != nil {
+		return nil, malformed("invalid envelope: %v", err)
+	}
+
+	err = message.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch message.Command {
+	case MessageCommandCommitMessage:
+		return decodeCommitMessage(message)
+	case MessageCommandRollbackMessage:
+		return decodeRollbackMessage(message)
+	default:
+		return nil, malformed("unknown command: %v", message.Command)
+	}
+}
+
+func (m Message) validate() error {
+	if m.CorrelationId == "" {
+		return malformed("correlationId is required")
+	}
+
+	if m.Command == "" {
+		return malformed("command is required")
+	}
+
+	if m.Version < 0 || m.Version > currentVersion {
+		return malformed("unsupported version %v of %v command", m.Version, m.Command)
+	}
+
+	if len(m.Payload) == 0 || bytes.Equal(m.Payload, []byte("null")) {
+		return malformed("payload is required")
+	}
+
+	return nil
+}
+
+func decodeCommitMessage(msg Message) (model.CommitMessageCommand, error) {
+	payload := CommitMessagePayload{}
+	err := decodePayload(msg, &payload)
+
+	if err != nil {
+		return model.CommitMessageCommand{}, err
+	}
+
+	if payload.MessageId <= 0 {
+		return model.CommitMessageCommand{}, malformed("messageId is required in %v payload", msg.Command)
+	}
+
+	cmd := model.CommitMessageCommand{
+		CorrelationId: msg.CorrelationId,
+		MessageId:     model.MessageId(payload.MessageId),
+	}
+
+	return cmd, nil
+}
+
+func decodeRollbackMessage(msg Message) (model.RollbackMessageCommand, error) {
+	payload := RollbackMessagePayload{}
+	err := decodePayload(msg, &payload)
+
+	if err != nil {
+		return model.RollbackMessageCommand{}, err
+	}
+
+	if payload.MessageId <= 0 {
+		return model.RollbackMessageCommand{}, malformed("messageId is required in %v payload", msg.Command)
+	}
+
+	cmd := model.RollbackMessageCommand{
+		CorrelationId: msg.CorrelationId,
+		MessageId:     model.MessageId(payload.MessageId),
+	}
+
+	return cmd, nil
+}
+
+// decodePayload ignores fields unknown to the version of the payload schema, so that producers can
+// add fields without bumping the version. Required fields are checked by the callers.
+func decodePayload(msg Message, payload any) error {
+	err := json.Unmarshal(msg.Payload, payload)
+
+	if err != nil {
+		return malformed("invalid %v payload: %v", msg.Command, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDecodeCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       string
+		want      any
+		malformed bool
+	}{
+		{
+			name: "commit",
+			msg:  `{"correlationId":"c1","command":"CommitMessage","version":1,"payload":{"messageId":7}}`,
+			want: model.CommitMessageCommand{CorrelationId: "c1", MessageId: 7},
+		},
+		{
+			name: "rollback",
+			msg:  `{"correlationId":"c1","command":"RollbackMessage","version":1,"payload":{"messageId":7}}`,
+			want: model.RollbackMessageCommand{CorrelationId: "c1", MessageId: 7},
+		},
+		{
+			name: "command without version",
+			msg:  `{"correlationId":"c1","command":"CommitMessage","payload":{"messageId":7}}`,
+			want: model.CommitMessageCommand{CorrelationId: "c1", MessageId: 7},
+		},
+		{name: "not JSON", msg: `commit 7`, malformed: true},
+		{name: "envelope of wrong type", msg: `["CommitMessage"]`, malformed: true},
+		{
+			name:      "unknown command",
+			msg:       `{"correlationId":"c1","command":"DeleteMessage","version":1,"payload":{"messageId":7}}`,
+			malformed: true,
+		},
+		{
+			name:      "missing correlation ID",
+			msg:       `{"command":"CommitMessage","version":1,"payload":{"messageId":7}}`,
+			malformed: true,
+		},
+		{
+			name:      "missing command",
+			msg:       `{"correlationId":"c1","version":1,"payload":{"messageId":7}}`,
+			malformed: true,
+		},
+		{
+			name:      "unsupported version",
+			msg:       `{"correlationId":"c1","command":"CommitMessage","version":2,"payload":{"messageId":7}}`,
+			malformed: true,
+		},
+		{name: "missing payload", msg: `{"correlationId":"c1","command":"CommitMessage","version":1}`, malformed: true},
+		{
+			name:      "null payload",
+			msg:       `{"correlationId":"c1","command":"CommitMessage","version":1,"payload":null}`,
+			malformed: true,
+		},
+		{
+			name:      "missing message ID",
+			msg:       `{"correlationId":"c1","command":"RollbackMessage","version":1,"payload":{}}`,
+			malformed: true,
+		},
+		{
+			name:      "message ID of wrong type",
+			msg:       `{"correlationId":"c1","command":"CommitMessage","version":1,"payload":{"messageId":"7"}}`,
+			malformed: true,
+		},
+		{
+			name: "unknown payload field",
+			msg:  `{"correlationId":"c1","command":"CommitMessage","version":1,"payload":{"messageId":7,"chatId":"a_b"}}`,
+			want: model.CommitMessageCommand{CorrelationId: "c1", MessageId: 7},
+		},
+		{
+			name: "unknown envelope field",
+			msg:  `{"correlationId":"c1","command":"RollbackMessage","version":1,"source":"counter","payload":{"messageId":7}}`,
+			want: model.RollbackMessageCommand{CorrelationId: "c1", MessageId: 7},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd, err := DecodeCommand([]byte(test.msg))
+
+			if test.malformed {
+				if !IsMalformed(err) {
+					t.Fatalf("got error %v, want a malformed command error", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cmd != test.want {
+				t.Errorf("got command %#v, want %#v", cmd, test.want)
+			}
+		})
+	}
+}
+
+func TestHandleWithRetries_RoutesFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		msg        string
+		errorClass string
+		attempts   int
+		command    string
+		outcome    string
+	}{
+		{
+			name:       "malformed command without retries",
+			msg:        `{"correlationId":"c1","command":"DeleteMessage","version":1,"payload":{"messageId":1}}`,
+			errorClass: errorClassMalformed,
+			attempts:   1,
+			command:    "unknown",
+			outcome:    outcomeMalformed,
+		},
+		{
+			name:       "missing message after retries",
+			msg:        commandJson("CommitMessage", 1000),
+			errorClass: errorClassTransient,
+			attempts:   3,
+			command:    string(MessageCommandCommitMessage),
+			outcome:    outcomeDeadLetter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := memory.NewStore()
+			deadLetterProducer := &fakeDeadLetterProducer{}
+
+			consumer := NewDialogueCommandConsumer(
+				newAppService(store, memory.NewTransactionManager(store)),
+				deadLetterProducer,
+				config.ConsumerConfig{
+					Retry: config.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+				})
+
+			msg := &sarama.ConsumerMessage{Offset: 5, Value: []byte(test.msg)}
+
+			deadLetters := metrics.ConsumerDeadLetters.WithLabelValues(test.command)
+			handled := metrics.ConsumerCommandsHandled.WithLabelValues(test.command, test.outcome)
+			deadLettersBefore, handledBefore := testutil.ToFloat64(deadLetters), testutil.ToFloat64(handled)
+
+			err := consumer.handleWithRetries(context.Background(), decodeClaimed(msg))
+
+			if err != nil {
+				t.Fatalf("the message must be marked as consumed, got error %v", err)
+			}
+
+			if len(deadLetterProducer.deadLetters) != 1 {
+				t.Fatalf("got %v dead letters, want 1", len(deadLetterProducer.deadLetters))
+			}
+
+			deadLetter := deadLetterProducer.deadLetters[0]
+
+			if deadLetter.msg != msg || deadLetter.errorClass != test.errorClass || deadLetter.attempts != test.attempts {
+				t.Errorf("got dead letter of offset %v with class %v after %v attempts, want offset %v, class %v, %v attempts",
+					deadLetter.msg.Offset, deadLetter.errorClass, deadLetter.attempts, msg.Offset, test.errorClass, test.attempts)
+			}
+
+			if got := testutil.ToFloat64(deadLetters) - deadLettersBefore; got != 1 {
+				t.Errorf("dead letters of %v counted %v times, want once", test.command, got)
+			}
+
+			if got := testutil.ToFloat64(handled) - handledBefore; got != 1 {
+				t.Errorf("%v outcome of %v counted %v times, want once", test.outcome, test.command, got)
+			}
+		})
+	}
+}
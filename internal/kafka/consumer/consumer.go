@@ -1,47 +1,63 @@
 package consumer
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/IBM/sarama"
 	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka"
+	"github.com/orochi-keydream/dialogue-service/internal/log"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
 	"github.com/orochi-keydream/dialogue-service/internal/model"
 	"github.com/orochi-keydream/dialogue-service/internal/service"
 	"golang.org/x/net/context"
-	"log"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// RunDialogueCommandConsumer joins the consumer group and consumes dialogue commands in background
+// until ctx is cancelled. Errors preventing the consumer from starting are returned.
 func RunDialogueCommandConsumer(
 	ctx context.Context,
-	config config.KafkaConfig,
+	broker kafka.IBroker,
+	consumerConfig config.ConsumerConfig,
 	c *DialogueCommandConsumer,
 	wg *sync.WaitGroup,
 ) error {
-	cfg := sarama.NewConfig()
-	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
-
-	cg, err := sarama.NewConsumerGroup(config.Brokers, "dialogue-service", cfg)
+	cg, err := broker.NewConsumerGroup(consumerConfig)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	topics := []string{config.Consumers.DialogueCommands.Topic}
+	topics := []string{consumerConfig.Topic}
+
+	wg.Add(1)
 
 	go func() {
 		defer wg.Done()
 
+		defer func() {
+			_ = cg.Close()
+		}()
+
 		for {
-			err = cg.Consume(ctx, topics, c)
+			err := cg.Consume(ctx, topics, c)
 
 			if err != nil {
 				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
 					return
 				}
 
-				log.Panicln(err)
+				slog.ErrorContext(ctx, fmt.Sprintf("Consumer group session failed: %v", err))
+
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+				}
 			}
 
 			if ctx.Err() != nil {
@@ -53,15 +69,52 @@ func RunDialogueCommandConsumer(
 	return nil
 }
 
+type IDeadLetterProducer interface {
+	SendMessage(original *sarama.ConsumerMessage, cause error, errorClass string, attempts int) error
+}
+
+const workerQueueSize = 16
+
+const (
+	outcomeSuccess    = "success"
+	outcomeDeadLetter = "dead_letter"
+	outcomeMalformed  = "malformed"
+
+	errorClassTransient = "transient"
+	errorClassMalformed = "malformed"
+)
+
 type DialogueCommandConsumer struct {
-	appService *service.AppService
+	appService         *service.AppService
+	deadLetterProducer IDeadLetterProducer
+	retry              config.RetryConfig
+	workers            int
+	batchSize          int
+	batchLinger        time.Duration
 }
 
-func NewDialogueCommandConsumer(appService *service.AppService) *DialogueCommandConsumer {
-	return &DialogueCommandConsumer{appService: appService}
+func NewDialogueCommandConsumer(
+	appService *service.AppService,
+	deadLetterProducer IDeadLetterProducer,
+	cfg config.ConsumerConfig,
+) *DialogueCommandConsumer {
+	return &DialogueCommandConsumer{
+		appService:         appService,
+		deadLetterProducer: deadLetterProducer,
+		retry:              cfg.Retry,
+		workers:            cfg.Workers,
+		batchSize:          cfg.BatchSize,
+		batchLinger:        cfg.BatchLinger,
+	}
 }
 
 func (c *DialogueCommandConsumer) Setup(session sarama.ConsumerGroupSession) error {
+	metrics.ConsumerRebalances.Inc()
+
+	slog.InfoContext(
+		session.Context(),
+		fmt.Sprintf("Consumer group session %v started with claims %v", session.GenerationID(), session.Claims()))
+
 	return nil
 }
 
@@ -69,100 +122,475 @@ func (c *DialogueCommandConsumer) Cleanup(session sarama.ConsumerGroupSession) e
 	return nil
 }
 
+// claimedCommand is a message of the claim along with the command decoded from it.
+type claimedCommand struct {
+	msg       *sarama.ConsumerMessage
+	cmd       any
+	decodeErr error
+}
+
+// decodeClaimed decodes the command of the message once, so that it is not decoded again on retries.
+func decodeClaimed(msg *sarama.ConsumerMessage) *claimedCommand {
+	cmd, err := DecodeCommand(msg.Value)
+
+	return &claimedCommand{
+		msg:       msg,
+		cmd:       cmd,
+		decodeErr: err,
+	}
+}
+
+// ConsumeClaim collects messages of the claim into micro-batches and handles them concurrently.
+// Messages with the same ordering key are handled by the same worker in order, and offsets are
+// marked only up to the first message that is still being handled. Once the claim ends, e.g. the
+// partition is revoked, the workers are cancelled and the messages left unmarked are consumed again
+// by the next owner of the partition.
 func (c *DialogueCommandConsumer) ConsumeClaim(cgs sarama.ConsumerGroupSession, cgc sarama.ConsumerGroupClaim) error {
+	ctx, cancel := context.WithCancel(cgs.Context())
+	defer cancel()
+
+	ctx = log.AddToContext(ctx, []slog.Attr{
+		slog.String("topic", cgc.Topic()),
+		slog.Int("partition", int(cgc.Partition())),
+	})
+
+	tracker := newOffsetTracker()
+	errCh := make(chan error, 1)
+
+	mark := func(msg *sarama.ConsumerMessage) {
+		cgs.MarkMessage(msg, "")
+	}
+
+	complete := func(msg *sarama.ConsumerMessage) {
+		tracker.complete(msg, mark)
+		reportLag(cgc, tracker)
+	}
+
+	wg := &sync.WaitGroup{}
+	queues := make([]chan []*claimedCommand, max(c.workers, 1))
+
+	for i := range queues {
+		queue := make(chan []*claimedCommand, workerQueueSize)
+		queues[i] = queue
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for batch := range queue {
+				// Once the claim is cancelled the rest of the messages is left unmarked to be consumed again.
+				if ctx.Err() != nil {
+					continue
+				}
+
+				err := c.handleBatch(ctx, batch, complete)
+
+				if err != nil {
+					select {
+					case errCh <- err:
+					default:
+					}
+
+					cancel()
+				}
+			}
+		}()
+	}
+
+	defer func() {
+		cancel()
+
+		for _, queue := range queues {
+			close(queue)
+		}
+
+		wg.Wait()
+	}()
+
 	for {
 		select {
 		case msg, ok := <-cgc.Messages():
 			if !ok {
-				log.Println("Message channel was closed")
+				slog.InfoContext(ctx, "Message channel was closed")
 				return nil
 			}
 
-			log.Printf("Handling message with offset %v from %v topic\n", msg.Offset, msg.Topic)
+			batch, open := c.collectBatch(ctx, msg, cgc.Messages())
 
-			err := c.handle(cgs.Context(), msg.Value)
+			if !open {
+				slog.InfoContext(ctx, "Message channel was closed")
+				return nil
+			}
 
-			if err != nil {
-				log.Println(err)
-				continue
+			c.dispatch(ctx, batch, queues, tracker)
+			reportLag(cgc, tracker)
+		case <-ctx.Done():
+			select {
+			case err := <-errCh:
+				// The session is over, unmarked messages will be consumed again after the rebalance.
+				return err
+			default:
+				slog.InfoContext(ctx, "ConsumeClaim: cancellation requested")
+				return nil
 			}
+		}
+	}
+}
 
-			cgs.MarkMessage(msg, "")
-		case <-cgs.Context().Done():
-			log.Println("ConsumeClaim: cancellation requested")
-			return nil
+// collectBatch waits for more messages after the first one until the batch is full or the linger
+// time is over. It reports false if the message channel has been closed.
+func (c *DialogueCommandConsumer) collectBatch(
+	ctx context.Context,
+	first *sarama.ConsumerMessage,
+	messages <-chan *sarama.ConsumerMessage,
+) ([]*sarama.ConsumerMessage, bool) {
+	batch := []*sarama.ConsumerMessage{first}
+
+	if c.batchSize <= 1 || c.batchLinger <= 0 {
+		return batch, true
+	}
+
+	timer := time.NewTimer(c.batchLinger)
+	defer timer.Stop()
+
+	for len(batch) < c.batchSize {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return batch, false
+			}
+
+			batch = append(batch, msg)
+		case <-timer.C:
+			return batch, true
+		case <-ctx.Done():
+			return batch, true
 		}
 	}
+
+	return batch, true
 }
 
-func (c *DialogueCommandConsumer) handle(ctx context.Context, msg []byte) error {
-	message := Message{}
-	err := json.Unmarshal(msg, &message)
+// dispatch splits the batch between workers by the ordering key of each message.
+func (c *DialogueCommandConsumer) dispatch(
+	ctx context.Context,
+	batch []*sarama.ConsumerMessage,
+	queues []chan []*claimedCommand,
+	tracker *offsetTracker,
+) {
+	parts := make(map[int][]*claimedCommand)
 
-	if err != nil {
-		return err
+	for _, msg := range batch {
+		slog.InfoContext(withMessage(ctx, msg), fmt.Sprintf("Handling message with offset %v", msg.Offset))
+
+		claimed := decodeClaimed(msg)
+
+		tracker.add(msg)
+
+		index := workerIndex(orderingKey(claimed), len(queues))
+		parts[index] = append(parts[index], claimed)
+	}
+
+	for index, part := range parts {
+		select {
+		case queues[index] <- part:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// orderingKey returns the ID of the message the command refers to, so that commands for the same
+// message are handled in order. Undecodable commands fall back to the record key.
+func orderingKey(claimed *claimedCommand) string {
+	if id, ok := messageIdOf(claimed.cmd); ok {
+		return strconv.FormatInt(int64(id), 10)
+	}
+
+	return string(claimed.msg.Key)
+}
+
+func messageIdOf(cmd any) (model.MessageId, bool) {
+	switch cmd := cmd.(type) {
+	case model.CommitMessageCommand:
+		return cmd.MessageId, true
+	case model.RollbackMessageCommand:
+		return cmd.MessageId, true
+	default:
+		return 0, false
 	}
+}
 
-	switch message.Command {
-	case MessageCommandCommitMessage:
-		return c.handleCommitMessage(ctx, message)
-	case MessageCommandRollbackMessage:
-		return c.handleRollbackMessage(ctx, message)
+func commandName(cmd any) string {
+	switch cmd.(type) {
+	case model.CommitMessageCommand:
+		return string(MessageCommandCommitMessage)
+	case model.RollbackMessageCommand:
+		return string(MessageCommandRollbackMessage)
 	default:
-		return fmt.Errorf("unknown command: %v", message.Command)
+		return "unknown"
 	}
+}
 
+func withMessage(ctx context.Context, msg *sarama.ConsumerMessage) context.Context {
+	return log.AddToContext(ctx, []slog.Attr{
+		slog.Int64("offset", msg.Offset),
+	})
 }
 
-func (c *DialogueCommandConsumer) handleCommitMessage(ctx context.Context, msg Message) error {
-	payload := CommitMessagePayload{}
-	err := json.Unmarshal(msg.Payload, &payload)
+// reportLag reports the number of messages from the first one not completed yet to the end of the
+// partition, so that messages queued for the workers count as lag until they are handled.
+func reportLag(cgc sarama.ConsumerGroupClaim, tracker *offsetTracker) {
+	position, ok := tracker.position()
 
-	if err != nil {
-		return err
+	if !ok {
+		return
+	}
+
+	lag := max(cgc.HighWaterMarkOffset()-position, 0)
+
+	metrics.ConsumerLag.
+		WithLabelValues(cgc.Topic(), strconv.Itoa(int(cgc.Partition()))).
+		Set(float64(lag))
+}
+
+func workerIndex(key string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(workers))
+}
+
+// handleBatch applies the commands in runs that do not touch the same message twice, so that
+// commands for a message are applied in the order they were received. Undecodable messages are
+// handled one by one to end up in the dead-letter topic.
+func (c *DialogueCommandConsumer) handleBatch(
+	ctx context.Context,
+	batch []*claimedCommand,
+	complete func(msg *sarama.ConsumerMessage),
+) error {
+	run := make([]*claimedCommand, 0, len(batch))
+	seen := make(map[model.MessageId]struct{}, len(batch))
+
+	flush := func() error {
+		if len(run) == 0 {
+			return nil
+		}
+
+		err := c.handleRun(ctx, run)
+
+		if err != nil {
+			return err
+		}
+
+		for _, claimed := range run {
+			complete(claimed.msg)
+		}
+
+		run = run[:0]
+		clear(seen)
+
+		return nil
 	}
 
-	cmd := model.CommitMessageCommand{
-		CorrelationId: msg.CorrelationId,
-		MessageId:     model.MessageId(payload.MessageId),
+	for _, claimed := range batch {
+		id, ok := messageIdOf(claimed.cmd)
+
+		if claimed.decodeErr != nil || !ok {
+			err := flush()
+
+			if err != nil {
+				return err
+			}
+
+			err = c.handleWithRetries(ctx, claimed)
+
+			if err != nil {
+				return err
+			}
+
+			complete(claimed.msg)
+			continue
+		}
+
+		if _, ok := seen[id]; ok {
+			err := flush()
+
+			if err != nil {
+				return err
+			}
+		}
+
+		run = append(run, claimed)
+		seen[id] = struct{}{}
 	}
 
-	return c.appService.CommitMessage(ctx, cmd)
+	return flush()
 }
 
-func (c *DialogueCommandConsumer) handleRollbackMessage(ctx context.Context, msg Message) error {
-	payload := RollbackMessagePayload{}
-	err := json.Unmarshal(msg.Payload, &payload)
+// handleRun applies the commands in a single transaction. If it fails, the commands are handled one by
+// one right away, so that the retries are spent on each command only once and only the failing ones are
+// moved to the dead-letter topic.
+func (c *DialogueCommandConsumer) handleRun(ctx context.Context, run []*claimedCommand) error {
+	batch := model.CommandBatch{}
+
+	for _, claimed := range run {
+		switch cmd := claimed.cmd.(type) {
+		case model.CommitMessageCommand:
+			batch.Commits = append(batch.Commits, cmd)
+		case model.RollbackMessageCommand:
+			batch.Rollbacks = append(batch.Rollbacks, cmd)
+		}
+	}
 
-	if err != nil {
-		return err
+	ctx = log.AddToContext(ctx, []slog.Attr{
+		slog.Int64("first_offset", run[0].msg.Offset),
+		slog.Int64("last_offset", run[len(run)-1].msg.Offset),
+	})
+
+	start := time.Now()
+
+	err := c.appService.HandleCommands(ctx, batch)
+
+	metrics.ConsumerHandleDuration.WithLabelValues("batch").Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		for _, claimed := range run {
+			metrics.ConsumerCommandsHandled.WithLabelValues(commandName(claimed.cmd), outcomeSuccess).Inc()
+		}
+
+		return nil
 	}
 
-	cmd := model.RollbackMessageCommand{
-		CorrelationId: msg.CorrelationId,
-		MessageId:     model.MessageId(payload.MessageId),
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	slog.WarnContext(ctx, fmt.Sprintf("Failed to handle batch of %v commands, handling them one by one: %v", len(run), err))
+
+	for _, claimed := range run {
+		err = c.handleWithRetries(ctx, claimed)
+
+		if err != nil {
+			return err
+		}
 	}
 
-	return c.appService.RollbackMessage(ctx, cmd)
+	return nil
 }
 
-type MessageCommand string
+// handleWithRetries handles the message retrying transient failures with exponential backoff. When
+// all attempts fail or the command is malformed, the message is moved to the dead-letter topic so
+// that the partition can progress.
+// An error is returned only if the message must not be marked as consumed.
+func (c *DialogueCommandConsumer) handleWithRetries(ctx context.Context, claimed *claimedCommand) error {
+	msg := claimed.msg
+	ctx = withMessage(ctx, msg)
 
-const (
-	MessageCommandCommitMessage   MessageCommand = "CommitMessage"
-	MessageCommandRollbackMessage MessageCommand = "RollbackMessage"
-)
+	command := commandName(claimed.cmd)
+
+	start := time.Now()
+
+	attempts, err := 1, claimed.decodeErr
+
+	if err == nil {
+		attempts, err = c.retryWithBackoff(ctx, func() error {
+			return c.handle(ctx, claimed.cmd)
+		})
+	}
+
+	metrics.ConsumerHandleDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		metrics.ConsumerCommandsHandled.WithLabelValues(command, outcomeSuccess).Inc()
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 
-type Message struct {
-	CorrelationId string          `json:"correlationId"`
-	Command       MessageCommand  `json:"command"`
-	Payload       json.RawMessage `json:"payload"`
+	errorClass := errorClassTransient
+	outcome := outcomeDeadLetter
+
+	if IsMalformed(err) {
+		errorClass = errorClassMalformed
+		outcome = outcomeMalformed
+	}
+
+	dlqErr := c.deadLetterProducer.SendMessage(msg, err, errorClass, attempts)
+
+	if dlqErr != nil {
+		return fmt.Errorf("failed to move message with offset %v to dead-letter topic: %w", msg.Offset, dlqErr)
+	}
+
+	metrics.ConsumerCommandsHandled.WithLabelValues(command, outcome).Inc()
+	metrics.ConsumerDeadLetters.WithLabelValues(command).Inc()
+
+	slog.ErrorContext(ctx, fmt.Sprintf("Message with offset %v moved to dead-letter topic: %v", msg.Offset, err))
+
+	return nil
 }
 
-type CommitMessagePayload struct {
-	MessageId int64 `json:"messageId"`
+// retryWithBackoff calls fn until it succeeds, fails with a malformed command error or the attempts
+// are over and returns the number of attempts made along with the last error.
+func (c *DialogueCommandConsumer) retryWithBackoff(ctx context.Context, fn func() error) (int, error) {
+	maxAttempts := max(c.retry.MaxAttempts, 1)
+	backoff := c.retry.InitialBackoff
+
+	var err error
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = fn()
+
+		if err == nil {
+			return attempt, nil
+		}
+
+		if IsMalformed(err) {
+			return attempt, err
+		}
+
+		slog.WarnContext(ctx, fmt.Sprintf("Attempt %v of %v failed: %v", attempt, maxAttempts, err))
+
+		if attempt == maxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		}
+
+		backoff = min(backoff*2, c.retry.MaxBackoff)
+	}
+
+	return maxAttempts, err
+}
+
+func (c *DialogueCommandConsumer) handle(ctx context.Context, cmd any) error {
+	switch cmd := cmd.(type) {
+	case model.CommitMessageCommand:
+		return c.appService.CommitMessage(ctx, cmd)
+	case model.RollbackMessageCommand:
+		return c.appService.RollbackMessage(ctx, cmd)
+	default:
+		return fmt.Errorf("unsupported command: %T", cmd)
+	}
 }
 
-type RollbackMessagePayload struct {
-	MessageId int64 `json:"messageId"`
+// DryRun handles the command the same way the consumer does it in a transaction that is rolled back
+// and returns the error the handling would end with.
+func (c *DialogueCommandConsumer) DryRun(ctx context.Context, msg []byte) error {
+	cmd, err := DecodeCommand(msg)
+
+	if err != nil {
+		return err
+	}
+
+	return c.appService.DryRun(ctx, func(ctx context.Context) error {
+		return c.handle(ctx, cmd)
+	})
 }
@@ -0,0 +1,384 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/fixture"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+	"github.com/orochi-keydream/dialogue-service/internal/service"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConsumeClaim_HandlesCommandsForMessageInOrder(t *testing.T) {
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	appService := newAppService(store, memory.NewTransactionManager(store))
+	deadLetterProducer := &fakeDeadLetterProducer{}
+
+	consumer := NewDialogueCommandConsumer(appService, deadLetterProducer, config.ConsumerConfig{
+		Workers:     4,
+		BatchSize:   8,
+		BatchLinger: time.Millisecond,
+		Retry:       config.RetryConfig{MaxAttempts: 1},
+	})
+
+	const count = 40
+
+	ids := make([]model.MessageId, count)
+
+	for i := range ids {
+		ids[i] = fixture.AddPendingMessage(t, dialogueRepository)
+	}
+
+	session := newFakeSession(context.Background())
+	claim := newFakeClaim(2 * count)
+
+	commits := metrics.ConsumerCommandsHandled.WithLabelValues(string(MessageCommandCommitMessage), outcomeSuccess)
+	commitsBefore := testutil.ToFloat64(commits)
+
+	// A rollback handled before the commit of the same message would remove the message.
+	for i, id := range ids {
+		claim.send(2*i, commandJson("CommitMessage", id))
+		claim.send(2*i+1, commandJson("RollbackMessage", id))
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- consumer.ConsumeClaim(session, claim)
+	}()
+
+	session.waitMarked(t, 2*count-1)
+	close(claim.messages)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deadLetterProducer.deadLetters) != 0 {
+		t.Errorf("%v commands moved to the dead-letter topic", len(deadLetterProducer.deadLetters))
+	}
+
+	if got := testutil.ToFloat64(commits) - commitsBefore; got != count {
+		t.Errorf("%v commits counted as handled, want %v", got, count)
+	}
+
+	for _, id := range ids {
+		msg, err := dialogueRepository.GetMessage(context.Background(), id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.State != model.MessageStateSent {
+			t.Errorf("message %v is %v, want it committed before the rollback is rejected", id, msg.State)
+		}
+	}
+}
+
+func TestSetup_CountsRebalances(t *testing.T) {
+	consumer := NewDialogueCommandConsumer(nil, &fakeDeadLetterProducer{}, config.ConsumerConfig{})
+	before := testutil.ToFloat64(metrics.ConsumerRebalances)
+
+	err := consumer.Setup(newFakeSession(context.Background()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(metrics.ConsumerRebalances) - before; got != 1 {
+		t.Errorf("got %v rebalances counted, want 1", got)
+	}
+}
+
+func TestConsumeClaim_StopsHandlingOnceClaimEnds(t *testing.T) {
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	transactionManager := &gatedTransactionManager{
+		tm:      memory.NewTransactionManager(store),
+		entered: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+
+	consumer := NewDialogueCommandConsumer(newAppService(store, transactionManager), &fakeDeadLetterProducer{}, config.ConsumerConfig{
+		Workers:   1,
+		BatchSize: 1,
+		Retry:     config.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second},
+	})
+
+	first := fixture.AddPendingMessage(t, dialogueRepository)
+	second := fixture.AddPendingMessage(t, dialogueRepository)
+
+	session := newFakeSession(context.Background())
+	claim := newFakeClaim(0)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- consumer.ConsumeClaim(session, claim)
+	}()
+
+	claim.send(0, commandJson("CommitMessage", first))
+	<-transactionManager.entered
+
+	// The worker is busy, so the second command waits in its queue when the partition is revoked.
+	claim.send(1, commandJson("CommitMessage", second))
+	close(claim.messages)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ConsumeClaim did not return after the claim ended")
+	}
+
+	if len(transactionManager.entered) != 0 {
+		t.Errorf("commands were handled after the claim ended")
+	}
+
+	if marked := session.marked(); len(marked) != 0 {
+		t.Errorf("offsets %v marked, want none", marked)
+	}
+
+	for _, id := range []model.MessageId{first, second} {
+		msg, err := dialogueRepository.GetMessage(context.Background(), id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.State != model.MessageStatePending {
+			t.Errorf("message %v is %v, want it left pending", id, msg.State)
+		}
+	}
+}
+
+func newAppService(store *memory.Store, transactionManager service.ITransactionManager) *service.AppService {
+	return service.NewAppService(
+		memory.NewDialogueRepository(store),
+		memory.NewOutboxRepository(store),
+		memory.NewCommandRepository(store),
+		memory.NewUnreadRepository(store),
+		nil,
+		transactionManager,
+		nil)
+}
+
+func commandJson(command string, id model.MessageId) string {
+	return fmt.Sprintf(
+		`{"correlationId":"%v-%v","command":"%v","version":1,"payload":{"messageId":%v}}`,
+		command,
+		id,
+		command,
+		id)
+}
+
+type fakeSession struct {
+	ctx context.Context
+
+	mu      sync.Mutex
+	offsets []int64
+}
+
+func newFakeSession(ctx context.Context) *fakeSession {
+	return &fakeSession{ctx: ctx}
+}
+
+func (s *fakeSession) Claims() map[string][]int32 { return nil }
+
+func (s *fakeSession) MemberID() string { return "member" }
+
+func (s *fakeSession) GenerationID() int32 { return 1 }
+
+func (s *fakeSession) MarkOffset(string, int32, int64, string) {}
+
+func (s *fakeSession) Commit() {}
+
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offsets = append(s.offsets, msg.Offset)
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) marked() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int64(nil), s.offsets...)
+}
+
+func (s *fakeSession) waitMarked(t *testing.T, offset int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		marked := s.marked()
+
+		if len(marked) > 0 && marked[len(marked)-1] == offset {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("offset %v was not marked, marked %v", offset, s.marked())
+}
+
+type fakeClaim struct {
+	messages      chan *sarama.ConsumerMessage
+	highWaterMark int64
+}
+
+func newFakeClaim(buffer int) *fakeClaim {
+	return &fakeClaim{messages: make(chan *sarama.ConsumerMessage, buffer)}
+}
+
+func (c *fakeClaim) send(offset int, value string) {
+	c.messages <- &sarama.ConsumerMessage{
+		Topic:     "dialogue_commands",
+		Partition: 0,
+		Offset:    int64(offset),
+		Value:     []byte(value),
+	}
+}
+
+func (c *fakeClaim) Topic() string { return "dialogue_commands" }
+
+func (c *fakeClaim) Partition() int32 { return 0 }
+
+func (c *fakeClaim) InitialOffset() int64 { return 0 }
+
+func (c *fakeClaim) HighWaterMarkOffset() int64 { return c.highWaterMark }
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+type deadLetter struct {
+	msg        *sarama.ConsumerMessage
+	errorClass string
+	attempts   int
+}
+
+type fakeDeadLetterProducer struct {
+	mu          sync.Mutex
+	deadLetters []deadLetter
+}
+
+func (p *fakeDeadLetterProducer) SendMessage(original *sarama.ConsumerMessage, _ error, errorClass string, attempts int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deadLetters = append(p.deadLetters, deadLetter{msg: original, errorClass: errorClass, attempts: attempts})
+
+	return nil
+}
+
+// gatedTransactionManager holds every transaction until it is released or the context is cancelled.
+type gatedTransactionManager struct {
+	tm      service.ITransactionManager
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (tm *gatedTransactionManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	tm.entered <- struct{}{}
+
+	select {
+	case <-tm.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return tm.tm.WithinTransaction(ctx, fn)
+}
+
+func TestHandleBatch_FailedBatchFallsBackToSingleCommandsWithoutRetries(t *testing.T) {
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	transactionManager := &countingTransactionManager{tm: memory.NewTransactionManager(store)}
+	deadLetterProducer := &fakeDeadLetterProducer{}
+
+	consumer := NewDialogueCommandConsumer(newAppService(store, transactionManager), deadLetterProducer, config.ConsumerConfig{
+		Retry: config.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+
+	pending := fixture.AddPendingMessage(t, dialogueRepository)
+	const missing model.MessageId = 1000
+
+	batch := []*claimedCommand{
+		decodeClaimed(&sarama.ConsumerMessage{Offset: 0, Value: []byte(commandJson("CommitMessage", pending))}),
+		decodeClaimed(&sarama.ConsumerMessage{Offset: 1, Value: []byte(commandJson("CommitMessage", missing))}),
+	}
+
+	var completed []int64
+
+	batchDuration := metrics.ConsumerHandleDuration.WithLabelValues("batch")
+	batchesBefore, _ := fixture.HistogramSamples(t, batchDuration)
+
+	err := consumer.handleBatch(context.Background(), batch, func(msg *sarama.ConsumerMessage) {
+		completed = append(completed, msg.Offset)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(completed) != 2 {
+		t.Errorf("offsets %v completed, want both", completed)
+	}
+
+	fixture.AssertState(t, dialogueRepository, pending, model.MessageStateSent)
+
+	if len(deadLetterProducer.deadLetters) != 1 || deadLetterProducer.deadLetters[0].msg.Offset != 1 {
+		t.Fatalf("got %v dead letters, want the missing message only", len(deadLetterProducer.deadLetters))
+	}
+
+	if batches, _ := fixture.HistogramSamples(t, batchDuration); batches-batchesBefore != 1 {
+		t.Errorf("got %v batch durations observed, want 1", batches-batchesBefore)
+	}
+
+	// The batch is tried once, then the pending message once and the missing one on every attempt.
+	want := 1 + 1 + deadLetterProducer.deadLetters[0].attempts
+
+	if got := transactionManager.count(); got != want {
+		t.Errorf("got %v transactions, want %v", got, want)
+	}
+}
+
+// countingTransactionManager counts the transactions started.
+type countingTransactionManager struct {
+	tm service.ITransactionManager
+
+	mu           sync.Mutex
+	transactions int
+}
+
+func (tm *countingTransactionManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	tm.mu.Lock()
+	tm.transactions++
+	tm.mu.Unlock()
+
+	return tm.tm.WithinTransaction(ctx, fn)
+}
+
+func (tm *countingTransactionManager) count() int {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.transactions
+}
@@ -0,0 +1,72 @@
+package consumer
+
+import (
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// offsetTracker keeps messages of a claim in the order they were dispatched and reports
+// the last message of the contiguous prefix of completed ones, so that an offset is never
+// committed while an earlier message is still being processed.
+type offsetTracker struct {
+	mu        sync.Mutex
+	inFlight  []*sarama.ConsumerMessage
+	completed map[int64]struct{}
+	next      int64
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		completed: make(map[int64]struct{}),
+		next:      -1,
+	}
+}
+
+func (t *offsetTracker) add(msg *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.inFlight = append(t.inFlight, msg)
+}
+
+// complete records the message as processed and calls mark with the last message of the
+// completed prefix if the prefix has grown.
+func (t *offsetTracker) complete(msg *sarama.ConsumerMessage, mark func(msg *sarama.ConsumerMessage)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.completed[msg.Offset] = struct{}{}
+
+	var last *sarama.ConsumerMessage
+
+	for len(t.inFlight) > 0 {
+		head := t.inFlight[0]
+
+		if _, ok := t.completed[head.Offset]; !ok {
+			break
+		}
+
+		delete(t.completed, head.Offset)
+		t.inFlight = t.inFlight[1:]
+		last = head
+	}
+
+	if last != nil {
+		t.next = last.Offset + 1
+		mark(last)
+	}
+}
+
+// position returns the offset the claim would be consumed from again, i.e. the first message that is
+// not completed yet. It reports false until a message has been added.
+func (t *offsetTracker) position() (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.inFlight) > 0 {
+		return t.inFlight[0].Offset, true
+	}
+
+	return t.next, t.next >= 0
+}
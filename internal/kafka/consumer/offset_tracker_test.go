@@ -0,0 +1,94 @@
+package consumer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOffsetTracker_MarksContiguousPrefixOnly(t *testing.T) {
+	tracker := newOffsetTracker()
+	messages := make([]*sarama.ConsumerMessage, 5)
+
+	for i := range messages {
+		messages[i] = &sarama.ConsumerMessage{Offset: int64(10 + i)}
+		tracker.add(messages[i])
+	}
+
+	var marked []int64
+
+	mark := func(msg *sarama.ConsumerMessage) {
+		marked = append(marked, msg.Offset)
+	}
+
+	steps := []struct {
+		completed int
+		marked    []int64
+	}{
+		{completed: 2, marked: nil},
+		{completed: 0, marked: []int64{10}},
+		{completed: 4, marked: []int64{10}},
+		{completed: 1, marked: []int64{10, 12}},
+		{completed: 3, marked: []int64{10, 12, 14}},
+	}
+
+	for _, step := range steps {
+		tracker.complete(messages[step.completed], mark)
+
+		if !slices.Equal(marked, step.marked) {
+			t.Fatalf("after completing offset %v got marked %v, want %v",
+				messages[step.completed].Offset, marked, step.marked)
+		}
+	}
+}
+
+func TestReportLag_CountsMessagesNotCompleted(t *testing.T) {
+	tracker := newOffsetTracker()
+	claim := newFakeClaim(0)
+	claim.highWaterMark = 15
+
+	lag := metrics.ConsumerLag.WithLabelValues(claim.Topic(), "0")
+	lag.Set(-1)
+
+	reportLag(claim, tracker)
+
+	if got := testutil.ToFloat64(lag); got != -1 {
+		t.Fatalf("got lag %v before any message, want it not reported", got)
+	}
+
+	messages := make([]*sarama.ConsumerMessage, 5)
+
+	for i := range messages {
+		messages[i] = &sarama.ConsumerMessage{Offset: int64(10 + i)}
+		tracker.add(messages[i])
+	}
+
+	mark := func(*sarama.ConsumerMessage) {}
+
+	steps := []struct {
+		completed int
+		lag       float64
+	}{
+		{completed: -1, lag: 5},
+		{completed: 0, lag: 4},
+		{completed: 2, lag: 4},
+		{completed: 1, lag: 2},
+		{completed: 4, lag: 2},
+		{completed: 3, lag: 0},
+	}
+
+	for _, step := range steps {
+		if step.completed >= 0 {
+			tracker.complete(messages[step.completed], mark)
+		}
+
+		reportLag(claim, tracker)
+
+		if got := testutil.ToFloat64(lag); got != step.lag {
+			t.Fatalf("after completing %v got lag %v, want %v", step.completed, got, step.lag)
+		}
+	}
+}
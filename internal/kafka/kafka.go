@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/xdg-go/scram"
+)
+
+// NewConfig creates a sarama config with the security settings of the cluster applied.
+func NewConfig(cfg config.KafkaConfig) (*sarama.Config, error) {
+	saramaCfg := sarama.NewConfig()
+
+	err := applyTls(saramaCfg, cfg.Security.Tls)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = applySasl(saramaCfg, cfg.Security.Sasl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return saramaCfg, nil
+}
+
+func applyTls(saramaCfg *sarama.Config, cfg config.TlsConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CaFile != "" {
+		ca, err := os.ReadFile(cfg.CaFile)
+
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificates found in %v", cfg.CaFile)
+		}
+
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+
+		if err != nil {
+			return err
+		}
+
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	saramaCfg.Net.TLS.Enable = true
+	saramaCfg.Net.TLS.Config = tlsCfg
+
+	return nil
+}
+
+func applySasl(saramaCfg *sarama.Config, cfg config.SaslConfig) error {
+	if cfg.Mechanism == "" {
+		return nil
+	}
+
+	saramaCfg.Net.SASL.Enable = true
+	saramaCfg.Net.SASL.User = cfg.Username
+	saramaCfg.Net.SASL.Password = cfg.Password
+
+	switch cfg.Mechanism {
+	case sarama.SASLTypePlaintext:
+		saramaCfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case sarama.SASLTypeSCRAMSHA256:
+		saramaCfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		saramaCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGenerator: sha256.New}
+		}
+	case sarama.SASLTypeSCRAMSHA512:
+		saramaCfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		saramaCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGenerator: sha512.New}
+		}
+	default:
+		return fmt.Errorf("unsupported SASL mechanism: %v", cfg.Mechanism)
+	}
+
+	return nil
+}
+
+type scramClient struct {
+	hashGenerator scram.HashGeneratorFcn
+	conversation  *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGenerator.NewClient(userName, password, authzID)
+
+	if err != nil {
+		return err
+	}
+
+	c.conversation = client.NewConversation()
+
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
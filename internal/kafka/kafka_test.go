@@ -0,0 +1,361 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+)
+
+func TestNewConfig_Tls(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+	garbageFile := filepath.Join(t.TempDir(), "garbage.pem")
+
+	if err := os.WriteFile(garbageFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	cases := []struct {
+		name         string
+		tls          config.TlsConfig
+		expectErr    bool
+		expectEnable bool
+		expectCa     bool
+		expectCert   bool
+	}{
+		{
+			name: "disabled",
+			tls:  config.TlsConfig{CaFile: certFile},
+		},
+		{
+			name:         "enabled with system roots",
+			tls:          config.TlsConfig{Enabled: true},
+			expectEnable: true,
+		},
+		{
+			name:         "custom certificate authority",
+			tls:          config.TlsConfig{Enabled: true, CaFile: certFile},
+			expectEnable: true,
+			expectCa:     true,
+		},
+		{
+			name:         "client certificate",
+			tls:          config.TlsConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile},
+			expectEnable: true,
+			expectCert:   true,
+		},
+		{
+			name:      "missing certificate authority file",
+			tls:       config.TlsConfig{Enabled: true, CaFile: filepath.Join(t.TempDir(), "missing.pem")},
+			expectErr: true,
+		},
+		{
+			name:      "certificate authority file without certificates",
+			tls:       config.TlsConfig{Enabled: true, CaFile: garbageFile},
+			expectErr: true,
+		},
+		{
+			name:      "client certificate without key",
+			tls:       config.TlsConfig{Enabled: true, CertFile: certFile},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := NewConfig(config.KafkaConfig{Security: config.SecurityConfig{Tls: c.tls}})
+
+			if c.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Net.TLS.Enable != c.expectEnable {
+				t.Fatalf("expected TLS enabled %v, got %v", c.expectEnable, cfg.Net.TLS.Enable)
+			}
+
+			if !c.expectEnable {
+				return
+			}
+
+			if got := cfg.Net.TLS.Config.RootCAs != nil; got != c.expectCa {
+				t.Errorf("expected custom certificate authority %v, got %v", c.expectCa, got)
+			}
+
+			if got := len(cfg.Net.TLS.Config.Certificates) == 1; got != c.expectCert {
+				t.Errorf("expected client certificate %v, got %v", c.expectCert, got)
+			}
+		})
+	}
+}
+
+func TestNewConfig_Sasl(t *testing.T) {
+	cases := []struct {
+		name            string
+		mechanism       string
+		expectErr       bool
+		expectEnable    bool
+		expectMechanism sarama.SASLMechanism
+		expectScram     bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:            "plain",
+			mechanism:       sarama.SASLTypePlaintext,
+			expectEnable:    true,
+			expectMechanism: sarama.SASLTypePlaintext,
+		},
+		{
+			name:            "scram sha-256",
+			mechanism:       sarama.SASLTypeSCRAMSHA256,
+			expectEnable:    true,
+			expectMechanism: sarama.SASLTypeSCRAMSHA256,
+			expectScram:     true,
+		},
+		{
+			name:            "scram sha-512",
+			mechanism:       sarama.SASLTypeSCRAMSHA512,
+			expectEnable:    true,
+			expectMechanism: sarama.SASLTypeSCRAMSHA512,
+			expectScram:     true,
+		},
+		{
+			name:      "unsupported mechanism",
+			mechanism: sarama.SASLTypeGSSAPI,
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sasl := config.SaslConfig{Mechanism: c.mechanism, Username: "user", Password: "password"}
+			cfg, err := NewConfig(config.KafkaConfig{Security: config.SecurityConfig{Sasl: sasl}})
+
+			if c.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Net.SASL.Enable != c.expectEnable {
+				t.Fatalf("expected SASL enabled %v, got %v", c.expectEnable, cfg.Net.SASL.Enable)
+			}
+
+			if !c.expectEnable {
+				return
+			}
+
+			if cfg.Net.SASL.Mechanism != c.expectMechanism {
+				t.Errorf("expected mechanism %v, got %v", c.expectMechanism, cfg.Net.SASL.Mechanism)
+			}
+
+			if cfg.Net.SASL.User != "user" || cfg.Net.SASL.Password != "password" {
+				t.Error("expected the credentials to be set")
+			}
+
+			if got := cfg.Net.SASL.SCRAMClientGeneratorFunc != nil; got != c.expectScram {
+				t.Errorf("expected SCRAM client %v, got %v", c.expectScram, got)
+			}
+
+			if c.expectScram {
+				err = cfg.Net.SASL.SCRAMClientGeneratorFunc().Begin("user", "password", "")
+
+				if err != nil {
+					t.Errorf("failed to begin SCRAM conversation: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewConsumerGroupConfig(t *testing.T) {
+	cases := []struct {
+		name           string
+		consumer       config.ConsumerConfig
+		expectErr      bool
+		expectStrategy string
+		expectOffset   int64
+	}{
+		{
+			name:           "defaults",
+			expectStrategy: sarama.StickyBalanceStrategyName,
+			expectOffset:   sarama.OffsetOldest,
+		},
+		{
+			name:           "range",
+			consumer:       config.ConsumerConfig{RebalanceStrategy: "range", InitialOffset: "newest"},
+			expectStrategy: sarama.RangeBalanceStrategyName,
+			expectOffset:   sarama.OffsetNewest,
+		},
+		{
+			name:           "round robin",
+			consumer:       config.ConsumerConfig{RebalanceStrategy: "roundrobin"},
+			expectStrategy: sarama.RoundRobinBalanceStrategyName,
+			expectOffset:   sarama.OffsetOldest,
+		},
+		{
+			name:           "sticky",
+			consumer:       config.ConsumerConfig{RebalanceStrategy: "sticky", InitialOffset: "oldest"},
+			expectStrategy: sarama.StickyBalanceStrategyName,
+			expectOffset:   sarama.OffsetOldest,
+		},
+		{
+			name:      "cooperative sticky is rejected",
+			consumer:  config.ConsumerConfig{RebalanceStrategy: "cooperative-sticky"},
+			expectErr: true,
+		},
+		{
+			name:      "unknown strategy",
+			consumer:  config.ConsumerConfig{RebalanceStrategy: "random"},
+			expectErr: true,
+		},
+		{
+			name:      "unknown initial offset",
+			consumer:  config.ConsumerConfig{InitialOffset: "latest"},
+			expectErr: true,
+		},
+		{
+			name:      "heartbeat not shorter than session timeout",
+			consumer:  config.ConsumerConfig{SessionTimeout: 3 * time.Second, HeartbeatInterval: 3 * time.Second},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := newConsumerGroupConfig(config.KafkaConfig{}, c.consumer)
+
+			if c.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			strategies := cfg.Consumer.Group.Rebalance.GroupStrategies
+
+			if len(strategies) != 1 || strategies[0].Name() != c.expectStrategy {
+				t.Errorf("expected strategy %v, got %v", c.expectStrategy, strategies)
+			}
+
+			if cfg.Consumer.Offsets.Initial != c.expectOffset {
+				t.Errorf("expected initial offset %v, got %v", c.expectOffset, cfg.Consumer.Offsets.Initial)
+			}
+		})
+	}
+}
+
+func TestNewConsumerGroupConfig_AppliesTimeoutsAndFetchSizes(t *testing.T) {
+	consumer := config.ConsumerConfig{
+		SessionTimeout:    20 * time.Second,
+		HeartbeatInterval: 5 * time.Second,
+		MaxProcessingTime: time.Second,
+		Fetch: config.FetchConfig{
+			MinBytes:     16,
+			DefaultBytes: 4096,
+			MaxBytes:     8192,
+		},
+	}
+
+	cfg, err := newConsumerGroupConfig(config.KafkaConfig{}, consumer)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Consumer.Group.Session.Timeout != consumer.SessionTimeout {
+		t.Errorf("expected session timeout %v, got %v", consumer.SessionTimeout, cfg.Consumer.Group.Session.Timeout)
+	}
+
+	if cfg.Consumer.Group.Heartbeat.Interval != consumer.HeartbeatInterval {
+		t.Errorf("expected heartbeat interval %v, got %v", consumer.HeartbeatInterval, cfg.Consumer.Group.Heartbeat.Interval)
+	}
+
+	if cfg.Consumer.MaxProcessingTime != consumer.MaxProcessingTime {
+		t.Errorf("expected max processing time %v, got %v", consumer.MaxProcessingTime, cfg.Consumer.MaxProcessingTime)
+	}
+
+	if cfg.Consumer.Fetch.Min != 16 || cfg.Consumer.Fetch.Default != 4096 || cfg.Consumer.Fetch.Max != 8192 {
+		t.Errorf("unexpected fetch sizes %+v", cfg.Consumer.Fetch)
+	}
+}
+
+// writeCertificate writes a self-signed certificate and its key, the certificate serves as its own authority.
+func writeCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600)
+
+	if err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0o600)
+
+	if err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	return certFile, keyFile
+}
@@ -0,0 +1,207 @@
+// Package memory provides an in-process stand-in for a Kafka cluster. Topics are created on first
+// use with a fixed number of partitions, messages are partitioned by key hash the same way the
+// producer of the cluster does it, and consumer groups keep committed offsets.
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka"
+)
+
+type topic struct {
+	partitions [][]*sarama.ConsumerMessage
+}
+
+type Broker struct {
+	mu         sync.Mutex
+	partitions int
+	topics     map[string]*topic
+	groups     map[string]*group
+	// appended is closed and replaced every time messages are appended to any partition.
+	appended chan struct{}
+}
+
+func NewBroker(partitions int) *Broker {
+	return &Broker{
+		partitions: max(partitions, 1),
+		topics:     make(map[string]*topic),
+		groups:     make(map[string]*group),
+		appended:   make(chan struct{}),
+	}
+}
+
+func (b *Broker) NewSyncProducer() (sarama.SyncProducer, error) {
+	return &SyncProducer{
+		broker: b,
+	}, nil
+}
+
+func (b *Broker) NewConsumerGroup(consumerConfig config.ConsumerConfig) (sarama.ConsumerGroup, error) {
+	initialOffset, err := kafka.InitialOffset(consumerConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConsumerGroup{
+		broker:        b,
+		groupId:       consumerConfig.GroupId,
+		initialOffset: initialOffset,
+		errors:        make(chan error),
+	}, nil
+}
+
+func (b *Broker) NewReader() (kafka.IReader, error) {
+	return &reader{
+		broker: b,
+	}, nil
+}
+
+// Messages returns a copy of the messages in the partition of the topic.
+func (b *Broker) Messages(topicName string, partition int32) []*sarama.ConsumerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(topicName)
+
+	if int(partition) >= len(t.partitions) {
+		return nil
+	}
+
+	return append([]*sarama.ConsumerMessage(nil), t.partitions[partition]...)
+}
+
+// topic returns the topic creating it if needed, b.mu must be held.
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+
+	if !ok {
+		t = &topic{
+			partitions: make([][]*sarama.ConsumerMessage, b.partitions),
+		}
+
+		b.topics[name] = t
+	}
+
+	return t
+}
+
+func (b *Broker) append(msg *sarama.ProducerMessage) (int32, int64, error) {
+	key, err := encode(msg.Key)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	value, err := encode(msg.Value)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(msg.Topic)
+
+	partition, err := sarama.NewHashPartitioner(msg.Topic).Partition(msg, int32(len(t.partitions)))
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	timestamp := msg.Timestamp
+
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	headers := make([]*sarama.RecordHeader, len(msg.Headers))
+
+	for i := range msg.Headers {
+		header := msg.Headers[i]
+		headers[i] = &header
+	}
+
+	offset := int64(len(t.partitions[partition]))
+
+	t.partitions[partition] = append(t.partitions[partition], &sarama.ConsumerMessage{
+		Headers:   headers,
+		Timestamp: timestamp,
+		Key:       key,
+		Value:     value,
+		Topic:     msg.Topic,
+		Partition: partition,
+		Offset:    offset,
+	})
+
+	msg.Partition = partition
+	msg.Offset = offset
+	msg.Timestamp = timestamp
+
+	close(b.appended)
+	b.appended = make(chan struct{})
+
+	return partition, offset, nil
+}
+
+// stream sends the messages of the partition starting from offset to ch until done is closed,
+// then closes ch.
+func (b *Broker) stream(topicName string, partition int32, offset int64, ch chan<- *sarama.ConsumerMessage, done <-chan struct{}) {
+	defer close(ch)
+
+	for {
+		b.mu.Lock()
+		messages := b.topic(topicName).partitions[partition]
+		appended := b.appended
+		b.mu.Unlock()
+
+		if offset < int64(len(messages)) {
+			select {
+			case ch <- messages[offset]:
+				offset++
+			case <-done:
+				return
+			}
+
+			continue
+		}
+
+		select {
+		case <-appended:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (b *Broker) highWaterMark(topicName string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return int64(len(b.topic(topicName).partitions[partition]))
+}
+
+func (b *Broker) checkPartition(topicName string, partition int32) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if partition < 0 || int(partition) >= len(b.topic(topicName).partitions) {
+		return fmt.Errorf("partition %v of topic %v: %w", partition, topicName, sarama.ErrUnknownTopicOrPartition)
+	}
+
+	return nil
+}
+
+func encode(encoder sarama.Encoder) ([]byte, error) {
+	if encoder == nil {
+		return nil, nil
+	}
+
+	return encoder.Encode()
+}
@@ -0,0 +1,185 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+)
+
+func TestSendMessage_PartitionsByKey(t *testing.T) {
+	broker := NewBroker(3)
+	producer, _ := broker.NewSyncProducer()
+
+	first := send(t, producer, "topic", "key", "first")
+	second := send(t, producer, "topic", "key", "second")
+
+	if first.Partition != second.Partition {
+		t.Fatalf("messages with the same key went to partitions %v and %v", first.Partition, second.Partition)
+	}
+
+	if first.Offset != 0 || second.Offset != 1 {
+		t.Fatalf("got offsets %v and %v, want 0 and 1", first.Offset, second.Offset)
+	}
+
+	messages := broker.Messages("topic", first.Partition)
+
+	if len(messages) != 2 || string(messages[1].Value) != "second" {
+		t.Fatalf("got %v messages in the partition, want 2 in order", len(messages))
+	}
+}
+
+func TestConsume_ContinuesFromCommittedOffset(t *testing.T) {
+	broker := NewBroker(1)
+	producer, _ := broker.NewSyncProducer()
+	consumerConfig := config.ConsumerConfig{GroupId: "group"}
+
+	send(t, producer, "topic", "key", "first")
+	send(t, producer, "topic", "key", "second")
+
+	got := consume(t, broker, consumerConfig, 2)
+
+	if got[0] != "first" || got[1] != "second" {
+		t.Fatalf("got %v, want [first second]", got)
+	}
+
+	send(t, producer, "topic", "key", "third")
+
+	got = consume(t, broker, consumerConfig, 1)
+
+	if got[0] != "third" {
+		t.Fatalf("got %v after restart, want [third]", got)
+	}
+}
+
+func TestConsume_SplitsPartitionsBetweenMembers(t *testing.T) {
+	broker := NewBroker(2)
+	consumerConfig := config.ConsumerConfig{GroupId: "group"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claims := make(chan map[string][]int32)
+	wg := &sync.WaitGroup{}
+
+	for range 2 {
+		cg, _ := broker.NewConsumerGroup(consumerConfig)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				_ = cg.Consume(ctx, []string{"topic"}, &handler{setup: func(session sarama.ConsumerGroupSession) {
+					select {
+					case claims <- session.Claims():
+					case <-ctx.Done():
+					}
+				}})
+			}
+
+			_ = cg.Close()
+		}()
+	}
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case first := <-claims:
+			if len(first["topic"]) == 1 {
+				cancel()
+				wg.Wait()
+				return
+			}
+		case <-timeout:
+			t.Fatal("partitions were not split between the members")
+		}
+	}
+}
+
+func send(t *testing.T, producer sarama.SyncProducer, topic, key, value string) *sarama.ProducerMessage {
+	t.Helper()
+
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.StringEncoder(value),
+	}
+
+	_, _, err := producer.SendMessage(msg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return msg
+}
+
+// consume reads count messages with a new member of the consumer group and closes it.
+func consume(t *testing.T, broker *Broker, consumerConfig config.ConsumerConfig, count int) []string {
+	t.Helper()
+
+	cg, err := broker.NewConsumerGroup(consumerConfig)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var values []string
+
+	err = cg.Consume(ctx, []string{"topic"}, &handler{consume: func(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
+		values = append(values, string(msg.Value))
+		session.MarkMessage(msg, "")
+
+		if len(values) == count {
+			cancel()
+		}
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = cg.Close()
+
+	if len(values) != count {
+		t.Fatalf("got %v messages, want %v", len(values), count)
+	}
+
+	return values
+}
+
+type handler struct {
+	setup   func(session sarama.ConsumerGroupSession)
+	consume func(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage)
+}
+
+func (h *handler) Setup(session sarama.ConsumerGroupSession) error {
+	if h.setup != nil {
+		h.setup(session)
+	}
+
+	return nil
+}
+
+func (h *handler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *handler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if h.consume != nil {
+			h.consume(session, msg)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,377 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+type member struct {
+	id     string
+	topics []string
+}
+
+// group is the broker side state of a consumer group. A new generation starts whenever a member
+// joins or leaves, and sessions of the new generation start once all sessions of the previous
+// ones are over, so a partition is never claimed by two members at the same time.
+type group struct {
+	members    []*member
+	generation int32
+	offsets    map[string]map[int32]int64
+	// running counts the sessions of each generation that have not finished yet.
+	running map[int32]int
+	// rebalance is closed when a new generation starts.
+	rebalance chan struct{}
+	// finished is closed and replaced every time a session is over.
+	finished chan struct{}
+	nextId   int
+}
+
+// group returns the consumer group creating it if needed, b.mu must be held.
+func (b *Broker) group(groupId string) *group {
+	g, ok := b.groups[groupId]
+
+	if !ok {
+		g = &group{
+			offsets:   make(map[string]map[int32]int64),
+			running:   make(map[int32]int),
+			rebalance: make(chan struct{}),
+			finished:  make(chan struct{}),
+		}
+
+		b.groups[groupId] = g
+	}
+
+	return g
+}
+
+func (g *group) nextGeneration() {
+	g.generation++
+	close(g.rebalance)
+	g.rebalance = make(chan struct{})
+}
+
+// previousRunning reports whether sessions of generations before the given one are still running.
+func (g *group) previousRunning(generation int32) bool {
+	for gen, count := range g.running {
+		if gen < generation && count > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// assign distributes the partitions of the subscribed topics across the members round-robin.
+func (b *Broker) assign(g *group, m *member) map[string][]int32 {
+	claims := make(map[string][]int32)
+
+	for _, topicName := range m.topics {
+		var subscribers []*member
+
+		for _, other := range g.members {
+			if slices.Contains(other.topics, topicName) {
+				subscribers = append(subscribers, other)
+			}
+		}
+
+		index := slices.Index(subscribers, m)
+
+		for partition := range b.topic(topicName).partitions {
+			if partition%len(subscribers) == index {
+				claims[topicName] = append(claims[topicName], int32(partition))
+			}
+		}
+	}
+
+	return claims
+}
+
+// ConsumerGroup is a member of a consumer group of the broker. Committed offsets are kept by the
+// broker, so a consumer group created later with the same ID continues where this one stopped.
+// Pausing partitions is not supported.
+type ConsumerGroup struct {
+	broker        *Broker
+	groupId       string
+	initialOffset int64
+	errors        chan error
+
+	member *member
+	closed bool
+}
+
+func (c *ConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	if len(topics) == 0 {
+		return fmt.Errorf("no topics provided")
+	}
+
+	b := c.broker
+
+	b.mu.Lock()
+
+	if c.closed {
+		b.mu.Unlock()
+		return sarama.ErrClosedConsumerGroup
+	}
+
+	g := b.group(c.groupId)
+
+	if c.member == nil {
+		g.nextId++
+
+		c.member = &member{
+			id:     fmt.Sprintf("%v-%d", c.groupId, g.nextId),
+			topics: slices.Clone(topics),
+		}
+
+		g.members = append(g.members, c.member)
+		g.nextGeneration()
+	} else if !slices.Equal(c.member.topics, topics) {
+		c.member.topics = slices.Clone(topics)
+		g.nextGeneration()
+	}
+
+	for g.previousRunning(g.generation) {
+		finished := g.finished
+		b.mu.Unlock()
+
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			return nil
+		}
+
+		b.mu.Lock()
+	}
+
+	generation := g.generation
+	rebalance := g.rebalance
+	claims := b.assign(g, c.member)
+	g.running[generation]++
+
+	offsets := make(map[string]map[int32]int64)
+
+	for topicName, partitions := range claims {
+		offsets[topicName] = make(map[int32]int64)
+
+		for _, partition := range partitions {
+			offset, ok := g.offsets[topicName][partition]
+
+			if !ok {
+				offset = 0
+
+				if c.initialOffset == sarama.OffsetNewest {
+					offset = int64(len(b.topic(topicName).partitions[partition]))
+				}
+			}
+
+			offsets[topicName][partition] = offset
+		}
+	}
+
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		g.running[generation]--
+		close(g.finished)
+		g.finished = make(chan struct{})
+		b.mu.Unlock()
+	}()
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	session := &session{
+		ctx:        sessionCtx,
+		broker:     b,
+		group:      g,
+		memberId:   c.member.id,
+		generation: generation,
+		claims:     claims,
+	}
+
+	err := handler.Setup(session)
+
+	if err != nil {
+		return err
+	}
+
+	wg := &sync.WaitGroup{}
+
+	for topicName, partitions := range claims {
+		for _, partition := range partitions {
+			claim := &claim{
+				topic:         topicName,
+				partition:     partition,
+				initialOffset: offsets[topicName][partition],
+				broker:        b,
+				messages:      make(chan *sarama.ConsumerMessage),
+			}
+
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+				b.stream(claim.topic, claim.partition, claim.initialOffset, claim.messages, sessionCtx.Done())
+			}()
+
+			go func() {
+				defer wg.Done()
+
+				// Like the real consumer group, the session is over as soon as any claim is done.
+				defer cancel()
+
+				consumeErr := handler.ConsumeClaim(session, claim)
+
+				if consumeErr != nil {
+					c.sendError(consumeErr)
+				}
+			}()
+		}
+	}
+
+	select {
+	case <-sessionCtx.Done():
+	case <-rebalance:
+	}
+
+	cancel()
+	wg.Wait()
+
+	return handler.Cleanup(session)
+}
+
+func (c *ConsumerGroup) sendError(err error) {
+	select {
+	case c.errors <- err:
+	default:
+	}
+}
+
+func (c *ConsumerGroup) Errors() <-chan error {
+	return c.errors
+}
+
+func (c *ConsumerGroup) Close() error {
+	b := c.broker
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return sarama.ErrClosedConsumerGroup
+	}
+
+	c.closed = true
+	close(c.errors)
+
+	if c.member != nil {
+		g := b.group(c.groupId)
+		g.members = slices.DeleteFunc(g.members, func(m *member) bool { return m == c.member })
+		g.nextGeneration()
+	}
+
+	return nil
+}
+
+func (c *ConsumerGroup) Pause(map[string][]int32) {}
+
+func (c *ConsumerGroup) Resume(map[string][]int32) {}
+
+func (c *ConsumerGroup) PauseAll() {}
+
+func (c *ConsumerGroup) ResumeAll() {}
+
+type session struct {
+	ctx        context.Context
+	broker     *Broker
+	group      *group
+	memberId   string
+	generation int32
+	claims     map[string][]int32
+}
+
+func (s *session) Claims() map[string][]int32 {
+	return s.claims
+}
+
+func (s *session) MemberID() string {
+	return s.memberId
+}
+
+func (s *session) GenerationID() int32 {
+	return s.generation
+}
+
+// MarkOffset commits the offset right away.
+func (s *session) MarkOffset(topicName string, partition int32, offset int64, _ string) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	offsets, ok := s.group.offsets[topicName]
+
+	if !ok {
+		offsets = make(map[int32]int64)
+		s.group.offsets[topicName] = offsets
+	}
+
+	if offset > offsets[partition] {
+		offsets[partition] = offset
+	}
+}
+
+func (s *session) Commit() {}
+
+func (s *session) ResetOffset(topicName string, partition int32, offset int64, _ string) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	offsets, ok := s.group.offsets[topicName]
+
+	if !ok {
+		offsets = make(map[int32]int64)
+		s.group.offsets[topicName] = offsets
+	}
+
+	offsets[partition] = offset
+}
+
+func (s *session) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+func (s *session) Context() context.Context {
+	return s.ctx
+}
+
+type claim struct {
+	topic         string
+	partition     int32
+	initialOffset int64
+	broker        *Broker
+	messages      chan *sarama.ConsumerMessage
+}
+
+func (c *claim) Topic() string {
+	return c.topic
+}
+
+func (c *claim) Partition() int32 {
+	return c.partition
+}
+
+func (c *claim) InitialOffset() int64 {
+	return c.initialOffset
+}
+
+func (c *claim) HighWaterMarkOffset() int64 {
+	return c.broker.highWaterMark(c.topic, c.partition)
+}
+
+func (c *claim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"sync/atomic"
+
+	"github.com/IBM/sarama"
+)
+
+// SyncProducer appends messages to the partitions of the broker right away. Transactions are not supported.
+type SyncProducer struct {
+	broker *Broker
+	closed atomic.Bool
+}
+
+func (p *SyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if p.closed.Load() {
+		return 0, 0, sarama.ErrClosedClient
+	}
+
+	return p.broker.append(msg)
+}
+
+func (p *SyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+
+	for _, msg := range msgs {
+		_, _, err := p.SendMessage(msg)
+
+		if err != nil {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *SyncProducer) Close() error {
+	p.closed.Store(true)
+	return nil
+}
+
+func (p *SyncProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return sarama.ProducerTxnFlagReady
+}
+
+func (p *SyncProducer) IsTransactional() bool {
+	return false
+}
+
+func (p *SyncProducer) BeginTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *SyncProducer) CommitTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *SyncProducer) AbortTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *SyncProducer) AddOffsetsToTxn(map[string][]*sarama.PartitionOffsetMetadata, string) error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *SyncProducer) AddMessageToTxn(*sarama.ConsumerMessage, string, *string) error {
+	return sarama.ErrNonTransactedProducer
+}
@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+type reader struct {
+	broker *Broker
+}
+
+func (r *reader) Partitions(topicName string) ([]int32, error) {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	partitions := make([]int32, len(r.broker.topic(topicName).partitions))
+
+	for i := range partitions {
+		partitions[i] = int32(i)
+	}
+
+	return partitions, nil
+}
+
+func (r *reader) GetOffset(topicName string, partition int32, time int64) (int64, error) {
+	err := r.broker.checkPartition(topicName, partition)
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch time {
+	case sarama.OffsetOldest:
+		return 0, nil
+	case sarama.OffsetNewest:
+		return r.broker.highWaterMark(topicName, partition), nil
+	}
+
+	for _, msg := range r.broker.Messages(topicName, partition) {
+		if msg.Timestamp.UnixMilli() >= time {
+			return msg.Offset, nil
+		}
+	}
+
+	return r.broker.highWaterMark(topicName, partition), nil
+}
+
+func (r *reader) ConsumePartition(topicName string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	err := r.broker.checkPartition(topicName, partition)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch offset {
+	case sarama.OffsetOldest:
+		offset = 0
+	case sarama.OffsetNewest:
+		offset = r.broker.highWaterMark(topicName, partition)
+	}
+
+	if offset < 0 || offset > r.broker.highWaterMark(topicName, partition) {
+		return nil, sarama.ErrOffsetOutOfRange
+	}
+
+	pc := &partitionConsumer{
+		broker:    r.broker,
+		topic:     topicName,
+		partition: partition,
+		messages:  make(chan *sarama.ConsumerMessage),
+		errors:    make(chan *sarama.ConsumerError),
+		done:      make(chan struct{}),
+	}
+
+	go func() {
+		defer close(pc.errors)
+		r.broker.stream(topicName, partition, offset, pc.messages, pc.done)
+	}()
+
+	return pc, nil
+}
+
+func (r *reader) Close() error {
+	return nil
+}
+
+type partitionConsumer struct {
+	broker    *Broker
+	topic     string
+	partition int32
+	messages  chan *sarama.ConsumerMessage
+	errors    chan *sarama.ConsumerError
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (pc *partitionConsumer) AsyncClose() {
+	pc.closeOnce.Do(func() {
+		close(pc.done)
+	})
+}
+
+func (pc *partitionConsumer) Close() error {
+	pc.AsyncClose()
+
+	for range pc.messages {
+	}
+
+	return nil
+}
+
+func (pc *partitionConsumer) Messages() <-chan *sarama.ConsumerMessage {
+	return pc.messages
+}
+
+func (pc *partitionConsumer) Errors() <-chan *sarama.ConsumerError {
+	return pc.errors
+}
+
+func (pc *partitionConsumer) HighWaterMarkOffset() int64 {
+	return pc.broker.highWaterMark(pc.topic, pc.partition)
+}
+
+func (pc *partitionConsumer) Pause() {}
+
+func (pc *partitionConsumer) Resume() {}
+
+func (pc *partitionConsumer) IsPaused() bool {
+	return false
+}
@@ -0,0 +1,81 @@
+package producer
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Headers describing why a record was moved to the dead-letter topic.
+const (
+	HeaderDeadLetterError             = "x-dlq-error"
+	HeaderDeadLetterErrorClass        = "x-dlq-error-class"
+	HeaderDeadLetterAttempts          = "x-dlq-attempts"
+	HeaderDeadLetterFailedAt          = "x-dlq-failed-at"
+	HeaderDeadLetterOriginalTopic     = "x-dlq-original-topic"
+	HeaderDeadLetterOriginalPartition = "x-dlq-original-partition"
+	HeaderDeadLetterOriginalOffset    = "x-dlq-original-offset"
+	HeaderDeadLetterConsumerGroup     = "x-dlq-consumer-group"
+)
+
+type DeadLetterProducer struct {
+	producer      sarama.SyncProducer
+	topic         string
+	consumerGroup string
+}
+
+func NewDeadLetterProducer(producer sarama.SyncProducer, topic, consumerGroup string) *DeadLetterProducer {
+	return &DeadLetterProducer{
+		producer:      producer,
+		topic:         topic,
+		consumerGroup: consumerGroup,
+	}
+}
+
+// SendMessage publishes the original record to the dead-letter topic along with the error
+// that made it impossible to handle.
+func (p *DeadLetterProducer) SendMessage(
+	original *sarama.ConsumerMessage,
+	cause error,
+	errorClass string,
+	attempts int,
+) error {
+	headers := make([]sarama.RecordHeader, 0, len(original.Headers)+8)
+
+	for _, header := range original.Headers {
+		if header != nil {
+			headers = append(headers, *header)
+		}
+	}
+
+	headers = append(
+		headers,
+		stringHeader(HeaderDeadLetterError, cause.Error()),
+		stringHeader(HeaderDeadLetterErrorClass, errorClass),
+		stringHeader(HeaderDeadLetterAttempts, strconv.Itoa(attempts)),
+		stringHeader(HeaderDeadLetterFailedAt, time.Now().UTC().Format(time.RFC3339Nano)),
+		stringHeader(HeaderDeadLetterOriginalTopic, original.Topic),
+		stringHeader(HeaderDeadLetterOriginalPartition, strconv.FormatInt(int64(original.Partition), 10)),
+		stringHeader(HeaderDeadLetterOriginalOffset, strconv.FormatInt(original.Offset, 10)),
+		stringHeader(HeaderDeadLetterConsumerGroup, p.consumerGroup),
+	)
+
+	msg := &sarama.ProducerMessage{
+		Topic:   p.topic,
+		Key:     sarama.ByteEncoder(original.Key),
+		Value:   sarama.ByteEncoder(original.Value),
+		Headers: headers,
+	}
+
+	_, _, err := p.producer.SendMessage(msg)
+
+	return err
+}
+
+func stringHeader(key, value string) sarama.RecordHeader {
+	return sarama.RecordHeader{
+		Key:   []byte(key),
+		Value: []byte(value),
+	}
+}
@@ -1,83 +1,56 @@
 package producer
 
 import (
-	"encoding/json"
-	"fmt"
 	"github.com/IBM/sarama"
-	"github.com/orochi-keydream/dialogue-service/internal/config"
 	"github.com/orochi-keydream/dialogue-service/internal/model"
 )
 
-type CounterCommandProducer struct {
+type OutboxProducer struct {
 	producer sarama.SyncProducer
-	topic    string
+	router   *Router
 }
 
-func NewCounterCommandProducer(config config.KafkaConfig) (*CounterCommandProducer, error) {
-	cfg := sarama.NewConfig()
-	cfg.Producer.Return.Successes = true
-
-	producer, err := sarama.NewSyncProducer(config.Brokers, cfg)
-
-	if err != nil {
-		return nil, err
-	}
-
-	p := &CounterCommandProducer{
+func NewOutboxProducer(producer sarama.SyncProducer, router *Router) *OutboxProducer {
+	return &OutboxProducer{
 		producer: producer,
-		topic:    config.Producers.CounterCommands.Topic,
+		router:   router,
 	}
-
-	return p, nil
 }
 
-func (p *CounterCommandProducer) SendMessage(message *model.OutboxMessage) error {
-	var (
-		messageKeyBytes   []byte
-		messageValueBytes []byte
-	)
-
-	switch message.Type {
-	case model.OutboxMessageTypeAddNewUnreadMessage:
-		messageKey := message.MessageKey.(string)
-		messageValue := message.MessageValue.(model.AddNewUnreadMessage)
+// SendMessage publishes the message exactly as it was encoded when stored in the outbox. Messages
+// stored before the outbox kept their topic are published to the topic configured for their type.
+func (p *OutboxProducer) SendMessage(message *model.OutboxMessage) error {
+	topic := message.Topic
 
-		messageKeyBytes = []byte(messageKey)
-
-		bytes, err := mapAddNewUnreadMessageToBytes(messageValue)
+	if topic == "" {
+		route, err := p.router.Route(message.Type)
 
 		if err != nil {
 			return err
 		}
 
-		messageValueBytes = bytes
-	default:
-		return fmt.Errorf("Unsupported message type: %s", message.Type)
+		topic = route.Topic
+	}
+
+	headers := make([]sarama.RecordHeader, 0, len(message.Headers))
+
+	for key, value := range message.Headers {
+		header := sarama.RecordHeader{
+			Key:   []byte(key),
+			Value: []byte(value),
+		}
+
+		headers = append(headers, header)
 	}
 
 	msg := &sarama.ProducerMessage{
-		Key:   sarama.StringEncoder(messageKeyBytes),
-		Value: sarama.StringEncoder(messageValueBytes),
-		Topic: p.topic,
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Topic:   topic,
+		Headers: headers,
 	}
 
 	_, _, err := p.producer.SendMessage(msg)
 
 	return err
 }
-
-func mapAddNewUnreadMessageToBytes(message model.AddNewUnreadMessage) ([]byte, error) {
-	dto := struct {
-		CorrelationId string `json:"correlationId"`
-		UserId        string `json:"userId"`
-		ChatId        string `json:"chatId"`
-		MessageId     int64  `json:"messageId"`
-	}{
-		CorrelationId: message.CorrelationId,
-		UserId:        string(message.UserId),
-		ChatId:        string(message.ChatId),
-		MessageId:     int64(message.MessageId),
-	}
-
-	return json.Marshal(dto)
-}
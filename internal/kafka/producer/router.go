@@ -0,0 +1,65 @@
+package producer
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+// Route is the destination outbox messages of a type are published to.
+type Route struct {
+	Topic   string
+	Format  string
+	Headers map[string]string
+}
+
+// Router resolves the destination of an outbox message by its type.
+type Router struct {
+	routes map[model.OutboxMessageType]Route
+}
+
+func NewRouter(configs config.ProducerConfigs) (*Router, error) {
+	routes := make(map[model.OutboxMessageType]Route, len(configs))
+
+	for name, cfg := range configs {
+		messageType, err := model.ParseOutboxMessageType(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.Topic == "" {
+			return nil, fmt.Errorf("topic for %v messages not specified", name)
+		}
+
+		routes[messageType] = Route{
+			Topic:   cfg.Topic,
+			Format:  cfg.Format,
+			Headers: maps.Clone(cfg.Headers),
+		}
+	}
+
+	for _, messageType := range model.OutboxMessageTypes() {
+		if _, ok := routes[messageType]; !ok {
+			return nil, fmt.Errorf("no producer configured for %v messages", messageType)
+		}
+	}
+
+	r := &Router{
+		routes: routes,
+	}
+
+	return r, nil
+}
+
+func (r *Router) Route(messageType model.OutboxMessageType) (Route, error) {
+	route, ok := r.routes[messageType]
+
+	if !ok {
+		return Route{}, fmt.Errorf("no route for %v messages", messageType)
+	}
+
+	return route, nil
+}
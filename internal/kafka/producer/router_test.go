@@ -0,0 +1,87 @@
+package producer
+
+import (
+	"testing"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/memory"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+func TestNewRouter(t *testing.T) {
+	cases := []struct {
+		name    string
+		configs config.ProducerConfigs
+		wantErr bool
+	}{
+		{name: "every type routed", configs: routedConfigs()},
+		{name: "unknown type", configs: withConfig("SearchIndexUpdated", config.ProducerConfig{Topic: "search"}), wantErr: true},
+		{name: "missing topic", configs: withConfig(model.OutboxMessageTypeAdjustUnreadCounter.String(), config.ProducerConfig{}), wantErr: true},
+		{name: "missing type", configs: config.ProducerConfigs{
+			model.OutboxMessageTypeAddNewUnreadMessage.String(): {Topic: "counter_commands"},
+		}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewRouter(c.configs)
+
+			if (err != nil) != c.wantErr {
+				t.Errorf("got error %v, want error: %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestSendMessage_PublishesStoredMessagesWithoutTopicToConfiguredTopic(t *testing.T) {
+	router, err := NewRouter(routedConfigs())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := memory.NewBroker(1)
+	syncProducer, err := broker.NewSyncProducer()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outboxProducer := NewOutboxProducer(syncProducer, router)
+
+	messages := []*model.OutboxMessage{
+		{Type: model.OutboxMessageTypeAddNewUnreadMessage, Key: []byte("chat"), Value: []byte("stored")},
+		{Type: model.OutboxMessageTypeAddNewUnreadMessage, Topic: "routed_at_insert", Key: []byte("chat"), Value: []byte("routed")},
+	}
+
+	for _, message := range messages {
+		err = outboxProducer.SendMessage(message)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := broker.Messages("counter_commands", 0); len(got) != 1 || string(got[0].Value) != "stored" {
+		t.Errorf("got %v messages in the configured topic, want the one stored without topic", len(got))
+	}
+
+	if got := broker.Messages("routed_at_insert", 0); len(got) != 1 || string(got[0].Value) != "routed" {
+		t.Errorf("got %v messages in the topic of the message, want 1", len(got))
+	}
+}
+
+func routedConfigs() config.ProducerConfigs {
+	return config.ProducerConfigs{
+		model.OutboxMessageTypeAddNewUnreadMessage.String(): {Topic: "counter_commands"},
+		model.OutboxMessageTypeAdjustUnreadCounter.String(): {Topic: "counter_adjustments"},
+		model.OutboxMessageTypeRemoveUnreadMessage.String(): {Topic: "counter_compensations"},
+	}
+}
+
+func withConfig(name string, cfg config.ProducerConfig) config.ProducerConfigs {
+	configs := routedConfigs()
+	configs[name] = cfg
+
+	return configs
+}
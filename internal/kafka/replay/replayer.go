@@ -0,0 +1,294 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/consumer"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/producer"
+)
+
+const (
+	HeaderReplayedFrom = "x-replayed-from"
+
+	deadLetterHeaderPrefix = "x-dlq-"
+	idleTimeout            = 5 * time.Second
+)
+
+// Filter selects the records to replay. Zero values do not restrict the selection.
+type Filter struct {
+	Topic         string
+	Partition     *int32
+	FromOffset    *int64
+	ToOffset      *int64
+	Command       string
+	CorrelationId string
+	FromTime      time.Time
+	ToTime        time.Time
+}
+
+type Record struct {
+	Partition       int32     `json:"partition"`
+	Offset          int64     `json:"offset"`
+	Timestamp       time.Time `json:"timestamp"`
+	Command         string    `json:"command"`
+	CorrelationId   string    `json:"correlationId"`
+	Error           string    `json:"error,omitempty"`
+	ValidationError string    `json:"validationError,omitempty"`
+	HandlingError   string    `json:"handlingError,omitempty"`
+	Replayed        bool      `json:"replayed"`
+}
+
+type Result struct {
+	Matched  int       `json:"matched"`
+	Replayed int       `json:"replayed"`
+	Records  []*Record `json:"records"`
+}
+
+type IDryRunner interface {
+	DryRun(ctx context.Context, msg []byte) error
+}
+
+// Replayer republishes failed dialogue commands from a dead-letter topic to the dialogue commands topic.
+type Replayer struct {
+	broker       kafka.IBroker
+	producer     sarama.SyncProducer
+	dryRunner    IDryRunner
+	defaultTopic string
+	targetTopic  string
+}
+
+func NewReplayer(
+	broker kafka.IBroker,
+	producer sarama.SyncProducer,
+	dryRunner IDryRunner,
+	defaultTopic string,
+	targetTopic string,
+) *Replayer {
+	return &Replayer{
+		broker:       broker,
+		producer:     producer,
+		dryRunner:    dryRunner,
+		defaultTopic: defaultTopic,
+		targetTopic:  targetTopic,
+	}
+}
+
+// Replay reads the records matching the filter up to the end of each partition as of the call.
+// Every matching record is decoded the same way the consumer does it, the ones that cannot be
+// decoded are reported but not republished. In dry-run mode nothing is republished, instead the
+// commands are handled without changing anything and the errors of handling are reported.
+func (r *Replayer) Replay(ctx context.Context, filter Filter, dryRun bool) (*Result, error) {
+	topic := filter.Topic
+
+	if topic == "" {
+		topic = r.defaultTopic
+	}
+
+	reader, err := r.broker.NewReader()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	var partitions []int32
+
+	if filter.Partition != nil {
+		partitions = []int32{*filter.Partition}
+	} else {
+		partitions, err = reader.Partitions(topic)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{
+		Records: make([]*Record, 0),
+	}
+
+	for _, partition := range partitions {
+		err = r.replayPartition(ctx, reader, topic, partition, filter, dryRun, result)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (r *Replayer) replayPartition(
+	ctx context.Context,
+	reader kafka.IReader,
+	topic string,
+	partition int32,
+	filter Filter,
+	dryRun bool,
+	result *Result,
+) error {
+	oldest, err := reader.GetOffset(topic, partition, sarama.OffsetOldest)
+
+	if err != nil {
+		return err
+	}
+
+	newest, err := reader.GetOffset(topic, partition, sarama.OffsetNewest)
+
+	if err != nil {
+		return err
+	}
+
+	start := oldest
+	end := newest - 1
+
+	if filter.FromOffset != nil {
+		start = max(start, *filter.FromOffset)
+	}
+
+	if filter.ToOffset != nil {
+		end = min(end, *filter.ToOffset)
+	}
+
+	if start > end {
+		return nil
+	}
+
+	pc, err := reader.ConsumePartition(topic, partition, start)
+
+	if err != nil {
+		return err
+	}
+
+	defer pc.Close()
+
+	for {
+		select {
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return nil
+			}
+
+			if msg.Offset > end {
+				return nil
+			}
+
+			record, matched := match(msg, filter)
+
+			if matched {
+				result.Matched++
+				result.Records = append(result.Records, record)
+
+				if dryRun && record.ValidationError == "" {
+					err = r.dryRunner.DryRun(ctx, msg.Value)
+
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+
+					if err != nil {
+						record.HandlingError = err.Error()
+					}
+				}
+
+				if !dryRun && record.ValidationError == "" {
+					err = r.republish(msg)
+
+					if err != nil {
+						return fmt.Errorf("failed to replay offset %v of partition %v: %w", msg.Offset, partition, err)
+					}
+
+					record.Replayed = true
+					result.Replayed++
+				}
+			}
+
+			if msg.Offset >= end {
+				return nil
+			}
+		case <-time.After(idleTimeout):
+			// Offsets at the end of the range may belong to control records that are never delivered.
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func match(msg *sarama.ConsumerMessage, filter Filter) (*Record, bool) {
+	record := &Record{
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+	}
+
+	envelope := consumer.Message{}
+
+	if err := json.Unmarshal(msg.Value, &envelope); err == nil {
+		record.Command = string(envelope.Command)
+		record.CorrelationId = envelope.CorrelationId
+	}
+
+	for _, header := range msg.Headers {
+		if header != nil && string(header.Key) == producer.HeaderDeadLetterError {
+			record.Error = string(header.Value)
+		}
+	}
+
+	if filter.Command != "" && filter.Command != record.Command {
+		return nil, false
+	}
+
+	if filter.CorrelationId != "" && filter.CorrelationId != record.CorrelationId {
+		return nil, false
+	}
+
+	if !filter.FromTime.IsZero() && msg.Timestamp.Before(filter.FromTime) {
+		return nil, false
+	}
+
+	if !filter.ToTime.IsZero() && msg.Timestamp.After(filter.ToTime) {
+		return nil, false
+	}
+
+	if _, err := consumer.DecodeCommand(msg.Value); err != nil {
+		record.ValidationError = err.Error()
+	}
+
+	return record, true
+}
+
+func (r *Replayer) republish(msg *sarama.ConsumerMessage) error {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+1)
+
+	for _, header := range msg.Headers {
+		if header == nil || strings.HasPrefix(string(header.Key), deadLetterHeaderPrefix) {
+			continue
+		}
+
+		headers = append(headers, *header)
+	}
+
+	headers = append(headers, sarama.RecordHeader{
+		Key:   []byte(HeaderReplayedFrom),
+		Value: []byte(fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)),
+	})
+
+	replayed := &sarama.ProducerMessage{
+		Topic:   r.targetTopic,
+		Key:     sarama.ByteEncoder(msg.Key),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+
+	_, _, err := r.producer.SendMessage(replayed)
+
+	return err
+}
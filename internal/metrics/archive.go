@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ArchivedMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "archive",
+		Name:      "archived_messages_total",
+		Help:      "Number of messages moved from the database to the archive.",
+	})
+
+	ArchiveReads = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "archive",
+		Name:      "reads_total",
+		Help:      "Number of history pages that needed messages from the archive.",
+	})
+)
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "lag",
+		Help:      "Number of messages in a partition not consumed yet.",
+	}, []string{"topic", "partition"})
+
+	ConsumerCommandsHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "commands_handled_total",
+		Help:      "Number of consumed commands by command type and outcome.",
+	}, []string{"command", "outcome"})
+
+	ConsumerHandleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "handle_duration_seconds",
+		Help:      "Time taken to handle a command or a batch of commands including retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command"})
+
+	ConsumerRebalances = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "rebalances_total",
+		Help:      "Number of consumer group sessions started after a rebalance.",
+	})
+
+	ConsumerDeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "dead_letters_total",
+		Help:      "Number of commands moved to the dead-letter topic.",
+	}, []string{"command"})
+)
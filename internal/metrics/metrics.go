@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dialogue_service"
+
+// NewServer creates an HTTP server exposing the collected metrics on /metrics.
+func NewServer(port int) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+}
+
+func Serve(server *http.Server) {
+	err := server.ListenAndServe()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error(fmt.Sprintf("Metrics server stopped: %v", err))
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	OutboxUnsentMessages = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "unsent_messages",
+		Help:      "Number of outbox messages not published yet.",
+	})
+
+	OutboxOldestUnsentAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "oldest_unsent_age_seconds",
+		Help:      "Age of the oldest outbox message not published yet.",
+	})
+
+	OutboxPublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "publish_duration_seconds",
+		Help:      "Time taken to publish an outbox message.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type", "topic"})
+
+	OutboxDeliveryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "delivery_latency_seconds",
+		Help:      "Time from storing an outbox message to publishing it.",
+		Buckets:   []float64{0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	}, []string{"type", "topic"})
+
+	OutboxPublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "publish_errors_total",
+		Help:      "Number of failed attempts to publish an outbox message.",
+	}, []string{"type", "topic"})
+
+	OutboxBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "batch_size",
+		Help:      "Number of outbox messages fetched for publishing at once.",
+		Buckets:   []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	})
+)
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	MessagePartitions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "partitions",
+		Name:      "attached",
+		Help:      "Number of partitions attached to the messages table after the last maintenance pass.",
+	})
+
+	MessagePartitionsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "partitions",
+		Name:      "created_total",
+		Help:      "Number of partitions of the messages table created ahead of time.",
+	})
+
+	MessagePartitionsDetached = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "partitions",
+		Name:      "detached_total",
+		Help:      "Number of partitions detached from the messages table after the retention period.",
+	})
+)
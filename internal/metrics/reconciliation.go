@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ReconciliationCheckedCounters = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconciliation",
+		Name:      "checked_counters_total",
+		Help:      "Number of unread counters compared with the counter service.",
+	})
+
+	ReconciliationDriftedCounters = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconciliation",
+		Name:      "drifted_counters_total",
+		Help:      "Number of unread counters found drifted and corrected.",
+	})
+)
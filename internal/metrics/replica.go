@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ReplicaLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "replica",
+		Name:      "lag_seconds",
+		Help:      "How far the read replica was behind the primary at the last check.",
+	})
+
+	ReplicaInUse = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "replica",
+		Name:      "in_use",
+		Help:      "Whether the history of chats is read from the replica (1) or from the primary (0).",
+	})
+)
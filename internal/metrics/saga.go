@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	SagaRejectedTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "saga",
+		Name:      "rejected_transitions_total",
+		Help:      "Number of message state transitions rejected by the state machine or a concurrent update.",
+	}, []string{"to"})
+
+	SagaStuckMessages = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "saga",
+		Name:      "stuck_messages",
+		Help:      "Number of pending messages past the deadline found by the last reaper pass.",
+	})
+
+	SagaReemits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "saga",
+		Name:      "reemits_total",
+		Help:      "Number of saga commands re-emitted for stuck messages.",
+	})
+
+	SagaForcedResolutions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "saga",
+		Name:      "forced_resolutions_total",
+		Help:      "Number of stuck messages resolved by the reaper after running out of re-emits.",
+	}, []string{"resolution"})
+
+	SagaReapFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "saga",
+		Name:      "reap_failures_total",
+		Help:      "Number of stuck messages the reaper failed to re-emit or resolve.",
+	}, []string{"action"})
+)
@@ -0,0 +1,104 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/migrations"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// Migrator applies the embedded migrations. Every operation holds a Postgres advisory lock, so
+// replicas starting at the same time do not migrate concurrently.
+type Migrator struct {
+	provider *goose.Provider
+}
+
+func New(db *sql.DB, cfg config.MigrationsConfig) (*Migrator, error) {
+	var excludes []string
+
+	if cfg.SkipCitus {
+		var err error
+		excludes, err = fs.Glob(migrations.FS, migrations.DistributedPattern)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	locker, err := lock.NewPostgresSessionLocker()
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := goose.NewProvider(
+		goose.DialectPostgres,
+		db,
+		migrations.FS,
+		goose.WithExcludeNames(excludes),
+		goose.WithSessionLocker(locker))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		provider: provider,
+	}, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	results, err := m.provider.Up(ctx)
+
+	for _, result := range results {
+		if result.Error == nil {
+			slog.InfoContext(ctx, fmt.Sprintf("Migration %v applied in %v", result.Source.Path, result.Duration))
+		}
+	}
+
+	return results, err
+}
+
+// Down rolls back the last applied migration.
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	result, err := m.provider.Down(ctx)
+
+	if err == nil {
+		slog.InfoContext(ctx, fmt.Sprintf("Migration %v rolled back in %v", result.Source.Path, result.Duration))
+	}
+
+	return result, err
+}
+
+// PendingManual returns the pending migrations that must be applied with the service stopped.
+func (m *Migrator) PendingManual(ctx context.Context) ([]string, error) {
+	statuses, err := m.provider.Status(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, status := range statuses {
+		name := path.Base(status.Source.Path)
+
+		if matches, _ := path.Match(migrations.ManualPattern, name); matches && status.State == goose.StatePending {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	return m.provider.Status(ctx)
+}
@@ -0,0 +1,115 @@
+package migrator
+
+import (
+	"database/sql"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/migrations"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+func TestDistributedMigrationsFollowNamingConvention(t *testing.T) {
+	names, err := fs.Glob(migrations.FS, "*.sql")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		content, err := fs.ReadFile(migrations.FS, name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		distributes := strings.Contains(string(content), "create_distributed_table")
+		checksCitus := strings.Contains(string(content), migrations.CitusCheck)
+		matches, _ := path.Match(migrations.DistributedPattern, name)
+
+		if matches && (!distributes || checksCitus) {
+			t.Errorf("migration %v named as distributed must distribute tables unconditionally", name)
+		}
+
+		if distributes && !matches && !checksCitus {
+			t.Errorf("migration %v distributes tables without checking for Citus", name)
+		}
+	}
+}
+
+func TestMigrationsLockingTablesAreManual(t *testing.T) {
+	names, err := fs.Glob(migrations.FS, "*.sql")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		content, err := fs.ReadFile(migrations.FS, name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		locks := strings.Contains(string(content), "lock table")
+		matches, _ := path.Match(migrations.ManualPattern, name)
+
+		if locks != matches {
+			t.Errorf("migration %v locks tables: %v, named as manual: %v", name, locks, matches)
+		}
+	}
+}
+
+func TestNew_SkipsCitusMigrations(t *testing.T) {
+	all := sources(t, config.MigrationsConfig{})
+	plain := sources(t, config.MigrationsConfig{SkipCitus: true})
+
+	distributed, err := fs.Glob(migrations.FS, migrations.DistributedPattern)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(distributed) == 0 {
+		t.Fatal("no distributed migrations found")
+	}
+
+	if len(plain) != len(all)-len(distributed) {
+		t.Fatalf("got %v migrations for plain Postgres, want %v", len(plain), len(all)-len(distributed))
+	}
+
+	for _, name := range plain {
+		if matches, _ := path.Match(migrations.DistributedPattern, name); matches {
+			t.Errorf("migration %v is not skipped", name)
+		}
+	}
+}
+
+func sources(t *testing.T, cfg config.MigrationsConfig) []string {
+	t.Helper()
+
+	// The connection is not opened until a migration is applied.
+	db, err := sql.Open("pgx", "host=localhost")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(db, cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+
+	for _, source := range m.provider.ListSources() {
+		names = append(names, path.Base(source.Path))
+	}
+
+	return names
+}
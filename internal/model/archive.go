@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// ArchiveBlob describes the blob of the archive holding the messages of a chat sent within the month
+// starting at Month. The messages of the blob were sent in [FromSentAt, ToSentAt].
+type ArchiveBlob struct {
+	ChatId       ChatId
+	Month        time.Time
+	Key          string
+	FromSentAt   time.Time
+	ToSentAt     time.Time
+	MessageCount int
+}
+
+// ArchiveMonth returns the start of the month the blob of a message sent at the time belongs to.
+func ArchiveMonth(sentAt time.Time) time.Time {
+	sentAt = sentAt.UTC()
+
+	return time.Date(sentAt.Year(), sentAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
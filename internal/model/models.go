@@ -1,6 +1,11 @@
 package model
 
-import "time"
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
 
 type UserId string
 
@@ -24,6 +29,22 @@ type Message struct {
 	ToUserId   UserId
 	Text       string
 	State      MessageState
+	// CorrelationId identifies the saga the message was created by.
+	CorrelationId string
+}
+
+// VisibleTo reports whether the viewer sees the message. Sent messages are visible to both users of
+// the chat, while the sender also sees their own messages being in one of viewerStates.
+func (m *Message) VisibleTo(viewerId UserId, viewerStates []MessageState) bool {
+	return m.State == MessageStateSent || (m.FromUserId == viewerId && slices.Contains(viewerStates, m.State))
+}
+
+// PendingMessage is a message waiting for the saga to finish along with the number of times the
+// saga command has been emitted for it.
+type PendingMessage struct {
+	Message       *Message
+	EmitAttempts  int
+	LastEmittedAt time.Time
 }
 
 type SendMessageCommand struct {
@@ -32,23 +53,120 @@ type SendMessageCommand struct {
 	Text       string
 }
 
+type ReadMessagesCommand struct {
+	UserId            UserId
+	PeerUserId        UserId
+	LastReadMessageId MessageId
+}
+
+// GetMessagesCommand requests a page of at most Limit messages following Cursor, newest first.
+// Zero Limit returns the whole history.
 type GetMessagesCommand struct {
-	FromUserId UserId
-	ToUserId   UserId
+	FromUserId    UserId
+	ToUserId      UserId
+	IncludeFailed bool
+	Limit         int
+	Cursor        *MessageCursor
+}
+
+// MessagePage is a page of messages, Next is set if there may be more messages after it.
+type MessagePage struct {
+	Messages []*Message
+	Next     *MessageCursor
+}
+
+// MessageCursor points to the last message of a page. Messages are ordered by SentAt and then by
+// MessageId, newest first.
+type MessageCursor struct {
+	SentAt    time.Time
+	MessageId MessageId
+}
+
+func NewMessageCursor(msg *Message) *MessageCursor {
+	return &MessageCursor{
+		SentAt:    msg.SentAt,
+		MessageId: msg.MessageId,
+	}
+}
+
+// Admits reports whether the message comes after the cursor. Every message comes after a nil cursor.
+func (c *MessageCursor) Admits(msg *Message) bool {
+	if c == nil {
+		return true
+	}
+
+	return compareMessageOrder(msg.SentAt, msg.MessageId, c.SentAt, c.MessageId) > 0
+}
+
+// CompareMessages orders messages newest first.
+func CompareMessages(a, b *Message) int {
+	return compareMessageOrder(a.SentAt, a.MessageId, b.SentAt, b.MessageId)
+}
+
+func compareMessageOrder(aSentAt time.Time, aId MessageId, bSentAt time.Time, bId MessageId) int {
+	if c := bSentAt.Compare(aSentAt); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(bId, aId)
 }
 
 type OutboxMessageType int32
 
 const (
-	OutboxMessageTypeAddNewUnreadMessage = 1
+	OutboxMessageTypeAddNewUnreadMessage OutboxMessageType = 1
+	OutboxMessageTypeAdjustUnreadCounter OutboxMessageType = 2
+	OutboxMessageTypeRemoveUnreadMessage OutboxMessageType = 3
 )
 
+var outboxMessageTypeNames = map[OutboxMessageType]string{
+	OutboxMessageTypeAddNewUnreadMessage: "add_new_unread_message",
+	OutboxMessageTypeAdjustUnreadCounter: "adjust_unread_counter",
+	OutboxMessageTypeRemoveUnreadMessage: "remove_unread_message",
+}
+
+func OutboxMessageTypes() []OutboxMessageType {
+	types := make([]OutboxMessageType, 0, len(outboxMessageTypeNames))
+
+	for messageType := range outboxMessageTypeNames {
+		types = append(types, messageType)
+	}
+
+	return types
+}
+
+func ParseOutboxMessageType(name string) (OutboxMessageType, error) {
+	for messageType, typeName := range outboxMessageTypeNames {
+		if typeName == name {
+			return messageType, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown outbox message type: %v", name)
+}
+
+func (t OutboxMessageType) String() string {
+	if name, ok := outboxMessageTypeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("OutboxMessageType(%d)", int32(t))
+}
+
 type OutboxMessage struct {
-	Id           int64
-	Type         OutboxMessageType
-	MessageKey   any
-	MessageValue any
-	IsSent       bool
+	Id        int64
+	Type      OutboxMessageType
+	Topic     string
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	IsSent    bool
+	CreatedAt time.Time
+}
+
+type OutboxBacklog struct {
+	UnsentCount    int64
+	OldestUnsentAt time.Time
 }
 
 type AddNewUnreadMessage struct {
@@ -58,6 +176,23 @@ type AddNewUnreadMessage struct {
 	MessageId     MessageId
 }
 
+// RemoveUnreadMessage compensates the AddNewUnreadMessage with the same CorrelationId. The counter
+// service undoes the increment only if it has applied that command.
+type RemoveUnreadMessage struct {
+	CorrelationId string
+	UserId        UserId
+	ChatId        ChatId
+	MessageId     MessageId
+}
+
+// AdjustUnreadCounter corrects the unread counter of the user in the chat by Delta.
+type AdjustUnreadCounter struct {
+	CorrelationId string
+	UserId        UserId
+	ChatId        ChatId
+	Delta         int64
+}
+
 type CommitMessageCommand struct {
 	CorrelationId string
 	MessageId     MessageId
@@ -67,3 +202,25 @@ type RollbackMessageCommand struct {
 	CorrelationId string
 	MessageId     MessageId
 }
+
+// CommandBatch holds saga commands for different messages that are applied at once.
+type CommandBatch struct {
+	Commits   []CommitMessageCommand
+	Rollbacks []RollbackMessageCommand
+}
+
+// UnreadKey identifies the unread counter of a user in a chat.
+type UnreadKey struct {
+	UserId UserId
+	ChatId ChatId
+}
+
+// UnreadAggregate is the number of sent messages in the chat the user has not read yet.
+// UnreadAggregate is the unread counter computed from the messages. LastMessageId and LastReadMessageId
+// identify the state of the chat the counter was computed for.
+type UnreadAggregate struct {
+	Key               UnreadKey
+	Count             int64
+	LastMessageId     MessageId
+	LastReadMessageId MessageId
+}
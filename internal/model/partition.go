@@ -0,0 +1,47 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	messagePartitionPrefix = "messages_p"
+	messagePartitionLayout = "2006_01"
+)
+
+// MessagePartition is a monthly partition of the messages table holding messages sent in [From, To).
+type MessagePartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// NewMessagePartition returns the partition for the month the time falls into.
+func NewMessagePartition(t time.Time) MessagePartition {
+	t = t.UTC()
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	return MessagePartition{
+		Name: messagePartitionPrefix + from.Format(messagePartitionLayout),
+		From: from,
+		To:   from.AddDate(0, 1, 0),
+	}
+}
+
+func ParseMessagePartition(name string) (MessagePartition, error) {
+	month, ok := strings.CutPrefix(name, messagePartitionPrefix)
+
+	if !ok {
+		return MessagePartition{}, fmt.Errorf("%v is not a messages partition", name)
+	}
+
+	from, err := time.Parse(messagePartitionLayout, month)
+
+	if err != nil {
+		return MessagePartition{}, fmt.Errorf("%v is not a messages partition: %w", name, err)
+	}
+
+	return NewMessagePartition(from), nil
+}
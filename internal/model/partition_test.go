@@ -0,0 +1,25 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMessagePartition(t *testing.T) {
+	partition, err := ParseMessagePartition("messages_p2024_12")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !partition.From.Equal(time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)) ||
+		!partition.To.Equal(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got partition bounds [%v, %v)", partition.From, partition.To)
+	}
+
+	_, err = ParseMessagePartition("messages_archive")
+
+	if err == nil {
+		t.Error("got no error for a partition not following the naming")
+	}
+}
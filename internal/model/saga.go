@@ -0,0 +1,67 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrInvalidStateTransition = errors.New("invalid message state transition")
+
+var messageStateNames = map[MessageState]string{
+	MessageStateSent:    "sent",
+	MessageStatePending: "pending",
+	MessageStateRemoved: "removed",
+}
+
+// A message is created pending and stays so until the saga either commits or rolls it back.
+// Sent and removed are final.
+var messageStateTransitions = map[MessageState][]MessageState{
+	MessageStatePending: {MessageStateSent, MessageStateRemoved},
+}
+
+func (s MessageState) String() string {
+	if name, ok := messageStateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("MessageState(%d)", int32(s))
+}
+
+func (s MessageState) CanTransitionTo(next MessageState) bool {
+	for _, allowed := range messageStateTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PreviousStates returns the states a message can be moved to the next state from.
+func PreviousStates(next MessageState) []MessageState {
+	var states []MessageState
+
+	for state := range messageStateTransitions {
+		if state.CanTransitionTo(next) {
+			states = append(states, state)
+		}
+	}
+
+	slices.Sort(states)
+
+	return states
+}
+
+// TransitionTo moves the message to the next state and returns the state it was in before.
+func (m *Message) TransitionTo(next MessageState) (MessageState, error) {
+	current := m.State
+
+	if !current.CanTransitionTo(next) {
+		return current, fmt.Errorf("%w: message %v from %v to %v", ErrInvalidStateTransition, m.MessageId, current, next)
+	}
+
+	m.State = next
+
+	return current, nil
+}
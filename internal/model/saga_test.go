@@ -0,0 +1,23 @@
+package model
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPreviousStates(t *testing.T) {
+	tests := []struct {
+		next MessageState
+		want []MessageState
+	}{
+		{next: MessageStateSent, want: []MessageState{MessageStatePending}},
+		{next: MessageStateRemoved, want: []MessageState{MessageStatePending}},
+		{next: MessageStatePending, want: nil},
+	}
+
+	for _, test := range tests {
+		if got := PreviousStates(test.next); !slices.Equal(got, test.want) {
+			t.Errorf("previous states of %v are %v, want %v", test.next, got, test.want)
+		}
+	}
+}
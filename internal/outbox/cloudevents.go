@@ -0,0 +1,41 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/orochi-keydream/dialogue-service/internal/tracing"
+)
+
+// Attributes of CloudEvents in the binary content mode of the Kafka protocol binding.
+const (
+	HeaderId          = "ce_id"
+	HeaderSource      = "ce_source"
+	HeaderType        = "ce_type"
+	HeaderTime        = "ce_time"
+	HeaderSpecVersion = "ce_specversion"
+	HeaderContentType = "content-type"
+
+	cloudEventsSpecVersion = "1.0"
+)
+
+func addCloudEventHeaders(ctx context.Context, headers map[string]string, source, eventType string) {
+	headers[HeaderId] = uuid.NewString()
+	headers[HeaderSource] = source
+	headers[HeaderType] = eventType
+	headers[HeaderTime] = time.Now().UTC().Format(time.RFC3339Nano)
+	headers[HeaderSpecVersion] = cloudEventsSpecVersion
+
+	if requestId, ok := tracing.RequestId(ctx); ok {
+		headers[tracing.RequestIdKey] = requestId
+	}
+
+	if traceContext, ok := tracing.GetTraceContext(ctx); ok {
+		headers[tracing.TraceParentKey] = traceContext.TraceParent
+
+		if traceContext.TraceState != "" {
+			headers[tracing.TraceStateKey] = traceContext.TraceState
+		}
+	}
+}
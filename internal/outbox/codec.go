@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/orochi-keydream/dialogue-service/internal/schemaregistry"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	FormatJson     = "json"
+	FormatProtobuf = "protobuf"
+)
+
+type Codec[T any] interface {
+	Encode(payload T) ([]byte, error)
+	ContentType() string
+}
+
+type ISchemaRegistry interface {
+	Register(ctx context.Context, subject string, schema schemaregistry.Schema) (int, error)
+}
+
+type jsonCodec[T any] struct {
+	toDto func(payload T) any
+}
+
+// JSONCodec encodes a payload as JSON of the DTO returned by toDto.
+func JSONCodec[T any](toDto func(payload T) any) Codec[T] {
+	return &jsonCodec[T]{
+		toDto: toDto,
+	}
+}
+
+func (c *jsonCodec[T]) Encode(payload T) ([]byte, error) {
+	return json.Marshal(c.toDto(payload))
+}
+
+func (c *jsonCodec[T]) ContentType() string {
+	return "application/json"
+}
+
+type protobufCodec[T any] struct {
+	schemaId int
+	toProto  func(payload T) proto.Message
+}
+
+// ProtobufCodec encodes a payload as the protobuf message returned by toProto framed in the
+// schema registry wire format with the given schema ID.
+func ProtobufCodec[T any](schemaId int, toProto func(payload T) proto.Message) Codec[T] {
+	return &protobufCodec[T]{
+		schemaId: schemaId,
+		toProto:  toProto,
+	}
+}
+
+func (c *protobufCodec[T]) Encode(payload T) ([]byte, error) {
+	message := c.toProto(payload)
+
+	bytes, err := proto.Marshal(message)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return schemaregistry.EncodeProtobuf(c.schemaId, message.ProtoReflect().Descriptor(), bytes), nil
+}
+
+func (c *protobufCodec[T]) ContentType() string {
+	return "application/x-protobuf"
+}
@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/orochi-keydream/dialogue-service/api"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/producer"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/proto/events"
+	"github.com/orochi-keydream/dialogue-service/internal/schemaregistry"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProtobufCodec_EncodesWithSchemaRegisteredOnce(t *testing.T) {
+	ctx := context.Background()
+	schemaRegistry := &countingSchemaRegistry{registry: schemaregistry.NewInMemoryRegistry()}
+
+	configs := config.ProducerConfigs{
+		model.OutboxMessageTypeAddNewUnreadMessage.String(): {Topic: "counter_commands"},
+		model.OutboxMessageTypeAdjustUnreadCounter.String(): {Topic: "counter_adjustments", Format: FormatProtobuf},
+		model.OutboxMessageTypeRemoveUnreadMessage.String(): {Topic: "counter_compensations"},
+	}
+
+	router, err := producer.NewRouter(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewRegistry("dialogue-service", router, schemaRegistry)
+
+	err = RegisterEvents(ctx, registry)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if schemaRegistry.registered != 1 {
+		t.Fatalf("got %v schemas registered, want 1", schemaRegistry.registered)
+	}
+
+	schemaId, err := schemaRegistry.Register(ctx, "counter_adjustments-value", schemaregistry.Schema{
+		Type:   schemaregistry.SchemaTypeProtobuf,
+		Schema: api.AdjustUnreadCounterProto,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schemaRegistry.registered = 0
+
+	payload := model.AdjustUnreadCounter{CorrelationId: "adjust-1", UserId: "bob", ChatId: "alice_bob", Delta: -2}
+
+	for range 2 {
+		message, err := NewMessage(ctx, registry, payload)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value := message.Value
+
+		if value[0] != 0 || int(binary.BigEndian.Uint32(value[1:5])) != schemaId {
+			t.Fatalf("got header %v, want magic byte 0 and schema ID %v", value[:5], schemaId)
+		}
+
+		// AdjustUnreadCounter is the only message of its schema, so a single zero stands for its index.
+		if value[5] != 0 {
+			t.Fatalf("got message indexes %v, want the index of the first message", value[5])
+		}
+
+		decoded := &events.AdjustUnreadCounter{}
+
+		if err = proto.Unmarshal(value[6:], decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		want := mapAdjustUnreadCounterToProto(payload)
+
+		if !proto.Equal(decoded, want) {
+			t.Errorf("got payload %v, want %v", decoded, want)
+		}
+
+		if message.Headers[HeaderContentType] != "application/x-protobuf" {
+			t.Errorf("got content type %v", message.Headers[HeaderContentType])
+		}
+	}
+
+	if schemaRegistry.registered != 0 {
+		t.Errorf("encoding registered the schema %v times", schemaRegistry.registered)
+	}
+}
+
+type countingSchemaRegistry struct {
+	registry   *schemaregistry.InMemoryRegistry
+	registered int
+}
+
+func (r *countingSchemaRegistry) Register(ctx context.Context, subject string, schema schemaregistry.Schema) (int, error) {
+	r.registered++
+	return r.registry.Register(ctx, subject, schema)
+}
@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/orochi-keydream/dialogue-service/api"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/proto/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// RegisterEvents registers every event the service publishes through the outbox.
+func RegisterEvents(ctx context.Context, r *Registry) error {
+	err := Register(ctx, r, Event[model.AddNewUnreadMessage]{
+		Type:           model.OutboxMessageTypeAddNewUnreadMessage,
+		CloudEventType: "com.orochi-keydream.dialogue.add_new_unread_message.v1",
+		Key:            func(payload model.AddNewUnreadMessage) []byte { return []byte(payload.ChatId) },
+		JSON:           mapAddNewUnreadMessage,
+		Proto:          mapAddNewUnreadMessageToProto,
+		ProtoSchema:    api.AddNewUnreadMessageProto,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = Register(ctx, r, Event[model.AdjustUnreadCounter]{
+		Type:           model.OutboxMessageTypeAdjustUnreadCounter,
+		CloudEventType: "com.orochi-keydream.dialogue.adjust_unread_counter.v1",
+		Key:            func(payload model.AdjustUnreadCounter) []byte { return []byte(payload.ChatId) },
+		JSON:           mapAdjustUnreadCounter,
+		Proto:          mapAdjustUnreadCounterToProto,
+		ProtoSchema:    api.AdjustUnreadCounterProto,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = Register(ctx, r, Event[model.RemoveUnreadMessage]{
+		Type:           model.OutboxMessageTypeRemoveUnreadMessage,
+		CloudEventType: "com.orochi-keydream.dialogue.remove_unread_message.v1",
+		Key:            func(payload model.RemoveUnreadMessage) []byte { return []byte(payload.ChatId) },
+		JSON:           mapRemoveUnreadMessage,
+		Proto:          mapRemoveUnreadMessageToProto,
+		ProtoSchema:    api.RemoveUnreadMessageProto,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return r.Validate()
+}
+
+type AddNewUnreadMessageDto struct {
+	CorrelationId string `json:"correlationId"`
+	UserId        string `json:"userId"`
+	ChatId        string `json:"chatId"`
+	MessageId     int64  `json:"messageId"`
+}
+
+func mapAddNewUnreadMessage(payload model.AddNewUnreadMessage) any {
+	return AddNewUnreadMessageDto{
+		CorrelationId: payload.CorrelationId,
+		UserId:        string(payload.UserId),
+		ChatId:        string(payload.ChatId),
+		MessageId:     int64(payload.MessageId),
+	}
+}
+
+func mapAddNewUnreadMessageToProto(payload model.AddNewUnreadMessage) proto.Message {
+	return &events.AddNewUnreadMessage{
+		CorrelationId: payload.CorrelationId,
+		UserId:        string(payload.UserId),
+		ChatId:        string(payload.ChatId),
+		MessageId:     int64(payload.MessageId),
+	}
+}
+
+type RemoveUnreadMessageDto struct {
+	CorrelationId string `json:"correlationId"`
+	UserId        string `json:"userId"`
+	ChatId        string `json:"chatId"`
+	MessageId     int64  `json:"messageId"`
+}
+
+func mapRemoveUnreadMessage(payload model.RemoveUnreadMessage) any {
+	return RemoveUnreadMessageDto{
+		CorrelationId: payload.CorrelationId,
+		UserId:        string(payload.UserId),
+		ChatId:        string(payload.ChatId),
+		MessageId:     int64(payload.MessageId),
+	}
+}
+
+func mapRemoveUnreadMessageToProto(payload model.RemoveUnreadMessage) proto.Message {
+	return &events.RemoveUnreadMessage{
+		CorrelationId: payload.CorrelationId,
+		UserId:        string(payload.UserId),
+		ChatId:        string(payload.ChatId),
+		MessageId:     int64(payload.MessageId),
+	}
+}
+
+type AdjustUnreadCounterDto struct {
+	CorrelationId string `json:"correlationId"`
+	UserId        string `json:"userId"`
+	ChatId        string `json:"chatId"`
+	Delta         int64  `json:"delta"`
+}
+
+func mapAdjustUnreadCounter(payload model.AdjustUnreadCounter) any {
+	return AdjustUnreadCounterDto{
+		CorrelationId: payload.CorrelationId,
+		UserId:        string(payload.UserId),
+		ChatId:        string(payload.ChatId),
+		Delta:         payload.Delta,
+	}
+}
+
+func mapAdjustUnreadCounterToProto(payload model.AdjustUnreadCounter) proto.Message {
+	return &events.AdjustUnreadCounter{
+		CorrelationId: payload.CorrelationId,
+		UserId:        string(payload.UserId),
+		ChatId:        string(payload.ChatId),
+		Delta:         payload.Delta,
+	}
+}
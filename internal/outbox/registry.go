@@ -0,0 +1,184 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/producer"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/schemaregistry"
+	"google.golang.org/protobuf/proto"
+)
+
+// Event describes how an outbox event of type T is keyed and encoded. JSON and Proto map the
+// payload to its representation in the corresponding format, the one configured for the topic is used.
+// CloudEventType is published in the ce_type header.
+type Event[T any] struct {
+	Type           model.OutboxMessageType
+	CloudEventType string
+	Key            func(payload T) []byte
+	JSON           func(payload T) any
+	Proto          func(payload T) proto.Message
+	ProtoSchema    string
+}
+
+type registration[T any] struct {
+	event   Event[T]
+	codec   Codec[T]
+	topic   string
+	headers map[string]string
+}
+
+// Registry holds a registration per event type so that outbox messages are encoded
+// once at insert time and can be published as they are stored. The router decides where
+// every event type is published and in which format.
+type Registry struct {
+	source         string
+	router         *producer.Router
+	schemaRegistry ISchemaRegistry
+	registrations  map[reflect.Type]any
+	types          map[model.OutboxMessageType]reflect.Type
+}
+
+func NewRegistry(source string, router *producer.Router, schemaRegistry ISchemaRegistry) *Registry {
+	return &Registry{
+		source:         source,
+		router:         router,
+		schemaRegistry: schemaRegistry,
+		registrations:  make(map[reflect.Type]any),
+		types:          make(map[model.OutboxMessageType]reflect.Type),
+	}
+}
+
+// Register adds the event to the registry. The protobuf schema of the event is registered in the
+// schema registry right away if the topic is configured to use protobuf, so that encoding messages
+// does not wait for the schema registry.
+func Register[T any](ctx context.Context, r *Registry, event Event[T]) error {
+	payloadType := reflect.TypeFor[T]()
+
+	if _, ok := r.registrations[payloadType]; ok {
+		return fmt.Errorf("event %v is already registered", payloadType)
+	}
+
+	if _, ok := r.types[event.Type]; ok {
+		return fmt.Errorf("message type %v is already registered", event.Type)
+	}
+
+	if event.Key == nil {
+		return fmt.Errorf("key extractor must be specified for %v messages", event.Type)
+	}
+
+	if event.CloudEventType == "" {
+		return fmt.Errorf("CloudEvents type must be specified for %v messages", event.Type)
+	}
+
+	route, err := r.router.Route(event.Type)
+
+	if err != nil {
+		return err
+	}
+
+	codec, err := newCodec(ctx, r, event, route)
+
+	if err != nil {
+		return err
+	}
+
+	r.registrations[payloadType] = &registration[T]{
+		event:   event,
+		codec:   codec,
+		topic:   route.Topic,
+		headers: route.Headers,
+	}
+
+	r.types[event.Type] = payloadType
+
+	return nil
+}
+
+// Validate checks that every known message type has a registration.
+func (r *Registry) Validate() error {
+	for _, messageType := range model.OutboxMessageTypes() {
+		if _, ok := r.types[messageType]; !ok {
+			return fmt.Errorf("no event registered for %v messages", messageType)
+		}
+	}
+
+	return nil
+}
+
+func newCodec[T any](ctx context.Context, r *Registry, event Event[T], route producer.Route) (Codec[T], error) {
+	switch route.Format {
+	case "", FormatJson:
+		if event.JSON == nil {
+			return nil, fmt.Errorf("%v messages cannot be encoded as JSON", event.Type)
+		}
+
+		return JSONCodec(event.JSON), nil
+	case FormatProtobuf:
+		if event.Proto == nil || event.ProtoSchema == "" {
+			return nil, fmt.Errorf("%v messages cannot be encoded as protobuf", event.Type)
+		}
+
+		if r.schemaRegistry == nil {
+			return nil, fmt.Errorf("schema registry is required to encode %v messages as protobuf", event.Type)
+		}
+
+		// Subjects follow the default topic name strategy of the schema registry.
+		subject := route.Topic + "-value"
+
+		schema := schemaregistry.Schema{
+			Type:   schemaregistry.SchemaTypeProtobuf,
+			Schema: event.ProtoSchema,
+		}
+
+		schemaId, err := r.schemaRegistry.Register(ctx, subject, schema)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to register schema for subject %v: %w", subject, err)
+		}
+
+		return ProtobufCodec(schemaId, event.Proto), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %v for %v messages", route.Format, event.Type)
+	}
+}
+
+// NewMessage encodes the payload and attaches the headers it is published with, including
+// CloudEvents attributes and the request and trace context of ctx.
+func NewMessage[T any](ctx context.Context, r *Registry, payload T) (*model.OutboxMessage, error) {
+	payloadType := reflect.TypeFor[T]()
+
+	reg, ok := r.registrations[payloadType].(*registration[T])
+
+	if !ok {
+		return nil, fmt.Errorf("no event registered for %v", payloadType)
+	}
+
+	value, err := reg.codec.Encode(payload)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %v message: %w", reg.event.Type, err)
+	}
+
+	headers := make(map[string]string, len(reg.headers)+8)
+
+	for key, val := range reg.headers {
+		headers[key] = val
+	}
+
+	addCloudEventHeaders(ctx, headers, r.source, reg.event.CloudEventType)
+	headers[HeaderContentType] = reg.codec.ContentType()
+
+	message := &model.OutboxMessage{
+		Type:    reg.event.Type,
+		Topic:   reg.topic,
+		Key:     reg.event.Key(payload),
+		Value:   value,
+		Headers: headers,
+		IsSent:  false,
+	}
+
+	return message, nil
+}
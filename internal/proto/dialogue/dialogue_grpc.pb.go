@@ -19,8 +19,9 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	DialogueService_GetMessagesV1_FullMethodName = "/dialogue.DialogueService/GetMessagesV1"
-	DialogueService_SendMessageV1_FullMethodName = "/dialogue.DialogueService/SendMessageV1"
+	DialogueService_GetMessagesV1_FullMethodName  = "/dialogue.DialogueService/GetMessagesV1"
+	DialogueService_SendMessageV1_FullMethodName  = "/dialogue.DialogueService/SendMessageV1"
+	DialogueService_ReadMessagesV1_FullMethodName = "/dialogue.DialogueService/ReadMessagesV1"
 )
 
 // DialogueServiceClient is the client API for DialogueService service.
@@ -29,6 +30,7 @@ const (
 type DialogueServiceClient interface {
 	GetMessagesV1(ctx context.Context, in *GetMessagesV1Request, opts ...grpc.CallOption) (*GetMessagesV1Response, error)
 	SendMessageV1(ctx context.Context, in *SendMessageV1Request, opts ...grpc.CallOption) (*SendMessageV1Response, error)
+	ReadMessagesV1(ctx context.Context, in *ReadMessagesV1Request, opts ...grpc.CallOption) (*ReadMessagesV1Response, error)
 }
 
 type dialogueServiceClient struct {
@@ -57,12 +59,22 @@ func (c *dialogueServiceClient) SendMessageV1(ctx context.Context, in *SendMessa
 	return out, nil
 }
 
+func (c *dialogueServiceClient) ReadMessagesV1(ctx context.Context, in *ReadMessagesV1Request, opts ...grpc.CallOption) (*ReadMessagesV1Response, error) {
+	out := new(ReadMessagesV1Response)
+	err := c.cc.Invoke(ctx, DialogueService_ReadMessagesV1_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DialogueServiceServer is the server API for DialogueService service.
 // All implementations must embed UnimplementedDialogueServiceServer
 // for forward compatibility
 type DialogueServiceServer interface {
 	GetMessagesV1(context.Context, *GetMessagesV1Request) (*GetMessagesV1Response, error)
 	SendMessageV1(context.Context, *SendMessageV1Request) (*SendMessageV1Response, error)
+	ReadMessagesV1(context.Context, *ReadMessagesV1Request) (*ReadMessagesV1Response, error)
 	mustEmbedUnimplementedDialogueServiceServer()
 }
 
@@ -76,6 +88,9 @@ func (UnimplementedDialogueServiceServer) GetMessagesV1(context.Context, *GetMes
 func (UnimplementedDialogueServiceServer) SendMessageV1(context.Context, *SendMessageV1Request) (*SendMessageV1Response, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendMessageV1 not implemented")
 }
+func (UnimplementedDialogueServiceServer) ReadMessagesV1(context.Context, *ReadMessagesV1Request) (*ReadMessagesV1Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadMessagesV1 not implemented")
+}
 func (UnimplementedDialogueServiceServer) mustEmbedUnimplementedDialogueServiceServer() {}
 
 // UnsafeDialogueServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -125,6 +140,24 @@ func _DialogueService_SendMessageV1_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DialogueService_ReadMessagesV1_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadMessagesV1Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DialogueServiceServer).ReadMessagesV1(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DialogueService_ReadMessagesV1_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DialogueServiceServer).ReadMessagesV1(ctx, req.(*ReadMessagesV1Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DialogueService_ServiceDesc is the grpc.ServiceDesc for DialogueService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -140,6 +173,100 @@ var DialogueService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendMessageV1",
 			Handler:    _DialogueService_SendMessageV1_Handler,
 		},
+		{
+			MethodName: "ReadMessagesV1",
+			Handler:    _DialogueService_ReadMessagesV1_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "dialogue.proto",
+}
+
+const (
+	DialogueAdminService_ReplayDeadLettersV1_FullMethodName = "/dialogue.DialogueAdminService/ReplayDeadLettersV1"
+)
+
+// DialogueAdminServiceClient is the client API for DialogueAdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DialogueAdminServiceClient interface {
+	ReplayDeadLettersV1(ctx context.Context, in *ReplayDeadLettersV1Request, opts ...grpc.CallOption) (*ReplayDeadLettersV1Response, error)
+}
+
+type dialogueAdminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDialogueAdminServiceClient(cc grpc.ClientConnInterface) DialogueAdminServiceClient {
+	return &dialogueAdminServiceClient{cc}
+}
+
+func (c *dialogueAdminServiceClient) ReplayDeadLettersV1(ctx context.Context, in *ReplayDeadLettersV1Request, opts ...grpc.CallOption) (*ReplayDeadLettersV1Response, error) {
+	out := new(ReplayDeadLettersV1Response)
+	err := c.cc.Invoke(ctx, DialogueAdminService_ReplayDeadLettersV1_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DialogueAdminServiceServer is the server API for DialogueAdminService service.
+// All implementations must embed UnimplementedDialogueAdminServiceServer
+// for forward compatibility
+type DialogueAdminServiceServer interface {
+	ReplayDeadLettersV1(context.Context, *ReplayDeadLettersV1Request) (*ReplayDeadLettersV1Response, error)
+	mustEmbedUnimplementedDialogueAdminServiceServer()
+}
+
+// UnimplementedDialogueAdminServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedDialogueAdminServiceServer struct {
+}
+
+func (UnimplementedDialogueAdminServiceServer) ReplayDeadLettersV1(context.Context, *ReplayDeadLettersV1Request) (*ReplayDeadLettersV1Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplayDeadLettersV1 not implemented")
+}
+func (UnimplementedDialogueAdminServiceServer) mustEmbedUnimplementedDialogueAdminServiceServer() {}
+
+// UnsafeDialogueAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DialogueAdminServiceServer will
+// result in compilation errors.
+type UnsafeDialogueAdminServiceServer interface {
+	mustEmbedUnimplementedDialogueAdminServiceServer()
+}
+
+func RegisterDialogueAdminServiceServer(s grpc.ServiceRegistrar, srv DialogueAdminServiceServer) {
+	s.RegisterService(&DialogueAdminService_ServiceDesc, srv)
+}
+
+func _DialogueAdminService_ReplayDeadLettersV1_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplayDeadLettersV1Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DialogueAdminServiceServer).ReplayDeadLettersV1(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DialogueAdminService_ReplayDeadLettersV1_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DialogueAdminServiceServer).ReplayDeadLettersV1(ctx, req.(*ReplayDeadLettersV1Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DialogueAdminService_ServiceDesc is the grpc.ServiceDesc for DialogueAdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DialogueAdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dialogue.DialogueAdminService",
+	HandlerType: (*DialogueAdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReplayDeadLettersV1",
+			Handler:    _DialogueAdminService_ReplayDeadLettersV1_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "dialogue.proto",
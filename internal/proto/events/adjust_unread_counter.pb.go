@@ -0,0 +1,177 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        v4.25.3
+// source: adjust_unread_counter.proto
+
+package events
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type AdjustUnreadCounter struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	CorrelationId string `protobuf:"bytes,1,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	UserId        string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ChatId        string `protobuf:"bytes,3,opt,name=chat_id,json=chatId,proto3" json:"chat_id,omitempty"`
+	Delta         int64  `protobuf:"varint,4,opt,name=delta,proto3" json:"delta,omitempty"`
+}
+
+func (x *AdjustUnreadCounter) Reset() {
+	*x = AdjustUnreadCounter{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_adjust_unread_counter_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AdjustUnreadCounter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdjustUnreadCounter) ProtoMessage() {}
+
+func (x *AdjustUnreadCounter) ProtoReflect() protoreflect.Message {
+	mi := &file_adjust_unread_counter_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdjustUnreadCounter.ProtoReflect.Descriptor instead.
+func (*AdjustUnreadCounter) Descriptor() ([]byte, []int) {
+	return file_adjust_unread_counter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AdjustUnreadCounter) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *AdjustUnreadCounter) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *AdjustUnreadCounter) GetChatId() string {
+	if x != nil {
+		return x.ChatId
+	}
+	return ""
+}
+
+func (x *AdjustUnreadCounter) GetDelta() int64 {
+	if x != nil {
+		return x.Delta
+	}
+	return 0
+}
+
+var File_adjust_unread_counter_proto protoreflect.FileDescriptor
+
+var file_adjust_unread_counter_proto_rawDesc = []byte{
+	0x0a, 0x1b, 0x61, 0x64, 0x6a, 0x75, 0x73, 0x74, 0x5f, 0x75, 0x6e, 0x72, 0x65, 0x61, 0x64, 0x5f,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0f, 0x64,
+	0x69, 0x61, 0x6c, 0x6f, 0x67, 0x75, 0x65, 0x2e, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x22, 0x84,
+	0x01, 0x0a, 0x13, 0x41, 0x64, 0x6a, 0x75, 0x73, 0x74, 0x55, 0x6e, 0x72, 0x65, 0x61, 0x64, 0x43,
+	0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x6f, 0x72, 0x72, 0x65, 0x6c,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d,
+	0x63, 0x6f, 0x72, 0x72, 0x65, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x12, 0x17, 0x0a,
+	0x07, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x75, 0x73, 0x65, 0x72, 0x49, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x63, 0x68, 0x61, 0x74, 0x5f, 0x69,
+	0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x68, 0x61, 0x74, 0x49, 0x64, 0x12,
+	0x14, 0x0a, 0x05, 0x64, 0x65, 0x6c, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05,
+	0x64, 0x65, 0x6c, 0x74, 0x61, 0x42, 0x43, 0x5a, 0x41, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x6f, 0x72, 0x6f, 0x63, 0x68, 0x69, 0x2d, 0x6b, 0x65, 0x79, 0x64, 0x72,
+	0x65, 0x61, 0x6d, 0x2f, 0x64, 0x69, 0x61, 0x6c, 0x6f, 0x67, 0x75, 0x65, 0x2d, 0x73, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
+}
+
+var (
+	file_adjust_unread_counter_proto_rawDescOnce sync.Once
+	file_adjust_unread_counter_proto_rawDescData = file_adjust_unread_counter_proto_rawDesc
+)
+
+func file_adjust_unread_counter_proto_rawDescGZIP() []byte {
+	file_adjust_unread_counter_proto_rawDescOnce.Do(func() {
+		file_adjust_unread_counter_proto_rawDescData = protoimpl.X.CompressGZIP(file_adjust_unread_counter_proto_rawDescData)
+	})
+	return file_adjust_unread_counter_proto_rawDescData
+}
+
+var file_adjust_unread_counter_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_adjust_unread_counter_proto_goTypes = []any{
+	(*AdjustUnreadCounter)(nil), // 0: dialogue.events.AdjustUnreadCounter
+}
+var file_adjust_unread_counter_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_adjust_unread_counter_proto_init() }
+func file_adjust_unread_counter_proto_init() {
+	if File_adjust_unread_counter_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_adjust_unread_counter_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*AdjustUnreadCounter); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_adjust_unread_counter_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_adjust_unread_counter_proto_goTypes,
+		DependencyIndexes: file_adjust_unread_counter_proto_depIdxs,
+		MessageInfos:      file_adjust_unread_counter_proto_msgTypes,
+	}.Build()
+	File_adjust_unread_counter_proto = out.File
+	file_adjust_unread_counter_proto_rawDesc = nil
+	file_adjust_unread_counter_proto_goTypes = nil
+	file_adjust_unread_counter_proto_depIdxs = nil
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+// ArchiveIndexRepository keeps the index of the blobs of the archive, one row per chat and month.
+type ArchiveIndexRepository struct {
+	db *sql.DB
+}
+
+func NewArchiveIndexRepository(db *sql.DB) *ArchiveIndexRepository {
+	return &ArchiveIndexRepository{
+		db: db,
+	}
+}
+
+func (r *ArchiveIndexRepository) GetBlobs(ctx context.Context, chatId model.ChatId) ([]*model.ArchiveBlob, error) {
+	const query = `
+		select
+			chat_id,
+			month,
+			blob_key,
+			from_sent_at,
+			to_sent_at,
+			message_count
+		from archive_blobs
+		where chat_id = $1`
+
+	ec := executionContext(ctx, r.db)
+
+	rows, err := ec.QueryContext(ctx, query, chatId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var blobs []*model.ArchiveBlob
+
+	for rows.Next() {
+		blob := &model.ArchiveBlob{}
+
+		err = rows.Scan(
+			&blob.ChatId,
+			&blob.Month,
+			&blob.Key,
+			&blob.FromSentAt,
+			&blob.ToSentAt,
+			&blob.MessageCount)
+
+		if err != nil {
+			return nil, err
+		}
+
+		blobs = append(blobs, blob)
+	}
+
+	return blobs, rows.Err()
+}
+
+func (r *ArchiveIndexRepository) GetNewestSentAt(ctx context.Context, chatId model.ChatId) (time.Time, bool, error) {
+	const query = `
+		select max(to_sent_at)
+		from archive_blobs
+		where chat_id = $1`
+
+	ec := executionContext(ctx, r.db)
+
+	var newest sql.NullTime
+
+	err := ec.QueryRowContext(ctx, query, chatId).Scan(&newest)
+
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return newest.Time, newest.Valid, nil
+}
+
+func (r *ArchiveIndexRepository) SaveBlob(ctx context.Context, blob *model.ArchiveBlob) error {
+	const query = `
+		insert into archive_blobs
+		(
+			chat_id,
+			month,
+			blob_key,
+			from_sent_at,
+			to_sent_at,
+			message_count,
+			updated_at
+		)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (chat_id, month) do update
+		set
+			blob_key = excluded.blob_key,
+			from_sent_at = excluded.from_sent_at,
+			to_sent_at = excluded.to_sent_at,
+			message_count = excluded.message_count,
+			updated_at = excluded.updated_at`
+
+	ec := executionContext(ctx, r.db)
+
+	_, err := ec.ExecContext(
+		ctx,
+		query,
+		blob.ChatId,
+		blob.Month,
+		blob.Key,
+		blob.FromSentAt,
+		blob.ToSentAt,
+		blob.MessageCount,
+		time.Now().UTC())
+
+	return err
+}
@@ -15,51 +15,64 @@ func NewCommandRepository(db *sql.DB) *CommandRepository {
 	}
 }
 
-func (cr *CommandRepository) Add(ctx context.Context, correlationId string, tx *sql.Tx) error {
-	const query = "insert into handled_commands (correlation_id) values ($1)"
+// Add records the command as handled and reports false if it had been recorded before.
+func (cr *CommandRepository) Add(ctx context.Context, correlationId string) (bool, error) {
+	const query = `
+		insert into handled_commands (correlation_id)
+		values ($1)
+		on conflict (correlation_id) do nothing`
 
-	var ec IExecutionContext
+	ec := executionContext(ctx, cr.db)
 
-	if tx == nil {
-		ec = cr.db
-	} else {
-		ec = tx
-	}
+	res, err := ec.ExecContext(ctx, query, correlationId)
 
-	_, err := ec.ExecContext(ctx, query, correlationId)
+	if err != nil {
+		return false, err
+	}
 
-	return err
-}
+	affected, err := res.RowsAffected()
 
-func (cr *CommandRepository) Exists(ctx context.Context, correlationId string, tx *sql.Tx) (bool, error) {
-	const query = "select true from handled_commands where correlation_id = $1"
+	if err != nil {
+		return false, err
+	}
 
-	var ec IExecutionContext
+	return affected > 0, nil
+}
 
-	if tx == nil {
-		ec = cr.db
-	} else {
-		ec = tx
-	}
+// AddMany records the commands as handled with a single insert and returns the correlation IDs
+// that had not been recorded before.
+func (cr *CommandRepository) AddMany(ctx context.Context, correlationIds []string) ([]string, error) {
+	const query = `
+		insert into handled_commands (correlation_id)
+		select distinct unnest($1::text[])
+		on conflict (correlation_id) do nothing
+		returning correlation_id`
 
-	row := ec.QueryRowContext(ctx, query, correlationId)
+	ec := executionContext(ctx, cr.db)
 
-	err := row.Err()
+	rows, err := ec.QueryContext(ctx, query, correlationIds)
 
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	var exists bool
+	defer func() {
+		_ = rows.Close()
+	}()
 
-	err = row.Scan(&exists)
+	var added []string
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
+	for rows.Next() {
+		var correlationId string
+
+		err = rows.Scan(&correlationId)
+
+		if err != nil {
+			return nil, err
 		}
-		return false, err
+
+		added = append(added, correlationId)
 	}
 
-	return exists, nil
+	return added, rows.Err()
 }
@@ -3,24 +3,28 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"slices"
+	"time"
 
 	"github.com/orochi-keydream/dialogue-service/internal/model"
 )
 
 type DialogRepository struct {
 	db *sql.DB
+	// router serves the reads of the history, which may go to the replica.
+	router *ConnectionRouter
 }
 
-func NewDialogueRepository(conn *sql.DB) *DialogRepository {
+func NewDialogueRepository(conn *sql.DB, router *ConnectionRouter) *DialogRepository {
 	return &DialogRepository{
-		db: conn,
+		db:     conn,
+		router: router,
 	}
 }
 
 func (r *DialogRepository) AddMessage(
 	ctx context.Context,
 	msg *model.Message,
-	tx *sql.Tx,
 ) (model.MessageId, error) {
 	const query = `
 		insert into messages
@@ -30,18 +34,14 @@ func (r *DialogRepository) AddMessage(
 			from_user_id,
 			to_user_id,
 			text,
-			state
+			state,
+			correlation_id,
+			last_emitted_at
 		)
-		values ($1, $2, $3, $4, $5, $6)
+		values ($1, $2, $3, $4, $5, $6, $7, $2)
 		returning message_id`
 
-	var ec IExecutionContext
-
-	if tx == nil {
-		ec = r.db
-	} else {
-		ec = tx
-	}
+	ec := executionContext(ctx, r.db)
 
 	row := ec.QueryRowContext(
 		ctx,
@@ -51,7 +51,8 @@ func (r *DialogRepository) AddMessage(
 		msg.FromUserId,
 		msg.ToUserId,
 		msg.Text,
-		msg.State)
+		msg.State,
+		msg.CorrelationId)
 
 	if row.Err() != nil {
 		return 0, row.Err()
@@ -67,10 +68,18 @@ func (r *DialogRepository) AddMessage(
 	return messageId, nil
 }
 
-func (r *DialogRepository) GetSentMessages(
+// GetVisibleMessages returns at most limit messages of the chat following the cursor, newest first.
+// These are the sent messages along with the messages of the viewer being in one of the given
+// states. Zero limit returns every message. The messages are read from the replica if it is in use,
+// then the messages the viewer has sent recently are read from the primary, so that the viewer sees
+// them even if the replica has not caught up yet.
+func (r *DialogRepository) GetVisibleMessages(
 	ctx context.Context,
 	chatId model.ChatId,
-	tx *sql.Tx,
+	viewerId model.UserId,
+	viewerStates []model.MessageState,
+	cursor *model.MessageCursor,
+	limit int,
 ) ([]*model.Message, error) {
 	const query = `
 		select
@@ -84,26 +93,148 @@ func (r *DialogRepository) GetSentMessages(
 		from messages
 		where
 			chat_id = $1 and
-			state = $2
-		order by sent_at desc
+			(
+				state = $2 or
+				(from_user_id = $3 and state = any ($4))
+			) and
+			($5::timestamp is null or (sent_at, message_id) < ($5, $6))
+		order by sent_at desc, message_id desc
+		limit $7
 		`
 
-	var ec IExecutionContext
+	states := make([]int32, len(viewerStates))
 
-	if tx == nil {
-		ec = r.db
-	} else {
-		ec = tx
+	for i, state := range viewerStates {
+		states[i] = int32(state)
 	}
 
-	state := model.MessageStateSent
+	cursorSentAt, cursorMessageId := cursorArgs(cursor)
+
+	// Null limit returns every row.
+	var rowLimit sql.NullInt64
 
-	rows, err := ec.QueryContext(ctx, query, chatId, state)
+	if limit > 0 {
+		rowLimit = sql.NullInt64{Int64: int64(limit), Valid: true}
+	}
+
+	rows, fromReplica, err := r.router.queryRead(
+		ctx,
+		query,
+		chatId,
+		model.MessageStateSent,
+		viewerId,
+		states,
+		cursorSentAt,
+		cursorMessageId,
+		rowLimit)
 
 	if err != nil {
 		return nil, err
 	}
 
+	messages, err := scanMessages(rows)
+
+	if err != nil || !fromReplica {
+		return messages, err
+	}
+
+	recent, err := r.getRecentMessagesOf(ctx, chatId, viewerId, time.Now().UTC().Add(-r.router.lagWindow), cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeRecentMessages(messages, recent, viewerId, viewerStates, limit), nil
+}
+
+// getRecentMessagesOf reads the messages the user has sent to the chat after the given time from the
+// primary, whatever state they are in.
+func (r *DialogRepository) getRecentMessagesOf(
+	ctx context.Context,
+	chatId model.ChatId,
+	userId model.UserId,
+	sentAfter time.Time,
+	cursor *model.MessageCursor,
+) ([]*model.Message, error) {
+	const query = `
+		select
+			message_id,
+			chat_id,
+			sent_at,
+			from_user_id,
+			to_user_id,
+			text,
+			state
+		from messages
+		where
+			chat_id = $1 and
+			from_user_id = $2 and
+			sent_at > $3 and
+			($4::timestamp is null or (sent_at, message_id) < ($4, $5))
+		`
+
+	cursorSentAt, cursorMessageId := cursorArgs(cursor)
+
+	rows, err := r.db.QueryContext(ctx, query, chatId, userId, sentAfter, cursorSentAt, cursorMessageId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// mergeRecentMessages replaces the messages read from the replica with the recent versions read from
+// the primary and adds the recent messages the replica is missing. Messages no longer visible to the
+// viewer are dropped, and at most limit newest messages are kept.
+func mergeRecentMessages(
+	messages []*model.Message,
+	recent []*model.Message,
+	viewerId model.UserId,
+	viewerStates []model.MessageState,
+	limit int,
+) []*model.Message {
+	if len(recent) == 0 {
+		return messages
+	}
+
+	recentIds := make(map[model.MessageId]struct{}, len(recent))
+	merged := make([]*model.Message, 0, len(messages)+len(recent))
+
+	for _, msg := range recent {
+		recentIds[msg.MessageId] = struct{}{}
+
+		if msg.VisibleTo(viewerId, viewerStates) {
+			merged = append(merged, msg)
+		}
+	}
+
+	for _, msg := range messages {
+		if _, ok := recentIds[msg.MessageId]; !ok {
+			merged = append(merged, msg)
+		}
+	}
+
+	slices.SortFunc(merged, model.CompareMessages)
+
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+
+	return merged
+}
+
+// cursorArgs returns the query arguments of the cursor, nulls if there is no cursor.
+func cursorArgs(cursor *model.MessageCursor) (sql.NullTime, sql.NullInt64) {
+	if cursor == nil {
+		return sql.NullTime{}, sql.NullInt64{}
+	}
+
+	return sql.NullTime{Time: cursor.SentAt, Valid: true}, sql.NullInt64{Int64: int64(cursor.MessageId), Valid: true}
+}
+
+// scanMessages reads the messages selected by the visible messages queries and closes the rows.
+func scanMessages(rows *sql.Rows) ([]*model.Message, error) {
 	defer func() {
 		_ = rows.Close()
 	}()
@@ -113,7 +244,7 @@ func (r *DialogRepository) GetSentMessages(
 	for rows.Next() {
 		var msg model.Message
 
-		err = rows.Scan(
+		err := rows.Scan(
 			&msg.MessageId,
 			&msg.ChatId,
 			&msg.SentAt,
@@ -129,10 +260,10 @@ func (r *DialogRepository) GetSentMessages(
 		messages = append(messages, &msg)
 	}
 
-	return messages, nil
+	return messages, rows.Err()
 }
 
-func (r *DialogRepository) GetMessage(ctx context.Context, id model.MessageId, tx *sql.Tx) (*model.Message, error) {
+func (r *DialogRepository) GetMessage(ctx context.Context, id model.MessageId) (*model.Message, error) {
 	const query = `
 		select
 			message_id,
@@ -145,13 +276,7 @@ func (r *DialogRepository) GetMessage(ctx context.Context, id model.MessageId, t
 		from messages
 		where message_id = $1`
 
-	var ec IExecutionContext
-
-	if tx == nil {
-		ec = r.db
-	} else {
-		ec = tx
-	}
+	ec := executionContext(ctx, r.db)
 
 	row := ec.QueryRowContext(ctx, query, id)
 
@@ -178,21 +303,288 @@ func (r *DialogRepository) GetMessage(ctx context.Context, id model.MessageId, t
 	return message, nil
 }
 
-func (r *DialogRepository) UpdateMessage(ctx context.Context, msg *model.Message, tx *sql.Tx) error {
+// UpdateMessage stores the message state only if the message is still in the expected state, so
+// a transition computed from a stale read is not applied.
+func (r *DialogRepository) UpdateMessage(
+	ctx context.Context,
+	msg *model.Message,
+	expected model.MessageState,
+) (bool, error) {
+	const query = `
+		update messages
+		set state = $1
+		where
+			message_id = $2 and
+			state = $3`
+
+	ec := executionContext(ctx, r.db)
+
+	res, err := ec.ExecContext(ctx, query, msg.State, msg.MessageId, expected)
+
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// UpdateMessagesState moves the messages being in one of the expected states to the given one and
+// returns the IDs of the updated messages.
+func (r *DialogRepository) UpdateMessagesState(
+	ctx context.Context,
+	ids []model.MessageId,
+	expected []model.MessageState,
+	state model.MessageState,
+) ([]model.MessageId, error) {
 	const query = `
 		update messages
 		set state = $1
-		where message_id = $2`
+		where
+			message_id = any ($2) and
+			state = any ($3)
+		returning message_id`
+
+	ec := executionContext(ctx, r.db)
+
+	messageIds := make([]int64, len(ids))
+
+	for i, id := range ids {
+		messageIds[i] = int64(id)
+	}
+
+	expectedStates := make([]int32, len(expected))
+
+	for i, expectedState := range expected {
+		expectedStates[i] = int32(expectedState)
+	}
+
+	rows, err := ec.QueryContext(ctx, query, state, messageIds, expectedStates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var updated []model.MessageId
+
+	for rows.Next() {
+		var id model.MessageId
 
-	var ec IExecutionContext
+		err = rows.Scan(&id)
 
-	if tx == nil {
-		ec = r.db
-	} else {
-		ec = tx
+		if err != nil {
+			return nil, err
+		}
+
+		updated = append(updated, id)
 	}
 
-	_, err := ec.ExecContext(ctx, query, msg.State, msg.MessageId)
+	return updated, rows.Err()
+}
+
+// GetStuckMessages returns pending messages the saga command was last emitted for before the deadline.
+func (r *DialogRepository) GetStuckMessages(
+	ctx context.Context,
+	deadline time.Time,
+	limit int,
+) ([]*model.PendingMessage, error) {
+	const query = `
+		select
+			message_id,
+			chat_id,
+			sent_at,
+			from_user_id,
+			to_user_id,
+			text,
+			state,
+			coalesce(correlation_id, ''),
+			emit_attempts,
+			coalesce(last_emitted_at, sent_at)
+		from messages
+		where
+			state = $1 and
+			sent_at < $2 and
+			coalesce(last_emitted_at, sent_at) < $2
+		order by sent_at
+		limit $3`
+
+	ec := executionContext(ctx, r.db)
+
+	rows, err := ec.QueryContext(ctx, query, model.MessageStatePending, deadline, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var messages []*model.PendingMessage
+
+	for rows.Next() {
+		msg := &model.PendingMessage{
+			Message: &model.Message{},
+		}
+
+		err = rows.Scan(
+			&msg.Message.MessageId,
+			&msg.Message.ChatId,
+			&msg.Message.SentAt,
+			&msg.Message.FromUserId,
+			&msg.Message.ToUserId,
+			&msg.Message.Text,
+			&msg.Message.State,
+			&msg.Message.CorrelationId,
+			&msg.EmitAttempts,
+			&msg.LastEmittedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkReemitted records one more emission of the saga command for a pending message. It reports false
+// if the message is not pending anymore or has been re-emitted concurrently.
+func (r *DialogRepository) MarkReemitted(
+	ctx context.Context,
+	msg *model.PendingMessage,
+	emittedAt time.Time,
+) (bool, error) {
+	const query = `
+		update messages
+		set
+			emit_attempts = emit_attempts + 1,
+			last_emitted_at = $1,
+			correlation_id = $2
+		where
+			message_id = $3 and
+			state = $4 and
+			emit_attempts = $5`
+
+	ec := executionContext(ctx, r.db)
+
+	res, err := ec.ExecContext(
+		ctx,
+		query,
+		emittedAt,
+		msg.Message.CorrelationId,
+		msg.Message.MessageId,
+		model.MessageStatePending,
+		msg.EmitAttempts)
+
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// GetArchivableMessages returns messages sent before the time that are not needed in the database
+// anymore, oldest first. These are failed messages and sent messages already read by the recipient,
+// while unread ones stay to keep unread counters reconcilable.
+func (r *DialogRepository) GetArchivableMessages(
+	ctx context.Context,
+	sentBefore time.Time,
+	limit int,
+) ([]*model.Message, error) {
+	const query = `
+		select
+			m.message_id,
+			m.chat_id,
+			m.sent_at,
+			m.from_user_id,
+			m.to_user_id,
+			m.text,
+			m.state,
+			coalesce(m.correlation_id, '')
+		from messages m
+		left join read_watermarks w on
+			w.chat_id = m.chat_id and
+			w.user_id = m.to_user_id
+		where
+			m.sent_at < $1 and
+			(
+				m.state = $2 or
+				(m.state = $3 and m.message_id <= coalesce(w.last_read_message_id, 0))
+			)
+		order by m.sent_at
+		limit $4`
+
+	ec := executionContext(ctx, r.db)
+
+	rows, err := ec.QueryContext(ctx, query, sentBefore, model.MessageStateRemoved, model.MessageStateSent, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var messages []*model.Message
+
+	for rows.Next() {
+		msg := &model.Message{}
+
+		err = rows.Scan(
+			&msg.MessageId,
+			&msg.ChatId,
+			&msg.SentAt,
+			&msg.FromUserId,
+			&msg.ToUserId,
+			&msg.Text,
+			&msg.State,
+			&msg.CorrelationId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// DeleteMessages deletes the messages of the chat and returns the number of deleted ones.
+func (r *DialogRepository) DeleteMessages(ctx context.Context, chatId model.ChatId, ids []model.MessageId) (int64, error) {
+	const query = "delete from messages where chat_id = $1 and message_id = any ($2)"
+
+	ec := executionContext(ctx, r.db)
+
+	messageIds := make([]int64, len(ids))
+
+	for i, id := range ids {
+		messageIds[i] = int64(id)
+	}
+
+	res, err := ec.ExecContext(ctx, query, chatId, messageIds)
+
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	return res.RowsAffected()
 }
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+func TestMergeRecentMessages(t *testing.T) {
+	const (
+		viewer model.UserId = "viewer"
+		peer   model.UserId = "peer"
+	)
+
+	sentAt := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	message := func(id model.MessageId, from model.UserId, state model.MessageState) *model.Message {
+		return &model.Message{
+			MessageId:  id,
+			ChatId:     "chat",
+			SentAt:     sentAt.Add(time.Duration(id) * time.Second),
+			FromUserId: from,
+			State:      state,
+		}
+	}
+
+	viewerStates := []model.MessageState{model.MessageStatePending}
+
+	cases := []struct {
+		name     string
+		replica  []*model.Message
+		primary  []*model.Message
+		limit    int
+		expected []model.MessageId
+	}{
+		{
+			name:     "nothing recent keeps the replica page",
+			replica:  []*model.Message{message(2, peer, model.MessageStateSent), message(1, viewer, model.MessageStateSent)},
+			expected: []model.MessageId{2, 1},
+		},
+		{
+			name:     "pending message missing in the replica is added",
+			replica:  []*model.Message{message(2, peer, model.MessageStateSent), message(1, viewer, model.MessageStateSent)},
+			primary:  []*model.Message{message(3, viewer, model.MessageStatePending)},
+			expected: []model.MessageId{3, 2, 1},
+		},
+		{
+			name:     "primary version replaces the stale one",
+			replica:  []*model.Message{message(2, viewer, model.MessageStatePending), message(1, peer, model.MessageStateSent)},
+			primary:  []*model.Message{message(2, viewer, model.MessageStateRemoved)},
+			expected: []model.MessageId{1},
+		},
+		{
+			name:     "limit keeps the newest messages",
+			replica:  []*model.Message{message(2, peer, model.MessageStateSent), message(1, peer, model.MessageStateSent)},
+			primary:  []*model.Message{message(3, viewer, model.MessageStatePending)},
+			limit:    2,
+			expected: []model.MessageId{3, 2},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			merged := mergeRecentMessages(c.replica, c.primary, viewer, viewerStates, c.limit)
+
+			if len(merged) != len(c.expected) {
+				t.Fatalf("expected %v messages, got %v", len(c.expected), len(merged))
+			}
+
+			for i, id := range c.expected {
+				if merged[i].MessageId != id {
+					t.Errorf("expected message %v at %v, got %v", id, i, merged[i].MessageId)
+				}
+			}
+		})
+	}
+}
@@ -10,3 +10,15 @@ type IExecutionContext interface {
 	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 }
+
+type txKey struct{}
+
+// executionContext returns the transaction started by TransactionManager.WithinTransaction if ctx carries
+// one, otherwise queries run on the connection pool.
+func executionContext(ctx context.Context, db *sql.DB) IExecutionContext {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+
+	return db
+}
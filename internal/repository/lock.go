@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+)
+
+// AdvisoryLock elects a leader among the replicas with session-level Postgres advisory locks. The lock is
+// held by a connection taken out of the pool, so it is released by Postgres if the replica dies.
+type AdvisoryLock struct {
+	db *sql.DB
+}
+
+func NewAdvisoryLock(db *sql.DB) *AdvisoryLock {
+	return &AdvisoryLock{
+		db: db,
+	}
+}
+
+func (l *AdvisoryLock) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := l.db.Conn(ctx)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := advisoryLockKey(name)
+
+	var locked bool
+
+	err = conn.QueryRowContext(ctx, "select pg_try_advisory_lock($1)", key).Scan(&locked)
+
+	if err != nil || !locked {
+		_ = conn.Close()
+		return nil, false, err
+	}
+
+	unlock := func() {
+		// The lock is released even if the context of the job has been cancelled.
+		_, err := conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", key)
+
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to release advisory lock %v: %v", name, err))
+		}
+
+		_ = conn.Close()
+	}
+
+	return unlock, true, nil
+}
+
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+
+	return int64(h.Sum64())
+}
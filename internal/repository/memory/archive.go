@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+type ArchiveIndexRepository struct {
+	store *Store
+}
+
+func NewArchiveIndexRepository(store *Store) *ArchiveIndexRepository {
+	return &ArchiveIndexRepository{
+		store: store,
+	}
+}
+
+func (r *ArchiveIndexRepository) GetBlobs(ctx context.Context, chatId model.ChatId) ([]*model.ArchiveBlob, error) {
+	var blobs []*model.ArchiveBlob
+
+	err := r.store.run(ctx, func(st *state) error {
+		for key, blob := range st.archiveBlobs {
+			if key.chatId == chatId {
+				copied := blob
+				blobs = append(blobs, &copied)
+			}
+		}
+
+		return nil
+	})
+
+	return blobs, err
+}
+
+func (r *ArchiveIndexRepository) GetNewestSentAt(ctx context.Context, chatId model.ChatId) (time.Time, bool, error) {
+	var (
+		newest time.Time
+		found  bool
+	)
+
+	err := r.store.run(ctx, func(st *state) error {
+		for key, blob := range st.archiveBlobs {
+			if key.chatId == chatId && (!found || blob.ToSentAt.After(newest)) {
+				newest, found = blob.ToSentAt, true
+			}
+		}
+
+		return nil
+	})
+
+	return newest, found, err
+}
+
+func (r *ArchiveIndexRepository) SaveBlob(ctx context.Context, blob *model.ArchiveBlob) error {
+	return r.store.run(ctx, func(st *state) error {
+		st.archiveBlobs[archiveBlobKey{chatId: blob.ChatId, month: blob.Month}] = *blob
+
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+)
+
+type CommandRepository struct {
+	store *Store
+}
+
+func NewCommandRepository(store *Store) *CommandRepository {
+	return &CommandRepository{
+		store: store,
+	}
+}
+
+func (r *CommandRepository) Add(ctx context.Context, correlationId string) (bool, error) {
+	added := false
+
+	err := r.store.run(ctx, func(st *state) error {
+		if _, ok := st.handledCommands[correlationId]; ok {
+			return nil
+		}
+
+		st.handledCommands[correlationId] = struct{}{}
+		added = true
+
+		return nil
+	})
+
+	return added, err
+}
+
+func (r *CommandRepository) AddMany(ctx context.Context, correlationIds []string) ([]string, error) {
+	var added []string
+
+	err := r.store.run(ctx, func(st *state) error {
+		for _, correlationId := range correlationIds {
+			if _, ok := st.handledCommands[correlationId]; ok {
+				continue
+			}
+
+			st.handledCommands[correlationId] = struct{}{}
+			added = append(added, correlationId)
+		}
+
+		return nil
+	})
+
+	return added, err
+}
@@ -0,0 +1,259 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+type DialogueRepository struct {
+	store *Store
+}
+
+func NewDialogueRepository(store *Store) *DialogueRepository {
+	return &DialogueRepository{
+		store: store,
+	}
+}
+
+func (r *DialogueRepository) AddMessage(ctx context.Context, msg *model.Message) (model.MessageId, error) {
+	var messageId model.MessageId
+
+	err := r.store.run(ctx, func(st *state) error {
+		st.lastMessageId++
+		messageId = st.lastMessageId
+
+		record := &messageRecord{
+			message:       *msg,
+			lastEmittedAt: msg.SentAt,
+		}
+
+		record.message.MessageId = messageId
+		st.messages[messageId] = record
+
+		return nil
+	})
+
+	return messageId, err
+}
+
+func (r *DialogueRepository) GetVisibleMessages(
+	ctx context.Context,
+	chatId model.ChatId,
+	viewerId model.UserId,
+	viewerStates []model.MessageState,
+	cursor *model.MessageCursor,
+	limit int,
+) ([]*model.Message, error) {
+	var messages []*model.Message
+
+	err := r.store.run(ctx, func(st *state) error {
+		for _, record := range st.messages {
+			msg := record.message
+
+			if msg.ChatId == chatId && cursor.Admits(&msg) && msg.VisibleTo(viewerId, viewerStates) {
+				messages = append(messages, &msg)
+			}
+		}
+
+		return nil
+	})
+
+	slices.SortFunc(messages, model.CompareMessages)
+
+	if limit > 0 && len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, err
+}
+
+func (r *DialogueRepository) GetMessage(ctx context.Context, id model.MessageId) (*model.Message, error) {
+	var message *model.Message
+
+	err := r.store.run(ctx, func(st *state) error {
+		record, ok := st.messages[id]
+
+		if !ok {
+			return sql.ErrNoRows
+		}
+
+		msg := record.message
+		message = &msg
+
+		return nil
+	})
+
+	return message, err
+}
+
+func (r *DialogueRepository) UpdateMessage(
+	ctx context.Context,
+	msg *model.Message,
+	expected model.MessageState,
+) (bool, error) {
+	updated := false
+
+	err := r.store.run(ctx, func(st *state) error {
+		record, ok := st.messages[msg.MessageId]
+
+		if !ok || record.message.State != expected {
+			return nil
+		}
+
+		record.message.State = msg.State
+		updated = true
+
+		return nil
+	})
+
+	return updated, err
+}
+
+func (r *DialogueRepository) UpdateMessagesState(
+	ctx context.Context,
+	ids []model.MessageId,
+	expected []model.MessageState,
+	next model.MessageState,
+) ([]model.MessageId, error) {
+	var updated []model.MessageId
+
+	err := r.store.run(ctx, func(st *state) error {
+		for _, id := range ids {
+			record, ok := st.messages[id]
+
+			if !ok || !slices.Contains(expected, record.message.State) {
+				continue
+			}
+
+			record.message.State = next
+			updated = append(updated, id)
+		}
+
+		return nil
+	})
+
+	return updated, err
+}
+
+func (r *DialogueRepository) GetStuckMessages(
+	ctx context.Context,
+	deadline time.Time,
+	limit int,
+) ([]*model.PendingMessage, error) {
+	var messages []*model.PendingMessage
+
+	err := r.store.run(ctx, func(st *state) error {
+		for _, record := range st.messages {
+			if record.message.State != model.MessageStatePending {
+				continue
+			}
+
+			if !record.message.SentAt.Before(deadline) || !record.lastEmittedAt.Before(deadline) {
+				continue
+			}
+
+			msg := record.message
+
+			messages = append(messages, &model.PendingMessage{
+				Message:       &msg,
+				EmitAttempts:  record.emitAttempts,
+				LastEmittedAt: record.lastEmittedAt,
+			})
+		}
+
+		return nil
+	})
+
+	slices.SortFunc(messages, func(a, b *model.PendingMessage) int {
+		return cmp.Or(a.Message.SentAt.Compare(b.Message.SentAt), cmp.Compare(a.Message.MessageId, b.Message.MessageId))
+	})
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, err
+}
+
+func (r *DialogueRepository) MarkReemitted(
+	ctx context.Context,
+	msg *model.PendingMessage,
+	emittedAt time.Time,
+) (bool, error) {
+	marked := false
+
+	err := r.store.run(ctx, func(st *state) error {
+		record, ok := st.messages[msg.Message.MessageId]
+
+		if !ok || record.message.State != model.MessageStatePending || record.emitAttempts != msg.EmitAttempts {
+			return nil
+		}
+
+		record.emitAttempts++
+		record.lastEmittedAt = emittedAt
+		record.message.CorrelationId = msg.Message.CorrelationId
+		marked = true
+
+		return nil
+	})
+
+	return marked, err
+}
+
+func (r *DialogueRepository) GetArchivableMessages(
+	ctx context.Context,
+	sentBefore time.Time,
+	limit int,
+) ([]*model.Message, error) {
+	var messages []*model.Message
+
+	err := r.store.run(ctx, func(st *state) error {
+		for _, record := range st.messages {
+			msg := record.message
+
+			if !msg.SentAt.Before(sentBefore) {
+				continue
+			}
+
+			read := st.watermarks[model.UnreadKey{UserId: msg.ToUserId, ChatId: msg.ChatId}]
+
+			if msg.State == model.MessageStateRemoved || (msg.State == model.MessageStateSent && msg.MessageId <= read) {
+				messages = append(messages, &msg)
+			}
+		}
+
+		return nil
+	})
+
+	slices.SortFunc(messages, func(a, b *model.Message) int {
+		return a.SentAt.Compare(b.SentAt)
+	})
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, err
+}
+
+func (r *DialogueRepository) DeleteMessages(ctx context.Context, chatId model.ChatId, ids []model.MessageId) (int64, error) {
+	var deleted int64
+
+	err := r.store.run(ctx, func(st *state) error {
+		for _, id := range ids {
+			if record, ok := st.messages[id]; ok && record.message.ChatId == chatId {
+				delete(st.messages, id)
+				deleted++
+			}
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
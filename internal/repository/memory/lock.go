@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+// LeaderLock is held by a single caller at a time per name, as if every caller were a replica.
+type LeaderLock struct {
+	mu   sync.Mutex
+	held map[string]struct{}
+}
+
+func NewLeaderLock() *LeaderLock {
+	return &LeaderLock{
+		held: make(map[string]struct{}),
+	}
+}
+
+func (l *LeaderLock) TryLock(_ context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.held[name]; ok {
+		return nil, false, nil
+	}
+
+	l.held[name] = struct{}{}
+
+	unlock := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(l.held, name)
+	}
+
+	return unlock, true, nil
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+type OutboxRepository struct {
+	store *Store
+}
+
+func NewOutboxRepository(store *Store) *OutboxRepository {
+	return &OutboxRepository{
+		store: store,
+	}
+}
+
+func (r *OutboxRepository) Add(ctx context.Context, message *model.OutboxMessage) error {
+	return r.store.run(ctx, func(st *state) error {
+		st.lastOutboxId++
+
+		st.outbox[st.lastOutboxId] = &model.OutboxMessage{
+			Id:        st.lastOutboxId,
+			Type:      message.Type,
+			Topic:     message.Topic,
+			Key:       message.Key,
+			Value:     message.Value,
+			Headers:   maps.Clone(message.Headers),
+			IsSent:    false,
+			CreatedAt: time.Now().UTC(),
+		}
+
+		return nil
+	})
+}
+
+func (r *OutboxRepository) GetUnsent(ctx context.Context) ([]*model.OutboxMessage, error) {
+	messages := make([]*model.OutboxMessage, 0)
+
+	err := r.store.run(ctx, func(st *state) error {
+		for _, message := range st.outbox {
+			if message.IsSent {
+				continue
+			}
+
+			copied := *message
+			copied.Headers = maps.Clone(message.Headers)
+			messages = append(messages, &copied)
+		}
+
+		return nil
+	})
+
+	slices.SortFunc(messages, func(a, b *model.OutboxMessage) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+
+	return messages, err
+}
+
+func (r *OutboxRepository) Update(ctx context.Context, messages []*model.OutboxMessage) error {
+	return r.store.run(ctx, func(st *state) error {
+		for _, message := range messages {
+			if stored, ok := st.outbox[message.Id]; ok {
+				stored.IsSent = true
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *OutboxRepository) GetBacklog(ctx context.Context) (model.OutboxBacklog, error) {
+	backlog := model.OutboxBacklog{}
+
+	err := r.store.run(ctx, func(st *state) error {
+		for _, message := range st.outbox {
+			if message.IsSent {
+				continue
+			}
+
+			backlog.UnsentCount++
+
+			if backlog.OldestUnsentAt.IsZero() || message.CreatedAt.Before(backlog.OldestUnsentAt) {
+				backlog.OldestUnsentAt = message.CreatedAt
+			}
+		}
+
+		return nil
+	})
+
+	return backlog, err
+}
@@ -0,0 +1,138 @@
+// Package memory keeps the data of the service in memory. It is meant for tests and for running
+// the service locally without a database.
+package memory
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+type messageRecord struct {
+	message       model.Message
+	emitAttempts  int
+	lastEmittedAt time.Time
+}
+
+type state struct {
+	messages        map[model.MessageId]*messageRecord
+	lastMessageId   model.MessageId
+	outbox          map[int64]*model.OutboxMessage
+	lastOutboxId    int64
+	handledCommands map[string]struct{}
+	watermarks      map[model.UnreadKey]model.MessageId
+	archiveBlobs    map[archiveBlobKey]model.ArchiveBlob
+}
+
+type archiveBlobKey struct {
+	chatId model.ChatId
+	month  time.Time
+}
+
+func newState() *state {
+	return &state{
+		messages:        make(map[model.MessageId]*messageRecord),
+		outbox:          make(map[int64]*model.OutboxMessage),
+		handledCommands: make(map[string]struct{}),
+		watermarks:      make(map[model.UnreadKey]model.MessageId),
+		archiveBlobs:    make(map[archiveBlobKey]model.ArchiveBlob),
+	}
+}
+
+// clone copies the records, so changes made in a transaction are not visible until it commits.
+func (s *state) clone() *state {
+	cloned := &state{
+		messages:        make(map[model.MessageId]*messageRecord, len(s.messages)),
+		lastMessageId:   s.lastMessageId,
+		outbox:          make(map[int64]*model.OutboxMessage, len(s.outbox)),
+		lastOutboxId:    s.lastOutboxId,
+		handledCommands: maps.Clone(s.handledCommands),
+		watermarks:      maps.Clone(s.watermarks),
+		archiveBlobs:    maps.Clone(s.archiveBlobs),
+	}
+
+	for id, record := range s.messages {
+		copied := *record
+		cloned.messages[id] = &copied
+	}
+
+	for id, message := range s.outbox {
+		copied := *message
+		copied.Headers = maps.Clone(message.Headers)
+		cloned.outbox[id] = &copied
+	}
+
+	return cloned
+}
+
+// Store holds the committed state shared by the repositories of the package.
+type Store struct {
+	mu    sync.Mutex
+	state *state
+}
+
+func NewStore() *Store {
+	return &Store{
+		state: newState(),
+	}
+}
+
+type txKey struct{}
+
+type transaction struct {
+	state *state
+}
+
+// run calls fn with the state of the transaction carried by ctx. Without a transaction fn works on
+// the committed state directly, so repository methods check everything before changing anything.
+func (s *Store) run(ctx context.Context, fn func(st *state) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return fn(tx.state)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return fn(s.state)
+}
+
+// TransactionManager runs transactions one at a time on a snapshot of the store, which is as strict
+// as the serializable isolation level. Repositories must be called with the context passed to fn,
+// calling them with an outer context from within a transaction blocks forever.
+type TransactionManager struct {
+	store *Store
+}
+
+func NewTransactionManager(store *Store) *TransactionManager {
+	return &TransactionManager{
+		store: store,
+	}
+}
+
+// WithinTransaction commits the changes made by fn if it succeeds. If fn fails or panics, the changes
+// are discarded. A call within a transaction joins it.
+func (tm *TransactionManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return fn(ctx)
+	}
+
+	tm.store.mu.Lock()
+	defer tm.store.mu.Unlock()
+
+	tx := &transaction{
+		state: tm.store.state.clone(),
+	}
+
+	err := fn(context.WithValue(ctx, txKey{}, tx))
+
+	if err != nil {
+		return err
+	}
+
+	tm.store.state = tx.state
+
+	return nil
+}
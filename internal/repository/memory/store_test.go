@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWithinTransaction_CommitsOnSuccess(t *testing.T) {
+	store := NewStore()
+	commands := NewCommandRepository(store)
+	tm := NewTransactionManager(store)
+
+	err := tm.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		_, err := commands.Add(ctx, "first")
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := commands.Add(context.Background(), "first")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if added {
+		t.Errorf("command added in a committed transaction is missing")
+	}
+}
+
+func TestWithinTransaction_RollsBackOnError(t *testing.T) {
+	store := NewStore()
+	commands := NewCommandRepository(store)
+	tm := NewTransactionManager(store)
+	failure := errors.New("failure")
+
+	err := tm.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		_, err := commands.Add(ctx, "first")
+
+		if err != nil {
+			return err
+		}
+
+		return failure
+	})
+
+	if !errors.Is(err, failure) {
+		t.Fatalf("got error %v, want %v", err, failure)
+	}
+
+	assertNotAdded(t, commands, "first")
+}
+
+func TestWithinTransaction_RollsBackOnPanic(t *testing.T) {
+	store := NewStore()
+	commands := NewCommandRepository(store)
+	tm := NewTransactionManager(store)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("panic is not propagated")
+			}
+		}()
+
+		_ = tm.WithinTransaction(context.Background(), func(ctx context.Context) error {
+			_, _ = commands.Add(ctx, "first")
+			panic("failure")
+		})
+	}()
+
+	assertNotAdded(t, commands, "first")
+}
+
+func TestWithinTransaction_NestedCallJoinsTransaction(t *testing.T) {
+	store := NewStore()
+	commands := NewCommandRepository(store)
+	tm := NewTransactionManager(store)
+	failure := errors.New("failure")
+
+	err := tm.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		err := tm.WithinTransaction(ctx, func(ctx context.Context) error {
+			_, err := commands.Add(ctx, "first")
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return failure
+	})
+
+	if !errors.Is(err, failure) {
+		t.Fatalf("got error %v, want %v", err, failure)
+	}
+
+	assertNotAdded(t, commands, "first")
+}
+
+func assertNotAdded(t *testing.T, commands *CommandRepository, correlationId string) {
+	t.Helper()
+
+	added, err := commands.Add(context.Background(), correlationId)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !added {
+		t.Errorf("command %v from a rolled back transaction is stored", correlationId)
+	}
+}
@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+type UnreadRepository struct {
+	store *Store
+}
+
+func NewUnreadRepository(store *Store) *UnreadRepository {
+	return &UnreadRepository{
+		store: store,
+	}
+}
+
+func (r *UnreadRepository) AdvanceWatermark(
+	ctx context.Context,
+	chatId model.ChatId,
+	userId model.UserId,
+	lastReadMessageId model.MessageId,
+) error {
+	return r.store.run(ctx, func(st *state) error {
+		key := model.UnreadKey{
+			UserId: userId,
+			ChatId: chatId,
+		}
+
+		st.watermarks[key] = max(st.watermarks[key], lastReadMessageId)
+
+		return nil
+	})
+}
+
+func (r *UnreadRepository) GetAggregates(
+	ctx context.Context,
+	after model.UnreadKey,
+	settledBefore time.Time,
+	limit int,
+) ([]*model.UnreadAggregate, error) {
+	type group struct {
+		unread        int64
+		hasPending    bool
+		lastSentAt    time.Time
+		lastMessageId model.MessageId
+		lastReadId    model.MessageId
+	}
+
+	groups := make(map[model.UnreadKey]*group)
+
+	err := r.store.run(ctx, func(st *state) error {
+		archived := make(map[model.ChatId]bool)
+
+		for key := range st.archiveBlobs {
+			archived[key.chatId] = true
+		}
+
+		for _, record := range st.messages {
+			msg := record.message
+
+			key := model.UnreadKey{
+				UserId: msg.ToUserId,
+				ChatId: msg.ChatId,
+			}
+
+			if compareUnreadKeys(key, after) <= 0 || archived[msg.ChatId] {
+				continue
+			}
+
+			lastReadId, read := st.watermarks[key]
+
+			if !read {
+				continue
+			}
+
+			g, ok := groups[key]
+
+			if !ok {
+				g = &group{lastReadId: lastReadId}
+				groups[key] = g
+			}
+
+			if msg.State == model.MessageStateSent && msg.MessageId > lastReadId {
+				g.unread++
+			}
+
+			if msg.State == model.MessageStatePending {
+				g.hasPending = true
+			}
+
+			if msg.SentAt.After(g.lastSentAt) {
+				g.lastSentAt = msg.SentAt
+			}
+
+			g.lastMessageId = max(g.lastMessageId, msg.MessageId)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregates []*model.UnreadAggregate
+
+	for key, g := range groups {
+		if g.hasPending || !g.lastSentAt.Before(settledBefore) {
+			continue
+		}
+
+		aggregates = append(aggregates, &model.UnreadAggregate{
+			Key:               key,
+			Count:             g.unread,
+			LastMessageId:     g.lastMessageId,
+			LastReadMessageId: g.lastReadId,
+		})
+	}
+
+	slices.SortFunc(aggregates, func(a, b *model.UnreadAggregate) int {
+		return compareUnreadKeys(a.Key, b.Key)
+	})
+
+	if len(aggregates) > limit {
+		aggregates = aggregates[:limit]
+	}
+
+	return aggregates, nil
+}
+
+// compareUnreadKeys orders keys by chat and then by user, the same way the Postgres repository does.
+func compareUnreadKeys(a, b model.UnreadKey) int {
+	return cmp.Or(cmp.Compare(a.ChatId, b.ChatId), cmp.Compare(a.UserId, b.UserId))
+}
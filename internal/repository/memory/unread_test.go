@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+func TestGetAggregates_SkipsUnknownWatermarksAndArchivedChats(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	dialogueRepository := NewDialogueRepository(store)
+	unreadRepository := NewUnreadRepository(store)
+	archiveIndexRepository := NewArchiveIndexRepository(store)
+
+	sentAt := time.Now().UTC().Add(-time.Hour)
+
+	add := func(chatId model.ChatId, toUserId model.UserId) model.MessageId {
+		t.Helper()
+
+		id, err := dialogueRepository.AddMessage(ctx, &model.Message{
+			ChatId:     chatId,
+			SentAt:     sentAt,
+			FromUserId: "alice",
+			ToUserId:   toUserId,
+			Text:       "hello",
+			State:      model.MessageStateSent,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return id
+	}
+
+	read := add("alice_bob", "bob")
+	add("alice_bob", "bob")
+	add("alice_carol", "carol")
+	archived := add("alice_dave", "dave")
+	add("alice_dave", "dave")
+
+	for _, key := range []model.UnreadKey{{UserId: "bob", ChatId: "alice_bob"}, {UserId: "dave", ChatId: "alice_dave"}} {
+		lastReadMessageId := read
+
+		if key.UserId == "dave" {
+			lastReadMessageId = archived
+		}
+
+		err := unreadRepository.AdvanceWatermark(ctx, key.ChatId, key.UserId, lastReadMessageId)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := archiveIndexRepository.SaveBlob(ctx, &model.ArchiveBlob{
+		ChatId:       "alice_dave",
+		Month:        model.ArchiveMonth(sentAt),
+		Key:          "chats/alice_dave/blob.jsonl.gz",
+		FromSentAt:   sentAt,
+		ToSentAt:     sentAt,
+		MessageCount: 1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aggregates, err := unreadRepository.GetAggregates(ctx, model.UnreadKey{}, time.Now().UTC(), 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Carol has never read the chat and the messages of dave's chat are partly archived.
+	if len(aggregates) != 1 {
+		t.Fatalf("got %v aggregates, want the one of bob only", len(aggregates))
+	}
+
+	if key := aggregates[0].Key; key.UserId != "bob" || aggregates[0].Count != 1 {
+		t.Errorf("got %v unread messages of %v, want 1 of bob", aggregates[0].Count, key.UserId)
+	}
+}
@@ -4,7 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"time"
+
 	"github.com/orochi-keydream/dialogue-service/internal/model"
 )
 
@@ -18,24 +19,14 @@ func NewOutboxRepository(db *sql.DB) *OutboxRepository {
 	}
 }
 
-func (r *OutboxRepository) Add(ctx context.Context, message *model.OutboxMessage, tx *sql.Tx) error {
-	const query = "insert into outbox (type, message_key, message_value, is_sent) values ($1, $2, $3, $4)"
-
-	var ec IExecutionContext
-
-	if tx != nil {
-		ec = tx
-	} else {
-		ec = r.db
-	}
-
-	messageKeyBytes, err := toMessageKeyBytes(message.MessageKey, message.Type)
+func (r *OutboxRepository) Add(ctx context.Context, message *model.OutboxMessage) error {
+	const query = `
+		insert into outbox (type, topic, message_key, message_value, headers, is_sent)
+		values ($1, $2, $3, $4, $5, $6)`
 
-	if err != nil {
-		return err
-	}
+	ec := executionContext(ctx, r.db)
 
-	messageValueBytes, err := toMessageValueBytes(message.MessageValue, message.Type)
+	headers, err := json.Marshal(message.Headers)
 
 	if err != nil {
 		return err
@@ -43,26 +34,34 @@ func (r *OutboxRepository) Add(ctx context.Context, message *model.OutboxMessage
 
 	dto := OutboxMessageDto{
 		MessageType:  int(message.Type),
-		MessageKey:   string(messageKeyBytes),
-		MessageValue: string(messageValueBytes),
+		Topic:        message.Topic,
+		MessageKey:   message.Key,
+		MessageValue: message.Value,
+		Headers:      string(headers),
 		IsSent:       false,
 	}
 
-	_, err = ec.ExecContext(ctx, query, dto.MessageType, dto.MessageKey, dto.MessageValue, dto.IsSent)
+	_, err = ec.ExecContext(
+		ctx,
+		query,
+		dto.MessageType,
+		dto.Topic,
+		dto.MessageKey,
+		dto.MessageValue,
+		dto.Headers,
+		dto.IsSent)
 
 	return err
 }
 
-func (r *OutboxRepository) GetUnsent(ctx context.Context, tx *sql.Tx) ([]*model.OutboxMessage, error) {
-	const query = "select id, type, message_key, message_value, is_sent from outbox where is_sent = false"
+func (r *OutboxRepository) GetUnsent(ctx context.Context) ([]*model.OutboxMessage, error) {
+	const query = `
+		select id, type, topic, message_key, message_value, headers, is_sent, created_at
+		from outbox
+		where is_sent = false
+		order by id`
 
-	var ec IExecutionContext
-
-	if tx != nil {
-		ec = tx
-	} else {
-		ec = r.db
-	}
+	ec := executionContext(ctx, r.db)
 
 	rows, err := ec.QueryContext(ctx, query)
 
@@ -77,32 +76,37 @@ func (r *OutboxRepository) GetUnsent(ctx context.Context, tx *sql.Tx) ([]*model.
 	for rows.Next() {
 		dto := OutboxMessageDto{}
 
-		err = rows.Scan(&dto.Id, &dto.MessageType, &dto.MessageKey, &dto.MessageValue, &dto.IsSent)
+		err = rows.Scan(
+			&dto.Id,
+			&dto.MessageType,
+			&dto.Topic,
+			&dto.MessageKey,
+			&dto.MessageValue,
+			&dto.Headers,
+			&dto.IsSent,
+			&dto.CreatedAt)
 
 		if err != nil {
 			return nil, err
 		}
 
-		messageType := model.OutboxMessageType(dto.MessageType)
-
-		messageKey, err := fromMessageKeyBytes([]byte(dto.MessageKey), messageType)
-
-		if err != nil {
-			return nil, err
-		}
+		headers := make(map[string]string)
 
-		messageValue, err := fromMessageValueBytes([]byte(dto.MessageValue), messageType)
+		err = json.Unmarshal([]byte(dto.Headers), &headers)
 
 		if err != nil {
 			return nil, err
 		}
 
 		message := &model.OutboxMessage{
-			Id:           dto.Id,
-			Type:         messageType,
-			MessageKey:   messageKey,
-			MessageValue: messageValue,
-			IsSent:       dto.IsSent,
+			Id:        dto.Id,
+			Type:      model.OutboxMessageType(dto.MessageType),
+			Topic:     dto.Topic,
+			Key:       dto.MessageKey,
+			Value:     dto.MessageValue,
+			Headers:   headers,
+			IsSent:    dto.IsSent,
+			CreatedAt: dto.CreatedAt,
 		}
 
 		messages = append(messages, message)
@@ -111,16 +115,10 @@ func (r *OutboxRepository) GetUnsent(ctx context.Context, tx *sql.Tx) ([]*model.
 	return messages, nil
 }
 
-func (r *OutboxRepository) Update(ctx context.Context, messages []*model.OutboxMessage, tx *sql.Tx) error {
+func (r *OutboxRepository) Update(ctx context.Context, messages []*model.OutboxMessage) error {
 	const query = "update outbox set is_sent = $1 where id = any ($2)"
 
-	var ec IExecutionContext
-
-	if tx != nil {
-		ec = tx
-	} else {
-		ec = r.db
-	}
+	ec := executionContext(ctx, r.db)
 
 	messageIds := make([]int64, len(messages))
 
@@ -133,75 +131,37 @@ func (r *OutboxRepository) Update(ctx context.Context, messages []*model.OutboxM
 	return err
 }
 
-func toMessageKeyBytes(key any, messageType model.OutboxMessageType) ([]byte, error) {
-	switch messageType {
-	case model.OutboxMessageTypeAddNewUnreadMessage:
-		s, ok := key.(model.ChatId)
+func (r *OutboxRepository) GetBacklog(ctx context.Context) (model.OutboxBacklog, error) {
+	const query = "select count(*), min(created_at) from outbox where is_sent = false"
 
-		if !ok {
-			return nil, fmt.Errorf("failed to parse message key")
-		}
+	ec := executionContext(ctx, r.db)
 
-		return []byte(s), nil
-	default:
-		return nil, fmt.Errorf("unsupported message type")
-	}
-}
+	var (
+		count          int64
+		oldestUnsentAt sql.NullTime
+	)
 
-func fromMessageKeyBytes(key []byte, messageType model.OutboxMessageType) (any, error) {
-	switch messageType {
-	case model.OutboxMessageTypeAddNewUnreadMessage:
-		return string(key), nil
-	default:
-		return nil, fmt.Errorf("unsupported message type")
-	}
-}
+	err := ec.QueryRowContext(ctx, query).Scan(&count, &oldestUnsentAt)
 
-func toMessageValueBytes(payload any, messageType model.OutboxMessageType) ([]byte, error) {
-	switch messageType {
-	case model.OutboxMessageTypeAddNewUnreadMessage:
-		return mapAddNewUnreadMessage(payload.(model.AddNewUnreadMessage))
-	default:
-		err := fmt.Errorf("unsupported message type")
-		return nil, err
+	if err != nil {
+		return model.OutboxBacklog{}, err
 	}
-}
 
-func mapAddNewUnreadMessage(payload model.AddNewUnreadMessage) ([]byte, error) {
-	jsonDto := struct {
-		CorrelationId string `json:"correlationId"`
-		UserId        string `json:"userId"`
-		ChatId        string `json:"chatId"`
-		MessageId     int64  `json:"messageId"`
-	}{
-		CorrelationId: payload.CorrelationId,
-		UserId:        string(payload.UserId),
-		ChatId:        string(payload.ChatId),
-		MessageId:     int64(payload.MessageId),
+	backlog := model.OutboxBacklog{
+		UnsentCount:    count,
+		OldestUnsentAt: oldestUnsentAt.Time,
 	}
 
-	return json.Marshal(jsonDto)
-}
-
-func fromMessageValueBytes(bytes []byte, messageType model.OutboxMessageType) (any, error) {
-	switch messageType {
-	case model.OutboxMessageTypeAddNewUnreadMessage:
-		message := model.AddNewUnreadMessage{}
-		err := json.Unmarshal(bytes, &message)
-		if err != nil {
-			return nil, err
-		}
-		return message, nil
-	default:
-		err := fmt.Errorf("unsupported message type")
-		return nil, err
-	}
+	return backlog, nil
 }
 
 type OutboxMessageDto struct {
-	Id           int64  `db:"id"`
-	MessageType  int    `db:"type"`
-	MessageKey   string `db:"message_key"`
-	MessageValue string `db:"message_value"`
-	IsSent       bool   `db:"is_sent"`
+	Id           int64     `db:"id"`
+	MessageType  int       `db:"type"`
+	Topic        string    `db:"topic"`
+	MessageKey   []byte    `db:"message_key"`
+	MessageValue []byte    `db:"message_value"`
+	Headers      string    `db:"headers"`
+	IsSent       bool      `db:"is_sent"`
+	CreatedAt    time.Time `db:"created_at"`
 }
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+const partitionBoundLayout = "2006-01-02"
+
+type PartitionRepository struct {
+	db *sql.DB
+}
+
+func NewPartitionRepository(db *sql.DB) *PartitionRepository {
+	return &PartitionRepository{
+		db: db,
+	}
+}
+
+// GetMessagePartitions returns the partitions attached to the messages table.
+func (r *PartitionRepository) GetMessagePartitions(ctx context.Context) ([]model.MessagePartition, error) {
+	const query = `
+		select c.relname
+		from pg_inherits i
+		join pg_class c on c.oid = i.inhrelid
+		where i.inhparent = 'messages'::regclass
+		order by c.relname`
+
+	ec := executionContext(ctx, r.db)
+
+	rows, err := ec.QueryContext(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var partitions []model.MessagePartition
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		partition, err := model.ParseMessagePartition(name)
+
+		if err != nil {
+			slog.WarnContext(ctx, fmt.Sprintf("Skipping partition not managed by the service: %v", err))
+			continue
+		}
+
+		partitions = append(partitions, partition)
+	}
+
+	return partitions, rows.Err()
+}
+
+func (r *PartitionRepository) CreateMessagePartition(ctx context.Context, partition model.MessagePartition) error {
+	query := fmt.Sprintf(
+		"create table if not exists %v partition of messages for values from ('%v') to ('%v')",
+		pgx.Identifier{partition.Name}.Sanitize(),
+		partition.From.Format(partitionBoundLayout),
+		partition.To.Format(partitionBoundLayout))
+
+	ec := executionContext(ctx, r.db)
+
+	_, err := ec.ExecContext(ctx, query)
+
+	return err
+}
+
+// HasMessages reports whether any message is left in the partition.
+func (r *PartitionRepository) HasMessages(ctx context.Context, partition model.MessagePartition) (bool, error) {
+	query := fmt.Sprintf("select exists (select from %v)", pgx.Identifier{partition.Name}.Sanitize())
+
+	ec := executionContext(ctx, r.db)
+
+	var hasMessages bool
+
+	err := ec.QueryRowContext(ctx, query).Scan(&hasMessages)
+
+	return hasMessages, err
+}
+
+// DetachMessagePartition detaches the partition from the messages table, the table itself is kept.
+func (r *PartitionRepository) DetachMessagePartition(ctx context.Context, partition model.MessagePartition) error {
+	query := fmt.Sprintf("alter table messages detach partition %v", pgx.Identifier{partition.Name}.Sanitize())
+
+	ec := executionContext(ctx, r.db)
+
+	_, err := ec.ExecContext(ctx, query)
+
+	return err
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionRouter sends read-only queries to the replica while it is in use and every other query to
+// the primary. The replica is out of use until UseReplica enables it. Writes made within lagWindow may
+// be missing in the replica.
+type ConnectionRouter struct {
+	primary *sql.DB
+	// replica is nil if not configured.
+	replica    *sql.DB
+	lagWindow  time.Duration
+	useReplica atomic.Bool
+}
+
+func NewConnectionRouter(primary *sql.DB, replica *sql.DB, lagWindow time.Duration) *ConnectionRouter {
+	return &ConnectionRouter{
+		primary:   primary,
+		replica:   replica,
+		lagWindow: lagWindow,
+	}
+}
+
+// UseReplica enables or disables reading from the replica.
+func (r *ConnectionRouter) UseReplica(use bool) {
+	r.useReplica.Store(use)
+}
+
+// GetReplicaLag returns how far the replica is behind the primary. A replica having replayed everything
+// it received is not lagging, even if nothing has been written to the primary for a while.
+func (r *ConnectionRouter) GetReplicaLag(ctx context.Context) (time.Duration, error) {
+	const query = `
+		select
+			case
+				when not pg_is_in_recovery() then 0::float8
+				when pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() then 0::float8
+				else extract(epoch from now() - pg_last_xact_replay_timestamp())::float8
+			end`
+
+	if r.replica == nil {
+		return 0, errors.New("replica is not configured")
+	}
+
+	var lag sql.NullFloat64
+	err := r.replica.QueryRowContext(ctx, query).Scan(&lag)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !lag.Valid {
+		return 0, errors.New("replica has not replayed any transaction yet")
+	}
+
+	return time.Duration(lag.Float64 * float64(time.Second)), nil
+}
+
+// queryRead runs a read-only query in the transaction ctx carries, otherwise on the replica if it is in
+// use. The query is retried on the primary if the replica fails. It reports whether the rows come from
+// the replica.
+func (r *ConnectionRouter) queryRead(ctx context.Context, query string, args ...any) (*sql.Rows, bool, error) {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		return rows, false, err
+	}
+
+	if r.replica != nil && r.useReplica.Load() {
+		rows, err := r.replica.QueryContext(ctx, query, args...)
+
+		if err == nil || ctx.Err() != nil {
+			return rows, err == nil, err
+		}
+
+		slog.WarnContext(ctx, fmt.Sprintf("Reading from the primary after the replica failed: %v", err))
+	}
+
+	rows, err := r.primary.QueryContext(ctx, query, args...)
+
+	return rows, false, err
+}
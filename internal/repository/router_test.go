@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestConnectionRouter_ReadsFromReplicaWhileInUse(t *testing.T) {
+	primary := openFakeDb(t, "primary")
+	replica := openFakeDb(t, "replica")
+	router := NewConnectionRouter(primary.db, replica.db, 0)
+	ctx := context.Background()
+
+	steps := []struct {
+		name        string
+		useReplica  bool
+		replicaErr  error
+		wantReplica bool
+	}{
+		{name: "replica out of use", wantReplica: false},
+		{name: "replica in use", useReplica: true, wantReplica: true},
+		{name: "failed replica falls back to primary", useReplica: true, replicaErr: errors.New("connection refused")},
+		{name: "replica out of use again", useReplica: false, wantReplica: false},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			router.UseReplica(step.useReplica)
+
+			replica.setErr(step.replicaErr)
+			primaryQueries, replicaQueries := primary.queryCount(), replica.queryCount()
+
+			rows, fromReplica, err := router.queryRead(ctx, "select 1")
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_ = rows.Close()
+
+			if fromReplica != step.wantReplica {
+				t.Errorf("expected from replica %v, got %v", step.wantReplica, fromReplica)
+			}
+
+			if got := primary.queryCount() - primaryQueries; step.wantReplica && got != 0 || !step.wantReplica && got != 1 {
+				t.Errorf("unexpected %v queries on the primary", got)
+			}
+
+			if got := replica.queryCount() - replicaQueries; step.useReplica && got != 1 || !step.useReplica && got != 0 {
+				t.Errorf("unexpected %v queries on the replica", got)
+			}
+		})
+	}
+}
+
+func TestConnectionRouter_DoesNotFallBackOnCancelledContext(t *testing.T) {
+	primary := openFakeDb(t, "primary")
+	replica := openFakeDb(t, "replica")
+	router := NewConnectionRouter(primary.db, replica.db, 0)
+	router.UseReplica(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := router.queryRead(ctx, "select 1")
+
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if primary.queryCount() != 0 {
+		t.Errorf("expected no query on the primary, got %v", primary.queryCount())
+	}
+}
+
+// fakeDb is a database answering every query with no rows, or with the error set. Transactions
+// only count how they end.
+type fakeDb struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	err       error
+	queries   int
+	commits   int
+	rollbacks int
+}
+
+var fakeDrivers sync.Map
+
+func openFakeDb(t *testing.T, name string) *fakeDb {
+	t.Helper()
+
+	fake := &fakeDb{}
+	dsn := t.Name() + "/" + name
+	fakeDrivers.Store(dsn, fake)
+
+	t.Cleanup(func() {
+		fakeDrivers.Delete(dsn)
+	})
+
+	db, err := sql.Open("fake", dsn)
+
+	if err != nil {
+		t.Fatalf("failed to open %v: %v", name, err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	fake.db = db
+
+	return fake
+}
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+func (f *fakeDb) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+}
+
+func (f *fakeDb) queryCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.queries
+}
+
+func (f *fakeDb) query() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queries++
+
+	return f.err
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fake, ok := fakeDrivers.Load(dsn)
+
+	if !ok {
+		return nil, errors.New("unknown database " + dsn)
+	}
+
+	return &fakeConn{db: fake.(*fakeDb)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDb
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{db: c.db}, nil
+}
+
+// BeginTx accepts any isolation level, so that the transaction manager can be tested.
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c.Begin()
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	if err := c.db.query(); err != nil {
+		return nil, err
+	}
+
+	return fakeRows{}, nil
+}
+
+type fakeTx struct {
+	db *fakeDb
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	tx.db.commits++
+
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	tx.db.rollbacks++
+
+	return nil
+}
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string {
+	return nil
+}
+
+func (fakeRows) Close() error {
+	return nil
+}
+
+func (fakeRows) Next([]driver.Value) error {
+	return io.EOF
+}
@@ -3,37 +3,134 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+)
+
+const (
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
 )
 
+var isolationLevels = map[string]sql.IsolationLevel{
+	"read_committed":  sql.LevelReadCommitted,
+	"repeatable_read": sql.LevelRepeatableRead,
+	"serializable":    sql.LevelSerializable,
+}
+
 type TransactionManager struct {
-	db *sql.DB
+	db              *sql.DB
+	isolation       sql.IsolationLevel
+	maxRetries      int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
 }
 
-func NewTransactionManager(db *sql.DB) *TransactionManager {
+func NewTransactionManager(db *sql.DB, cfg config.TransactionConfig) (*TransactionManager, error) {
+	isolation, ok := isolationLevels[cfg.Isolation]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown transaction isolation level: %v", cfg.Isolation)
+	}
+
+	if cfg.MaxRetryBackoff < cfg.RetryBackoff {
+		return nil, fmt.Errorf("max retry backoff %v is shorter than retry backoff %v", cfg.MaxRetryBackoff, cfg.RetryBackoff)
+	}
+
 	return &TransactionManager{
-		db: db,
+		db:              db,
+		isolation:       isolation,
+		maxRetries:      cfg.MaxRetries,
+		retryBackoff:    cfg.RetryBackoff,
+		maxRetryBackoff: cfg.MaxRetryBackoff,
+	}, nil
+}
+
+// WithinTransaction runs fn in a transaction carried by the context passed to it, repositories called
+// with that context use the transaction. The transaction is committed if fn succeeds and rolled back
+// if it fails or panics. A call within a transaction joins it. Transactions that fail to serialize
+// are retried as a whole, so fn may run several times.
+func (tm *TransactionManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := tm.runInTransaction(ctx, fn)
+
+		if err == nil || attempt >= tm.maxRetries || !isSerializationFailure(err) {
+			return err
+		}
+
+		slog.WarnContext(ctx, fmt.Sprintf("Retrying transaction after serialization failure: %v", err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(tm.backoff(attempt)):
+		}
+	}
+}
+
+// backoff returns how long to wait before retrying the given attempt, doubling the wait with every
+// attempt up to maxRetryBackoff.
+func (tm *TransactionManager) backoff(attempt int) time.Duration {
+	backoff := tm.retryBackoff
+
+	for range attempt {
+		if backoff >= tm.maxRetryBackoff/2 {
+			return tm.maxRetryBackoff
+		}
+
+		backoff *= 2
 	}
+
+	return min(backoff, tm.maxRetryBackoff)
 }
 
-func (tm *TransactionManager) Begin(ctx context.Context) (*sql.Tx, error) {
+func (tm *TransactionManager) runInTransaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
 	opts := sql.TxOptions{
-		Isolation: sql.LevelReadCommitted,
+		Isolation: tm.isolation,
 		ReadOnly:  false,
 	}
 
 	tx, err := tm.db.BeginTx(ctx, &opts)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return tx, nil
-}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = fn(context.WithValue(ctx, txKey{}, tx))
+
+	if err != nil {
+		return err
+	}
 
-func (tm *TransactionManager) Commit(tx *sql.Tx) error {
 	return tx.Commit()
 }
 
-func (tm *TransactionManager) Rollback(tx *sql.Tx) error {
-	return tx.Rollback()
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == serializationFailureCode || pgErr.Code == deadlockDetectedCode
 }
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+)
+
+func TestWithinTransaction_RetriesSerializationFailures(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "serialization failure", err: &pgconn.PgError{Code: serializationFailureCode}, failures: 2, wantCalls: 3},
+		{name: "deadlock", err: &pgconn.PgError{Code: deadlockDetectedCode}, failures: 1, wantCalls: 2},
+		{name: "wrapped serialization failure", err: wrap(&pgconn.PgError{Code: serializationFailureCode}), failures: 1, wantCalls: 2},
+		{name: "attempts exhausted", err: &pgconn.PgError{Code: serializationFailureCode}, failures: 10, wantCalls: 4, wantErr: true},
+		{name: "other database error", err: &pgconn.PgError{Code: "23505"}, failures: 1, wantCalls: 1, wantErr: true},
+		{name: "other error", err: errors.New("failed"), failures: 1, wantCalls: 1, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db := openFakeDb(t, "primary")
+			tm := newTestTransactionManager(t, db, time.Millisecond)
+
+			calls := 0
+
+			err := tm.WithinTransaction(context.Background(), func(ctx context.Context) error {
+				calls++
+
+				if calls <= c.failures {
+					return c.err
+				}
+
+				return nil
+			})
+
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, c.wantErr)
+			}
+
+			if c.wantErr && !errors.Is(err, c.err) {
+				t.Errorf("got error %v, want %v", err, c.err)
+			}
+
+			if calls != c.wantCalls {
+				t.Errorf("got %v calls, want %v", calls, c.wantCalls)
+			}
+
+			if db.rollbacks != min(c.failures, c.wantCalls) {
+				t.Errorf("got %v rollbacks, want %v", db.rollbacks, min(c.failures, c.wantCalls))
+			}
+
+			if wantCommits := c.wantCalls - db.rollbacks; db.commits != wantCommits {
+				t.Errorf("got %v commits, want %v", db.commits, wantCommits)
+			}
+		})
+	}
+}
+
+func TestWithinTransaction_StopsRetryingWhenContextIsDone(t *testing.T) {
+	db := openFakeDb(t, "primary")
+	tm := newTestTransactionManager(t, db, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+
+	err := tm.WithinTransaction(ctx, func(ctx context.Context) error {
+		calls++
+		cancel()
+
+		return &pgconn.PgError{Code: serializationFailureCode}
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	if calls != 1 {
+		t.Errorf("got %v calls, want 1", calls)
+	}
+}
+
+func TestBackoff_DoublesUpToMax(t *testing.T) {
+	tm := &TransactionManager{
+		retryBackoff:    50 * time.Millisecond,
+		maxRetryBackoff: time.Second,
+	}
+
+	want := []time.Duration{
+		50 * time.Millisecond,
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+
+	for attempt, backoff := range want {
+		if got := tm.backoff(attempt); got != backoff {
+			t.Errorf("attempt %v: got backoff %v, want %v", attempt, got, backoff)
+		}
+	}
+
+	if got := tm.backoff(1000); got != time.Second {
+		t.Errorf("got backoff %v after many attempts, want %v", got, time.Second)
+	}
+}
+
+func newTestTransactionManager(t *testing.T, db *fakeDb, backoff time.Duration) *TransactionManager {
+	t.Helper()
+
+	tm, err := NewTransactionManager(db.db, config.TransactionConfig{
+		Isolation:       "read_committed",
+		MaxRetries:      3,
+		RetryBackoff:    backoff,
+		MaxRetryBackoff: backoff,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tm
+}
+
+func wrap(err error) error {
+	return fmt.Errorf("failed to update: %w", err)
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+type UnreadRepository struct {
+	db *sql.DB
+}
+
+func NewUnreadRepository(db *sql.DB) *UnreadRepository {
+	return &UnreadRepository{
+		db: db,
+	}
+}
+
+// AdvanceWatermark moves the read watermark of the user in the chat forward, it never goes back.
+func (r *UnreadRepository) AdvanceWatermark(
+	ctx context.Context,
+	chatId model.ChatId,
+	userId model.UserId,
+	lastReadMessageId model.MessageId,
+) error {
+	const query = `
+		insert into read_watermarks
+		(
+			chat_id,
+			user_id,
+			last_read_message_id,
+			updated_at
+		)
+		values ($1, $2, $3, $4)
+		on conflict (chat_id, user_id) do update
+		set
+			last_read_message_id = greatest(read_watermarks.last_read_message_id, excluded.last_read_message_id),
+			updated_at = excluded.updated_at`
+
+	ec := executionContext(ctx, r.db)
+
+	_, err := ec.ExecContext(ctx, query, chatId, userId, lastReadMessageId, time.Now().UTC())
+
+	return err
+}
+
+// GetAggregates returns the number of unread sent messages per recipient and chat ordered by the key,
+// starting after the given one. Chats with pending messages of the recipient or with messages sent
+// after settledBefore are skipped as their counters may not be updated yet. Recipients who have never
+// read the chat are skipped as which of their messages are read is unknown, and so are chats with
+// archived messages, since only their messages kept in the table are counted.
+func (r *UnreadRepository) GetAggregates(
+	ctx context.Context,
+	after model.UnreadKey,
+	settledBefore time.Time,
+	limit int,
+) ([]*model.UnreadAggregate, error) {
+	const query = `
+		select
+			m.chat_id,
+			m.to_user_id,
+			count(*) filter (where m.state = $1 and m.message_id > w.last_read_message_id),
+			max(m.message_id),
+			max(w.last_read_message_id)
+		from messages m
+		join read_watermarks w on
+			w.chat_id = m.chat_id and
+			w.user_id = m.to_user_id
+		where
+			(m.chat_id, m.to_user_id) > ($2, $3) and
+			not exists (select from archive_blobs b where b.chat_id = m.chat_id)
+		group by m.chat_id, m.to_user_id
+		having
+			count(*) filter (where m.state = $4) = 0 and
+			max(m.sent_at) < $5
+		order by m.chat_id, m.to_user_id
+		limit $6`
+
+	ec := executionContext(ctx, r.db)
+
+	rows, err := ec.QueryContext(
+		ctx,
+		query,
+		model.MessageStateSent,
+		after.ChatId,
+		after.UserId,
+		model.MessageStatePending,
+		settledBefore,
+		limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var aggregates []*model.UnreadAggregate
+
+	for rows.Next() {
+		aggregate := &model.UnreadAggregate{}
+
+		err = rows.Scan(
+			&aggregate.Key.ChatId,
+			&aggregate.Key.UserId,
+			&aggregate.Count,
+			&aggregate.LastMessageId,
+			&aggregate.LastReadMessageId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		aggregates = append(aggregates, aggregate)
+	}
+
+	return aggregates, rows.Err()
+}
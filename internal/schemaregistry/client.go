@@ -0,0 +1,108 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+)
+
+const (
+	SchemaTypeProtobuf = "PROTOBUF"
+
+	contentType = "application/vnd.schemaregistry.v1+json"
+)
+
+type Schema struct {
+	Type   string
+	Schema string
+}
+
+// Client talks to a Confluent-compatible schema registry over its REST API.
+type Client struct {
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+func NewClient(cfg config.SchemaRegistryConfig) *Client {
+	return &Client{
+		url:      strings.TrimSuffix(cfg.Url, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Register registers the schema under the subject and returns its ID. Registering a schema
+// that already exists returns the ID of the existing one.
+func (c *Client) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	reqDto := struct {
+		SchemaType string `json:"schemaType"`
+		Schema     string `json:"schema"`
+	}{
+		SchemaType: schema.Type,
+		Schema:     schema.Schema,
+	}
+
+	body, err := json.Marshal(reqDto)
+
+	if err != nil {
+		return 0, err
+	}
+
+	endpoint := fmt.Sprintf("%s/subjects/%s/versions", c.url, url.PathEscape(subject))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to register schema for subject %v: %v %s", subject, resp.Status, respBody)
+	}
+
+	respDto := struct {
+		Id int `json:"id"`
+	}{}
+
+	err = json.Unmarshal(respBody, &respDto)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return respDto.Id, nil
+}
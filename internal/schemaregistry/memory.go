@@ -0,0 +1,49 @@
+package schemaregistry
+
+import (
+	"context"
+	"sync"
+)
+
+// InMemoryRegistry is a stand-in for the schema registry used in tests and local runs.
+type InMemoryRegistry struct {
+	mu       sync.Mutex
+	schemas  map[int]Schema
+	subjects map[string]map[Schema]int
+}
+
+func NewInMemoryRegistry() *InMemoryRegistry {
+	return &InMemoryRegistry{
+		schemas:  make(map[int]Schema),
+		subjects: make(map[string]map[Schema]int),
+	}
+}
+
+func (r *InMemoryRegistry) Register(_ context.Context, subject string, schema Schema) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions, ok := r.subjects[subject]
+
+	if !ok {
+		versions = make(map[Schema]int)
+		r.subjects[subject] = versions
+	}
+
+	if id, ok := versions[schema]; ok {
+		return id, nil
+	}
+
+	for id, existing := range r.schemas {
+		if existing == schema {
+			versions[schema] = id
+			return id, nil
+		}
+	}
+
+	id := len(r.schemas) + 1
+	r.schemas[id] = schema
+	versions[schema] = id
+
+	return id, nil
+}
@@ -0,0 +1,54 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"slices"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const magicByte byte = 0
+
+// EncodeProtobuf frames a serialized protobuf message in the Confluent wire format: the magic
+// byte, the big-endian schema ID, the indexes of the message within its schema and the payload.
+func EncodeProtobuf(schemaId int, descriptor protoreflect.MessageDescriptor, payload []byte) []byte {
+	indexes := messageIndexes(descriptor)
+
+	buf := make([]byte, 0, 5+len(indexes)*2+len(payload))
+	buf = append(buf, magicByte)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(schemaId))
+
+	// The most common case of the first message in a schema is encoded as a single zero.
+	if len(indexes) == 1 && indexes[0] == 0 {
+		buf = append(buf, 0)
+	} else {
+		buf = binary.AppendVarint(buf, int64(len(indexes)))
+
+		for _, index := range indexes {
+			buf = binary.AppendVarint(buf, int64(index))
+		}
+	}
+
+	return append(buf, payload...)
+}
+
+func messageIndexes(descriptor protoreflect.MessageDescriptor) []int {
+	var indexes []int
+
+	var d protoreflect.Descriptor = descriptor
+
+	for {
+		md, ok := d.(protoreflect.MessageDescriptor)
+
+		if !ok {
+			break
+		}
+
+		indexes = append(indexes, md.Index())
+		d = md.Parent()
+	}
+
+	slices.Reverse(indexes)
+
+	return indexes
+}
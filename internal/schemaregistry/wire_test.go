@@ -0,0 +1,95 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/orochi-keydream/dialogue-service/internal/proto/dialogue"
+	"github.com/orochi-keydream/dialogue-service/internal/proto/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncodeProtobuf_FramesPayload(t *testing.T) {
+	response := &dialogue.GetMessagesV1Response{}
+	responseIndex := response.ProtoReflect().Descriptor().Index()
+
+	tests := []struct {
+		name    string
+		message proto.Message
+		indexes []int
+	}{
+		{name: "first message", message: &events.AddNewUnreadMessage{ChatId: "alice_bob", MessageId: 7}, indexes: []int{0}},
+		{name: "later message", message: &dialogue.GetMessagesV1Response{NextPageToken: "token"}, indexes: []int{responseIndex}},
+		{name: "nested message", message: &dialogue.GetMessagesV1Response_Message{MessageId: 7}, indexes: []int{responseIndex, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload, err := proto.Marshal(test.message)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := EncodeProtobuf(258, test.message.ProtoReflect().Descriptor(), payload)
+
+			if data[0] != magicByte {
+				t.Fatalf("got magic byte %v, want %v", data[0], magicByte)
+			}
+
+			if schemaId := binary.BigEndian.Uint32(data[1:5]); schemaId != 258 {
+				t.Errorf("got schema ID %v, want 258", schemaId)
+			}
+
+			indexes, rest := decodeIndexes(t, data[5:])
+
+			if !slices.Equal(indexes, test.indexes) {
+				t.Errorf("got message indexes %v, want %v", indexes, test.indexes)
+			}
+
+			decoded := test.message.ProtoReflect().New().Interface()
+
+			if err = proto.Unmarshal(rest, decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			if !proto.Equal(decoded, test.message) {
+				t.Errorf("got payload %v, want %v", decoded, test.message)
+			}
+		})
+	}
+}
+
+// decodeIndexes reads the zigzag varint count of message indexes followed by the indexes, a zero
+// count stands for the single index of the first message.
+func decodeIndexes(t *testing.T, data []byte) ([]int, []byte) {
+	t.Helper()
+
+	count, n := binary.Varint(data)
+
+	if n <= 0 {
+		t.Fatal("malformed count of message indexes")
+	}
+
+	data = data[n:]
+
+	if count == 0 {
+		return []int{0}, data
+	}
+
+	indexes := make([]int, count)
+
+	for i := range indexes {
+		index, n := binary.Varint(data)
+
+		if n <= 0 {
+			t.Fatal("malformed message index")
+		}
+
+		indexes[i] = int(index)
+		data = data[n:]
+	}
+
+	return indexes, data
+}
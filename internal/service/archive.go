@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+type IMessageArchive interface {
+	Write(ctx context.Context, chatId model.ChatId, messages []*model.Message) error
+	GetVisibleMessages(
+		ctx context.Context,
+		chatId model.ChatId,
+		viewerId model.UserId,
+		viewerStates []model.MessageState,
+		cursor *model.MessageCursor,
+		limit int,
+	) ([]*model.Message, error)
+	NewestSentAt(ctx context.Context, chatId model.ChatId) (time.Time, bool, error)
+}
+
+// archiverLockName is the name of the lock held by the replica that archives.
+const archiverLockName = "dialogue-service.archiver"
+
+type IArchivableMessageRepository interface {
+	GetArchivableMessages(ctx context.Context, sentBefore time.Time, limit int) ([]*model.Message, error)
+	DeleteMessages(ctx context.Context, chatId model.ChatId, ids []model.MessageId) (int64, error)
+}
+
+// Archiver moves messages older than the configured age from the database to the archive. Messages
+// are written to the archive before they are deleted, so an interrupted run leaves them in both
+// places at worst and they are archived again by the next run. A run is skipped while another replica
+// archives, since the blobs of a chat are rewritten in place.
+type Archiver struct {
+	messageRepository IArchivableMessageRepository
+	archive           IMessageArchive
+	leaderLock        ILeaderLock
+	cfg               config.ArchiveConfig
+}
+
+func NewArchiver(
+	messageRepository IArchivableMessageRepository,
+	archive IMessageArchive,
+	leaderLock ILeaderLock,
+	cfg config.ArchiveConfig,
+) *Archiver {
+	return &Archiver{
+		messageRepository: messageRepository,
+		archive:           archive,
+		leaderLock:        leaderLock,
+		cfg:               cfg,
+	}
+}
+
+func (a *Archiver) Archive(ctx context.Context) error {
+	unlock, ok, err := a.leaderLock.TryLock(ctx, archiverLockName)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		slog.DebugContext(ctx, "Skipped archival since another replica archives")
+		return nil
+	}
+
+	defer unlock()
+
+	sentBefore := time.Now().UTC().Add(-a.cfg.Age)
+
+	var archived int64
+
+	for {
+		messages, err := a.messageRepository.GetArchivableMessages(ctx, sentBefore, a.cfg.BatchSize)
+
+		if err != nil {
+			return err
+		}
+
+		if len(messages) == 0 {
+			break
+		}
+
+		batchArchived, err := a.archiveBatch(ctx, messages)
+
+		if err != nil {
+			return err
+		}
+
+		archived += batchArchived
+
+		if len(messages) < a.cfg.BatchSize {
+			break
+		}
+	}
+
+	if archived > 0 {
+		slog.InfoContext(ctx, fmt.Sprintf("Archived %v messages sent before %v", archived, sentBefore))
+	}
+
+	return nil
+}
+
+func (a *Archiver) archiveBatch(ctx context.Context, messages []*model.Message) (int64, error) {
+	var chats []model.ChatId
+
+	byChat := make(map[model.ChatId][]*model.Message)
+
+	for _, msg := range messages {
+		if _, ok := byChat[msg.ChatId]; !ok {
+			chats = append(chats, msg.ChatId)
+		}
+
+		byChat[msg.ChatId] = append(byChat[msg.ChatId], msg)
+	}
+
+	var archived int64
+
+	for _, chatId := range chats {
+		chatMessages := byChat[chatId]
+
+		err := a.archive.Write(ctx, chatId, chatMessages)
+
+		if err != nil {
+			return archived, fmt.Errorf("failed to archive messages of chat %v: %w", chatId, err)
+		}
+
+		ids := make([]model.MessageId, len(chatMessages))
+
+		for i, msg := range chatMessages {
+			ids[i] = msg.MessageId
+		}
+
+		deleted, err := a.messageRepository.DeleteMessages(ctx, chatId, ids)
+
+		if err != nil {
+			return archived, fmt.Errorf("failed to delete archived messages of chat %v: %w", chatId, err)
+		}
+
+		archived += deleted
+		metrics.ArchivedMessages.Add(float64(deleted))
+	}
+
+	return archived, nil
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/archive"
+	"github.com/orochi-keydream/dialogue-service/internal/blob"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/fixture"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestArchive_MovesReadAndFailedMessagesOnly(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	unreadRepository := memory.NewUnreadRepository(store)
+	messageArchive := archive.NewArchive(blob.NewLocalStore(t.TempDir()), memory.NewArchiveIndexRepository(store))
+
+	old := time.Now().UTC().Add(-48 * time.Hour)
+
+	read := fixture.AddMessage(t, dialogueRepository, old, model.MessageStateSent)
+	unread := fixture.AddMessage(t, dialogueRepository, old.Add(time.Minute), model.MessageStateSent)
+	failed := fixture.AddMessage(t, dialogueRepository, old.Add(2*time.Minute), model.MessageStateRemoved)
+	recent := fixture.AddMessage(t, dialogueRepository, time.Now().UTC(), model.MessageStateRemoved)
+
+	err := unreadRepository.AdvanceWatermark(ctx, "alice_bob", "bob", read)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archiver := NewArchiver(dialogueRepository, messageArchive, memory.NewLeaderLock(), config.ArchiveConfig{Age: 24 * time.Hour, BatchSize: 1})
+	archivedBefore := testutil.ToFloat64(metrics.ArchivedMessages)
+
+	err = archiver.Archive(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []model.MessageId{unread, recent} {
+		if _, err = dialogueRepository.GetMessage(ctx, id); err != nil {
+			t.Errorf("message %v is not kept in the database: %v", id, err)
+		}
+	}
+
+	archived, err := messageArchive.GetVisibleMessages(ctx, "alice_bob", "alice", []model.MessageState{model.MessageStateRemoved}, nil, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := messageIds(archived); !slices.Equal(ids, []model.MessageId{failed, read}) {
+		t.Errorf("got archived messages %v, want %v", ids, []model.MessageId{failed, read})
+	}
+
+	if got := testutil.ToFloat64(metrics.ArchivedMessages) - archivedBefore; got != 2 {
+		t.Errorf("got %v archived messages counted, want 2", got)
+	}
+}
+
+func TestArchive_SkipsRunWhileAnotherReplicaArchives(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	messageArchive := archive.NewArchive(blob.NewLocalStore(t.TempDir()), memory.NewArchiveIndexRepository(store))
+	leaderLock := memory.NewLeaderLock()
+
+	failed := fixture.AddMessage(t, dialogueRepository, time.Now().UTC().Add(-48*time.Hour), model.MessageStateRemoved)
+
+	unlock, ok, err := leaderLock.TryLock(ctx, archiverLockName)
+
+	if err != nil || !ok {
+		t.Fatalf("failed to take the lock: %v, %v", ok, err)
+	}
+
+	archiver := NewArchiver(dialogueRepository, messageArchive, leaderLock, config.ArchiveConfig{Age: 24 * time.Hour, BatchSize: 100})
+
+	err = archiver.Archive(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = dialogueRepository.GetMessage(ctx, failed); err != nil {
+		t.Errorf("message is archived while another replica holds the lock: %v", err)
+	}
+
+	unlock()
+
+	err = archiver.Archive(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = dialogueRepository.GetMessage(ctx, failed); err == nil {
+		t.Error("message is not archived once the lock is released")
+	}
+}
+
+func TestGetMessages_PagesIntoArchive(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	unreadRepository := memory.NewUnreadRepository(store)
+	messageArchive := archive.NewArchive(blob.NewLocalStore(t.TempDir()), memory.NewArchiveIndexRepository(store))
+
+	old := time.Now().UTC().Add(-48 * time.Hour).Truncate(time.Microsecond)
+
+	var all []model.MessageId
+
+	for i := range 5 {
+		all = append(all, fixture.AddMessage(t, dialogueRepository, old.Add(time.Duration(i)*time.Minute), model.MessageStateSent))
+	}
+
+	// Read messages are archived, while the unread one older than them stays in the database.
+	err := unreadRepository.AdvanceWatermark(ctx, "alice_bob", "bob", all[4])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unread := fixture.AddMessage(t, dialogueRepository, old.Add(-time.Minute), model.MessageStateSent)
+	recent := fixture.AddMessage(t, dialogueRepository, time.Now().UTC().Truncate(time.Microsecond), model.MessageStateSent)
+
+	archiver := NewArchiver(dialogueRepository, messageArchive, memory.NewLeaderLock(), config.ArchiveConfig{Age: 24 * time.Hour, BatchSize: 100})
+
+	err = archiver.Archive(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appService := NewAppService(dialogueRepository, nil, nil, nil, messageArchive, newFakeTransactionManager(), nil)
+
+	var (
+		cursor *model.MessageCursor
+		got    []model.MessageId
+	)
+
+	readsBefore := testutil.ToFloat64(metrics.ArchiveReads)
+
+	for {
+		page, err := appService.GetMessages(ctx, model.GetMessagesCommand{
+			FromUserId: "bob",
+			ToUserId:   "alice",
+			Limit:      2,
+			Cursor:     cursor,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, messageIds(page.Messages)...)
+
+		if page.Next == nil {
+			break
+		}
+
+		cursor = page.Next
+	}
+
+	want := []model.MessageId{recent, all[4], all[3], all[2], all[1], all[0], unread}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got messages %v, want %v", got, want)
+	}
+
+	if reads := testutil.ToFloat64(metrics.ArchiveReads) - readsBefore; reads == 0 {
+		t.Error("pages read from the archive are not counted")
+	}
+
+	page, err := appService.GetMessages(ctx, model.GetMessagesCommand{FromUserId: "bob", ToUserId: "alice"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := messageIds(page.Messages); !slices.Equal(ids, want) || page.Next != nil {
+		t.Errorf("got whole history %v, want %v", ids, want)
+	}
+}
+
+func messageIds(messages []*model.Message) []model.MessageId {
+	ids := make([]model.MessageId, len(messages))
+
+	for i, msg := range messages {
+		ids[i] = msg.MessageId
+	}
+
+	return ids
+}
@@ -2,51 +2,86 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"github.com/google/uuid"
 	"log/slog"
+	"slices"
 	"time"
 
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
 	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/outbox"
 )
 
 type IDialogueRepository interface {
-	AddMessage(ctx context.Context, msg *model.Message, tx *sql.Tx) (model.MessageId, error)
-	GetSentMessages(ctx context.Context, chatId model.ChatId, tx *sql.Tx) ([]*model.Message, error)
-	GetMessage(ctx context.Context, id model.MessageId, tx *sql.Tx) (*model.Message, error)
-	UpdateMessage(ctx context.Context, msg *model.Message, tx *sql.Tx) error
+	AddMessage(ctx context.Context, msg *model.Message) (model.MessageId, error)
+	GetVisibleMessages(
+		ctx context.Context,
+		chatId model.ChatId,
+		viewerId model.UserId,
+		viewerStates []model.MessageState,
+		cursor *model.MessageCursor,
+		limit int,
+	) ([]*model.Message, error)
+	GetMessage(ctx context.Context, id model.MessageId) (*model.Message, error)
+	UpdateMessage(ctx context.Context, msg *model.Message, expected model.MessageState) (bool, error)
+	UpdateMessagesState(
+		ctx context.Context,
+		ids []model.MessageId,
+		expected []model.MessageState,
+		state model.MessageState,
+	) ([]model.MessageId, error)
 }
 
 type IOutboxRepository interface {
-	Add(ctx context.Context, message *model.OutboxMessage, tx *sql.Tx) error
-	GetUnsent(ctx context.Context, tx *sql.Tx) ([]*model.OutboxMessage, error)
-	Update(ctx context.Context, messages []*model.OutboxMessage, tx *sql.Tx) error
+	Add(ctx context.Context, message *model.OutboxMessage) error
+	GetUnsent(ctx context.Context) ([]*model.OutboxMessage, error)
+	Update(ctx context.Context, messages []*model.OutboxMessage) error
+	GetBacklog(ctx context.Context) (model.OutboxBacklog, error)
+}
+
+type IReadWatermarkRepository interface {
+	AdvanceWatermark(
+		ctx context.Context,
+		chatId model.ChatId,
+		userId model.UserId,
+		lastReadMessageId model.MessageId,
+	) error
 }
 
 type ICommandRepository interface {
-	Add(ctx context.Context, correlationId string, tx *sql.Tx) error
-	Exists(ctx context.Context, correlationId string, tx *sql.Tx) (bool, error)
+	Add(ctx context.Context, correlationId string) (bool, error)
+	AddMany(ctx context.Context, correlationIds []string) ([]string, error)
 }
 
 type AppService struct {
-	dialogueRepository IDialogueRepository
-	outboxRepository   IOutboxRepository
-	commandRepository  ICommandRepository
+	dialogueRepository  IDialogueRepository
+	outboxRepository    IOutboxRepository
+	commandRepository   ICommandRepository
+	watermarkRepository IReadWatermarkRepository
+	// archive is nil if archival is not configured.
+	archive            IMessageArchive
 	transactionManager ITransactionManager
+	outboxRegistry     *outbox.Registry
 }
 
 func NewAppService(
 	dialogueRepository IDialogueRepository,
 	outboxRepository IOutboxRepository,
 	commandRepository ICommandRepository,
+	watermarkRepository IReadWatermarkRepository,
+	archive IMessageArchive,
 	transactionManager ITransactionManager,
+	outboxRegistry *outbox.Registry,
 ) *AppService {
 	return &AppService{
-		dialogueRepository: dialogueRepository,
-		outboxRepository:   outboxRepository,
-		commandRepository:  commandRepository,
-		transactionManager: transactionManager,
+		dialogueRepository:  dialogueRepository,
+		outboxRepository:    outboxRepository,
+		commandRepository:   commandRepository,
+		watermarkRepository: watermarkRepository,
+		archive:             archive,
+		transactionManager:  transactionManager,
+		outboxRegistry:      outboxRegistry,
 	}
 }
 
@@ -58,39 +93,40 @@ func (s *AppService) SendMessage(ctx context.Context, cmd model.SendMessageComma
 		FromUserId: cmd.FromUserId,
 		ToUserId:   cmd.ToUserId,
 		Text:       cmd.Text,
-		SentAt:     time.Now().UTC(),
-		State:      model.MessageStatePending,
+		// Postgres keeps timestamps in microseconds, page tokens rely on the same precision.
+		SentAt: time.Now().UTC().Truncate(time.Microsecond),
+		State:  model.MessageStatePending,
+		// The same correlation ID is used when the command is re-emitted, so the counter service
+		// can tell a retry from a new message.
+		CorrelationId: uuid.New().String(),
 	}
 
-	tx, err := s.transactionManager.Begin(ctx)
+	var messageId model.MessageId
 
-	if err != nil {
-		return err
-	}
+	err := s.transactionManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
 
-	defer tx.Rollback()
+		messageId, err = s.dialogueRepository.AddMessage(ctx, msg)
 
-	messageId, err := s.dialogueRepository.AddMessage(ctx, msg, tx)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
+		messageValue := model.AddNewUnreadMessage{
+			CorrelationId: msg.CorrelationId,
+			UserId:        msg.ToUserId,
+			ChatId:        msg.ChatId,
+			MessageId:     messageId,
+		}
 
-	messageValue := model.AddNewUnreadMessage{
-		CorrelationId: uuid.New().String(),
-		UserId:        msg.ToUserId,
-		ChatId:        msg.ChatId,
-		MessageId:     messageId,
-	}
+		outboxMessage, err := outbox.NewMessage(ctx, s.outboxRegistry, messageValue)
 
-	outboxMessage := &model.OutboxMessage{
-		Type:         model.OutboxMessageTypeAddNewUnreadMessage,
-		MessageKey:   msg.ChatId,
-		MessageValue: messageValue,
-		IsSent:       false,
-	}
+		if err != nil {
+			return err
+		}
 
-	err = s.outboxRepository.Add(ctx, outboxMessage, tx)
+		return s.outboxRepository.Add(ctx, outboxMessage)
+	})
 
 	if err != nil {
 		return err
@@ -98,127 +134,414 @@ func (s *AppService) SendMessage(ctx context.Context, cmd model.SendMessageComma
 
 	slog.InfoContext(ctx, fmt.Sprintf("Message %v sent to chat %v", messageId, chatId))
 
-	tx.Commit()
-
 	return nil
 }
 
-func (s *AppService) GetMessages(ctx context.Context, cmd model.GetMessagesCommand) ([]*model.Message, error) {
+// GetMessages returns a page of the chat history. Messages moved to the archive are merged in
+// when the page reaches them.
+func (s *AppService) GetMessages(ctx context.Context, cmd model.GetMessagesCommand) (*model.MessagePage, error) {
 	chatId := s.buildChatId(cmd.FromUserId, cmd.ToUserId)
 
-	messages, err := s.dialogueRepository.GetSentMessages(ctx, chatId, nil)
+	// The peer sees sent messages only, while the sender also sees their messages still in progress.
+	viewerStates := []model.MessageState{model.MessageStatePending}
+
+	if cmd.IncludeFailed {
+		viewerStates = append(viewerStates, model.MessageStateRemoved)
+	}
+
+	messages, err := s.dialogueRepository.GetVisibleMessages(ctx, chatId, cmd.FromUserId, viewerStates, cmd.Cursor, cmd.Limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	readArchive, err := s.needsArchive(ctx, chatId, cmd.Limit, messages)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if readArchive {
+		archived, err := s.archive.GetVisibleMessages(ctx, chatId, cmd.FromUserId, viewerStates, cmd.Cursor, cmd.Limit)
+
+		if err != nil {
+			return nil, err
+		}
+
+		metrics.ArchiveReads.Inc()
+
+		messages = mergeMessages(messages, archived, cmd.Limit)
+	}
+
+	page := &model.MessagePage{
+		Messages: messages,
+	}
+
+	if cmd.Limit > 0 && len(messages) == cmd.Limit {
+		page.Next = model.NewMessageCursor(messages[len(messages)-1])
+	}
+
 	slog.InfoContext(ctx, fmt.Sprintf("Got %v messages from chat %v", len(messages), chatId))
 
-	return messages, nil
+	return page, nil
 }
 
-func (s *AppService) CommitMessage(ctx context.Context, cmd model.CommitMessageCommand) error {
-	exists, err := s.commandRepository.Exists(ctx, cmd.CorrelationId, nil)
-
-	if err != nil {
-		return err
+// needsArchive reports whether the archive may hold messages of the page. The archive is not read
+// while the page is filled with messages newer than any archived one.
+func (s *AppService) needsArchive(ctx context.Context, chatId model.ChatId, limit int, messages []*model.Message) (bool, error) {
+	if s.archive == nil {
+		return false, nil
 	}
 
-	if exists {
-		slog.Info(fmt.Sprintf("Command with correlation ID %v was handled before", cmd.CorrelationId))
-		return nil
+	if limit == 0 || len(messages) < limit {
+		return true, nil
 	}
 
-	message, err := s.dialogueRepository.GetMessage(ctx, cmd.MessageId, nil)
+	newest, ok, err := s.archive.NewestSentAt(ctx, chatId)
 
-	if err != nil {
-		return err
+	if err != nil || !ok {
+		return false, err
 	}
 
-	message.State = model.MessageStateSent
+	return !newest.Before(messages[len(messages)-1].SentAt), nil
+}
 
-	tx, err := s.transactionManager.Begin(ctx)
+// mergeMessages merges two pages ordered newest first into one of at most limit messages. A message
+// being in both pages while it is being archived is returned once.
+func mergeMessages(a, b []*model.Message, limit int) []*model.Message {
+	merged := make([]*model.Message, 0, len(a)+len(b))
+	seen := make(map[model.MessageId]struct{}, len(a))
 
-	if err != nil {
-		return err
+	for _, msg := range a {
+		seen[msg.MessageId] = struct{}{}
+		merged = append(merged, msg)
 	}
 
-	defer tx.Rollback()
+	for _, msg := range b {
+		if _, ok := seen[msg.MessageId]; !ok {
+			merged = append(merged, msg)
+		}
+	}
 
-	err = s.dialogueRepository.UpdateMessage(ctx, message, tx)
+	slices.SortFunc(merged, model.CompareMessages)
 
-	if err != nil {
-		return err
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
 	}
 
-	err = s.commandRepository.Add(ctx, cmd.CorrelationId, tx)
+	return merged
+}
+
+func (s *AppService) ReadMessages(ctx context.Context, cmd model.ReadMessagesCommand) error {
+	chatId := s.buildChatId(cmd.UserId, cmd.PeerUserId)
+
+	err := s.watermarkRepository.AdvanceWatermark(ctx, chatId, cmd.UserId, cmd.LastReadMessageId)
 
 	if err != nil {
 		return err
 	}
 
-	err = tx.Commit()
+	slog.InfoContext(ctx, fmt.Sprintf("User %v has read messages in chat %v up to %v", cmd.UserId, chatId, cmd.LastReadMessageId))
+
+	return nil
+}
+
+func (s *AppService) CommitMessage(ctx context.Context, cmd model.CommitMessageCommand) error {
+	applied, err := s.transitionMessage(ctx, cmd.CorrelationId, cmd.MessageId, model.MessageStateSent)
 
 	if err != nil {
 		return err
 	}
 
-	slog.InfoContext(ctx, fmt.Sprintf("Message %v has been committed", cmd.MessageId))
+	if applied {
+		slog.InfoContext(ctx, fmt.Sprintf("Message %v has been committed", cmd.MessageId))
+	}
 
 	return nil
 }
 
 func (s *AppService) RollbackMessage(ctx context.Context, cmd model.RollbackMessageCommand) error {
-	exists, err := s.commandRepository.Exists(ctx, cmd.CorrelationId, nil)
+	applied, err := s.transitionMessage(ctx, cmd.CorrelationId, cmd.MessageId, model.MessageStateRemoved)
 
 	if err != nil {
 		return err
 	}
 
-	if exists {
-		slog.Info(fmt.Sprintf("Command with correlation ID %v was handled before", cmd.CorrelationId))
-		return nil
+	if applied {
+		slog.InfoContext(ctx, fmt.Sprintf("Message %v has been removed due to rollback", cmd.MessageId))
 	}
 
-	message, err := s.dialogueRepository.GetMessage(ctx, cmd.MessageId, nil)
+	return nil
+}
+
+// RollbackStuckMessage removes a message the counter service has not answered for. The counter service
+// may have applied the saga command without its reply reaching us, so along with the rollback it is
+// asked to undo the unread message it may have added.
+func (s *AppService) RollbackStuckMessage(ctx context.Context, cmd model.RollbackMessageCommand, message *model.Message) error {
+	applied := false
+
+	err := s.transactionManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		applied, err = s.transitionMessage(ctx, cmd.CorrelationId, cmd.MessageId, model.MessageStateRemoved)
+
+		// The message has been resolved in the meantime, e.g. by a late reply of the counter service.
+		if err != nil || !applied {
+			return err
+		}
+
+		outboxMessage, err := outbox.NewMessage(ctx, s.outboxRegistry, model.RemoveUnreadMessage{
+			CorrelationId: message.CorrelationId,
+			UserId:        message.ToUserId,
+			ChatId:        message.ChatId,
+			MessageId:     message.MessageId,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return s.outboxRepository.Add(ctx, outboxMessage)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	message.State = model.MessageStateRemoved
+	if applied {
+		slog.InfoContext(ctx, fmt.Sprintf("Message %v has been removed due to rollback, unread message compensated", cmd.MessageId))
+	}
+
+	return nil
+}
+
+// transitionMessage records the command as handled and moves the message to the given state if the
+// state machine allows it. A rejected transition is not an error: the command is still recorded so
+// that redeliveries do not retry it.
+func (s *AppService) transitionMessage(
+	ctx context.Context,
+	correlationId string,
+	messageId model.MessageId,
+	state model.MessageState,
+) (bool, error) {
+	var (
+		applied  bool
+		rejected error
+	)
 
-	tx, err := s.transactionManager.Begin(ctx)
+	err := s.transactionManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		applied, rejected = false, nil
+
+		// Concurrent deliveries of the same command wait for each other on the insert, so only one
+		// of them is applied and the rest see the conflict.
+		added, err := s.commandRepository.Add(ctx, correlationId)
+
+		if err != nil {
+			return err
+		}
+
+		if !added {
+			slog.InfoContext(ctx, fmt.Sprintf("Command with correlation ID %v was handled before", correlationId))
+			reportDryRunError(ctx, fmt.Errorf("command with correlation ID %v was handled before", correlationId))
+
+			return nil
+		}
+
+		message, err := s.dialogueRepository.GetMessage(ctx, messageId)
+
+		if err != nil {
+			return err
+		}
+
+		previous, err := message.TransitionTo(state)
+
+		if err != nil {
+			rejected = err
+			return nil
+		}
+
+		applied, err = s.dialogueRepository.UpdateMessage(ctx, message, previous)
+
+		if err != nil {
+			return err
+		}
+
+		if !applied {
+			rejected = fmt.Errorf("%w: message %v changed its state concurrently", model.ErrInvalidStateTransition, messageId)
+		}
+
+		return nil
+	})
 
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	defer tx.Rollback()
+	if rejected != nil && !reportDryRunError(ctx, rejected) {
+		slog.WarnContext(ctx, fmt.Sprintf("Rejected transition for command %v: %v", correlationId, rejected))
+		metrics.SagaRejectedTransitions.WithLabelValues(state.String()).Inc()
+	}
 
-	err = s.dialogueRepository.UpdateMessage(ctx, message, tx)
+	return applied, nil
+}
 
-	if err != nil {
-		return err
+// HandleCommands applies a batch of commits and rollbacks in a single transaction. Commands that
+// have been handled before or concurrently, including duplicates within the batch, are skipped.
+func (s *AppService) HandleCommands(ctx context.Context, batch model.CommandBatch) error {
+	correlationIds := make([]string, 0, len(batch.Commits)+len(batch.Rollbacks))
+
+	for _, cmd := range batch.Commits {
+		correlationIds = append(correlationIds, cmd.CorrelationId)
 	}
 
-	err = s.commandRepository.Add(ctx, cmd.CorrelationId, tx)
+	for _, cmd := range batch.Rollbacks {
+		correlationIds = append(correlationIds, cmd.CorrelationId)
+	}
 
-	if err != nil {
-		return err
+	if len(correlationIds) == 0 {
+		return nil
 	}
 
-	err = tx.Commit()
+	var committed, removed stateUpdate
+
+	err := s.transactionManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		committed, removed = stateUpdate{}, stateUpdate{}
+
+		added, err := s.commandRepository.AddMany(ctx, correlationIds)
+
+		if err != nil {
+			return err
+		}
+
+		// Every correlation ID is reported as added once at most, so duplicates within the batch
+		// and commands handled before are skipped.
+		toApply := make(map[string]struct{}, len(added))
+
+		for _, correlationId := range added {
+			toApply[correlationId] = struct{}{}
+		}
+
+		var (
+			committedIds []model.MessageId
+			removedIds   []model.MessageId
+		)
+
+		for _, cmd := range batch.Commits {
+			if _, ok := toApply[cmd.CorrelationId]; !ok {
+				slog.InfoContext(ctx, fmt.Sprintf("Command with correlation ID %v was handled before", cmd.CorrelationId))
+				reportDryRunError(ctx, fmt.Errorf("command with correlation ID %v was handled before", cmd.CorrelationId))
+				continue
+			}
+
+			delete(toApply, cmd.CorrelationId)
+			committedIds = append(committedIds, cmd.MessageId)
+		}
+
+		for _, cmd := range batch.Rollbacks {
+			if _, ok := toApply[cmd.CorrelationId]; !ok {
+				slog.InfoContext(ctx, fmt.Sprintf("Command with correlation ID %v was handled before", cmd.CorrelationId))
+				reportDryRunError(ctx, fmt.Errorf("command with correlation ID %v was handled before", cmd.CorrelationId))
+				continue
+			}
+
+			delete(toApply, cmd.CorrelationId)
+			removedIds = append(removedIds, cmd.MessageId)
+		}
+
+		committed, err = s.updateMessagesState(ctx, committedIds, model.MessageStateSent)
+
+		if err != nil {
+			return err
+		}
+
+		removed, err = s.updateMessagesState(ctx, removedIds, model.MessageStateRemoved)
+
+		return err
+	})
 
 	if err != nil {
 		return err
 	}
 
-	slog.Info(fmt.Sprintf("Message %v has been removed due to rollback", message.MessageId))
+	s.reportRejected(ctx, committed.rejected, model.MessageStateSent)
+	s.reportRejected(ctx, removed.rejected, model.MessageStateRemoved)
+
+	slog.InfoContext(
+		ctx,
+		fmt.Sprintf("%v messages have been committed, %v removed due to rollback", committed.updated, removed.updated))
 
 	return nil
 }
 
+type stateUpdate struct {
+	updated  int
+	rejected []model.MessageId
+}
+
+// updateMessagesState moves the messages to the given state if the state machine allows it. Messages
+// in any other state are left as is and returned as rejected. A missing message fails the update the
+// same way it fails a single command.
+func (s *AppService) updateMessagesState(
+	ctx context.Context,
+	ids []model.MessageId,
+	state model.MessageState,
+) (stateUpdate, error) {
+	if len(ids) == 0 {
+		return stateUpdate{}, nil
+	}
+
+	updated, err := s.dialogueRepository.UpdateMessagesState(ctx, ids, model.PreviousStates(state), state)
+
+	if err != nil {
+		return stateUpdate{}, err
+	}
+
+	result := stateUpdate{
+		updated: len(updated),
+	}
+
+	if len(updated) == len(ids) {
+		return result, nil
+	}
+
+	updatedIds := make(map[model.MessageId]struct{}, len(updated))
+
+	for _, id := range updated {
+		updatedIds[id] = struct{}{}
+	}
+
+	for _, id := range ids {
+		if _, ok := updatedIds[id]; ok {
+			continue
+		}
+
+		_, err = s.dialogueRepository.GetMessage(ctx, id)
+
+		if err != nil {
+			return stateUpdate{}, fmt.Errorf("failed to get message %v: %w", id, err)
+		}
+
+		result.rejected = append(result.rejected, id)
+	}
+
+	return result, nil
+}
+
+// reportRejected logs and counts the transitions of the messages the state machine rejected, or
+// reports them as errors if the commands are handled in a dry-run.
+func (s *AppService) reportRejected(ctx context.Context, ids []model.MessageId, state model.MessageState) {
+	for _, id := range ids {
+		rejected := fmt.Errorf("%w: message %v cannot move to %v", model.ErrInvalidStateTransition, id, state)
+
+		if reportDryRunError(ctx, rejected) {
+			continue
+		}
+
+		slog.WarnContext(ctx, fmt.Sprintf("Rejected transition: %v", rejected))
+		metrics.SagaRejectedTransitions.WithLabelValues(state.String()).Inc()
+	}
+}
+
 func (s *AppService) buildChatId(firstUser, secondUser model.UserId) model.ChatId {
 	if firstUser > secondUser {
 		return model.ChatId(fmt.Sprintf("%s_%s", secondUser, firstUser))
@@ -0,0 +1,516 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/fixture"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCommitMessage_ConcurrentDuplicateDelivery(t *testing.T) {
+	store := memory.NewStore()
+	dialogueRepository := newCountingDialogueRepository(store)
+	appService := NewAppService(
+		dialogueRepository,
+		nil,
+		memory.NewCommandRepository(store),
+		nil,
+		nil,
+		memory.NewTransactionManager(store),
+		nil)
+
+	id := fixture.AddPendingMessage(t, dialogueRepository.DialogueRepository)
+
+	cmd := model.CommitMessageCommand{
+		CorrelationId: "commit-1",
+		MessageId:     id,
+	}
+
+	const deliveries = 16
+
+	errs := make(chan error, deliveries)
+	wg := &sync.WaitGroup{}
+
+	for range deliveries {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs <- appService.CommitMessage(context.Background(), cmd)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("duplicate delivery failed: %v", err)
+		}
+	}
+
+	if updates := dialogueRepository.updates(); updates != 1 {
+		t.Errorf("message updated %v times, want 1", updates)
+	}
+
+	fixture.AssertState(t, dialogueRepository, id, model.MessageStateSent)
+}
+
+func TestRollbackMessage_RedeliveryIsSkipped(t *testing.T) {
+	dialogueRepository := newFakeDialogueRepository(&model.Message{MessageId: 1, State: model.MessageStatePending})
+	commandRepository := newFakeCommandRepository()
+	appService := NewAppService(dialogueRepository, nil, commandRepository, nil, nil, newFakeTransactionManager(), nil)
+
+	cmd := model.RollbackMessageCommand{
+		CorrelationId: "rollback-1",
+		MessageId:     1,
+	}
+
+	for range 2 {
+		err := appService.RollbackMessage(context.Background(), cmd)
+
+		if err != nil {
+			t.Fatalf("rollback failed: %v", err)
+		}
+	}
+
+	if updates := dialogueRepository.updates(); updates != 1 {
+		t.Errorf("message updated %v times, want 1", updates)
+	}
+
+	if state := dialogueRepository.state(1); state != model.MessageStateRemoved {
+		t.Errorf("message state is %v, want %v", state, model.MessageStateRemoved)
+	}
+}
+
+func TestCommitMessage_AfterRollbackIsRejected(t *testing.T) {
+	dialogueRepository := newFakeDialogueRepository(&model.Message{MessageId: 1, State: model.MessageStatePending})
+	commandRepository := newFakeCommandRepository()
+	appService := NewAppService(dialogueRepository, nil, commandRepository, nil, nil, newFakeTransactionManager(), nil)
+
+	err := appService.RollbackMessage(context.Background(), model.RollbackMessageCommand{
+		CorrelationId: "rollback-1",
+		MessageId:     1,
+	})
+
+	if err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+
+	rejected := metrics.SagaRejectedTransitions.WithLabelValues(model.MessageStateSent.String())
+	rejectedBefore := testutil.ToFloat64(rejected)
+
+	err = appService.CommitMessage(context.Background(), model.CommitMessageCommand{
+		CorrelationId: "commit-1",
+		MessageId:     1,
+	})
+
+	if err != nil {
+		t.Fatalf("late commit failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(rejected) - rejectedBefore; got != 1 {
+		t.Errorf("got %v rejected transitions counted, want 1", got)
+	}
+
+	if state := dialogueRepository.state(1); state != model.MessageStateRemoved {
+		t.Errorf("message state is %v, want %v", state, model.MessageStateRemoved)
+	}
+
+	if _, ok := commandRepository.handled["commit-1"]; !ok {
+		t.Errorf("rejected command is not recorded as handled")
+	}
+}
+
+func TestHandleCommands_ConcurrentDuplicateBatches(t *testing.T) {
+	store := memory.NewStore()
+	dialogueRepository := newCountingDialogueRepository(store)
+	appService := NewAppService(
+		dialogueRepository,
+		nil,
+		memory.NewCommandRepository(store),
+		nil,
+		nil,
+		memory.NewTransactionManager(store),
+		nil)
+
+	committed := fixture.AddPendingMessage(t, dialogueRepository.DialogueRepository)
+	removed := fixture.AddPendingMessage(t, dialogueRepository.DialogueRepository)
+
+	batch := model.CommandBatch{
+		Commits: []model.CommitMessageCommand{
+			{CorrelationId: "commit-1", MessageId: committed},
+			{CorrelationId: "commit-1", MessageId: committed},
+		},
+		Rollbacks: []model.RollbackMessageCommand{
+			{CorrelationId: "rollback-2", MessageId: removed},
+		},
+	}
+
+	const deliveries = 16
+
+	errs := make(chan error, deliveries)
+	wg := &sync.WaitGroup{}
+
+	for range deliveries {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs <- appService.HandleCommands(context.Background(), batch)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("duplicate batch failed: %v", err)
+		}
+	}
+
+	if updates := dialogueRepository.updates(); updates != 2 {
+		t.Errorf("messages updated %v times, want 2", updates)
+	}
+
+	fixture.AssertState(t, dialogueRepository, committed, model.MessageStateSent)
+	fixture.AssertState(t, dialogueRepository, removed, model.MessageStateRemoved)
+}
+
+func TestHandleCommands_MissingMessageFailsBatch(t *testing.T) {
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	appService := NewAppService(
+		dialogueRepository,
+		nil,
+		memory.NewCommandRepository(store),
+		nil,
+		nil,
+		memory.NewTransactionManager(store),
+		nil)
+
+	pending := fixture.AddPendingMessage(t, dialogueRepository)
+	removed := fixture.AddMessage(t, dialogueRepository, time.Now().UTC(), model.MessageStateRemoved)
+
+	batch := model.CommandBatch{
+		Commits: []model.CommitMessageCommand{
+			{CorrelationId: "commit-pending", MessageId: pending},
+			{CorrelationId: "commit-removed", MessageId: removed},
+			{CorrelationId: "commit-missing", MessageId: 1000},
+		},
+	}
+
+	err := appService.HandleCommands(context.Background(), batch)
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("got error %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// The batch is rolled back, so that the commands are handled one by one.
+	fixture.AssertState(t, dialogueRepository, pending, model.MessageStatePending)
+
+	batch.Commits = batch.Commits[:2]
+
+	err = appService.HandleCommands(context.Background(), batch)
+
+	if err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+
+	fixture.AssertState(t, dialogueRepository, pending, model.MessageStateSent)
+	fixture.AssertState(t, dialogueRepository, removed, model.MessageStateRemoved)
+}
+
+type fakeDialogueRepository struct {
+	mu          sync.Mutex
+	messages    map[model.MessageId]*model.Message
+	updateCount int
+}
+
+func newFakeDialogueRepository(messages ...*model.Message) *fakeDialogueRepository {
+	r := &fakeDialogueRepository{
+		messages: make(map[model.MessageId]*model.Message),
+	}
+
+	for _, message := range messages {
+		r.messages[message.MessageId] = message
+	}
+
+	return r
+}
+
+func (r *fakeDialogueRepository) AddMessage(context.Context, *model.Message) (model.MessageId, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (r *fakeDialogueRepository) GetVisibleMessages(
+	context.Context,
+	model.ChatId,
+	model.UserId,
+	[]model.MessageState,
+	*model.MessageCursor,
+	int,
+) ([]*model.Message, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeDialogueRepository) GetMessage(_ context.Context, id model.MessageId) (*model.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[id]
+
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	copied := *message
+
+	return &copied, nil
+}
+
+func (r *fakeDialogueRepository) UpdateMessage(
+	_ context.Context,
+	msg *model.Message,
+	expected model.MessageState,
+) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[msg.MessageId]
+
+	if !ok || message.State != expected {
+		return false, nil
+	}
+
+	message.State = msg.State
+	r.updateCount++
+
+	return true, nil
+}
+
+func (r *fakeDialogueRepository) UpdateMessagesState(
+	_ context.Context,
+	ids []model.MessageId,
+	expected []model.MessageState,
+	state model.MessageState,
+) ([]model.MessageId, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var updated []model.MessageId
+
+	for _, id := range ids {
+		message, ok := r.messages[id]
+
+		if !ok || !slices.Contains(expected, message.State) {
+			continue
+		}
+
+		message.State = state
+		r.updateCount++
+		updated = append(updated, id)
+	}
+
+	return updated, nil
+}
+
+func (r *fakeDialogueRepository) updates() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.updateCount
+}
+
+func (r *fakeDialogueRepository) state(id model.MessageId) model.MessageState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.messages[id].State
+}
+
+// fakeCommandRepository mimics insert ... on conflict do nothing: of concurrent inserts of the
+// same correlation ID exactly one succeeds.
+type fakeCommandRepository struct {
+	mu      sync.Mutex
+	handled map[string]struct{}
+}
+
+func newFakeCommandRepository() *fakeCommandRepository {
+	return &fakeCommandRepository{
+		handled: make(map[string]struct{}),
+	}
+}
+
+func (r *fakeCommandRepository) Add(_ context.Context, correlationId string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.handled[correlationId]; ok {
+		return false, nil
+	}
+
+	r.handled[correlationId] = struct{}{}
+
+	return true, nil
+}
+
+func (r *fakeCommandRepository) AddMany(_ context.Context, correlationIds []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var added []string
+
+	for _, correlationId := range correlationIds {
+		if _, ok := r.handled[correlationId]; ok {
+			continue
+		}
+
+		r.handled[correlationId] = struct{}{}
+		added = append(added, correlationId)
+	}
+
+	return added, nil
+}
+
+// countingDialogueRepository counts the messages updated in the in-memory store.
+type countingDialogueRepository struct {
+	*memory.DialogueRepository
+
+	mu          sync.Mutex
+	updateCount int
+}
+
+func newCountingDialogueRepository(store *memory.Store) *countingDialogueRepository {
+	return &countingDialogueRepository{
+		DialogueRepository: memory.NewDialogueRepository(store),
+	}
+}
+
+func (r *countingDialogueRepository) UpdateMessage(
+	ctx context.Context,
+	msg *model.Message,
+	expected model.MessageState,
+) (bool, error) {
+	updated, err := r.DialogueRepository.UpdateMessage(ctx, msg, expected)
+
+	if updated {
+		r.count(1)
+	}
+
+	return updated, err
+}
+
+func (r *countingDialogueRepository) UpdateMessagesState(
+	ctx context.Context,
+	ids []model.MessageId,
+	expected []model.MessageState,
+	next model.MessageState,
+) ([]model.MessageId, error) {
+	updated, err := r.DialogueRepository.UpdateMessagesState(ctx, ids, expected, next)
+
+	r.count(len(updated))
+
+	return updated, err
+}
+
+// count adds the updates right away, as every transaction of the tests commits.
+func (r *countingDialogueRepository) count(updates int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.updateCount += updates
+}
+
+func (r *countingDialogueRepository) updates() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.updateCount
+}
+
+// fakeTransactionManager runs the function right away, the fake repositories do not need a transaction.
+type fakeTransactionManager struct{}
+
+func newFakeTransactionManager() *fakeTransactionManager {
+	return &fakeTransactionManager{}
+}
+
+func (tm *fakeTransactionManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestSendMessage_PendingMessageIsVisibleToSenderOnly(t *testing.T) {
+	store := memory.NewStore()
+	appService := NewAppService(
+		memory.NewDialogueRepository(store),
+		memory.NewOutboxRepository(store),
+		memory.NewCommandRepository(store),
+		memory.NewUnreadRepository(store),
+		nil,
+		memory.NewTransactionManager(store),
+		newOutboxRegistry(t))
+
+	ctx := context.Background()
+
+	err := appService.SendMessage(ctx, model.SendMessageCommand{FromUserId: "alice", ToUserId: "bob", Text: "hi"})
+
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	senderPage, err := appService.GetMessages(ctx, model.GetMessagesCommand{FromUserId: "alice", ToUserId: "bob"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	senderMessages := senderPage.Messages
+
+	if len(senderMessages) != 1 || senderMessages[0].State != model.MessageStatePending {
+		t.Fatalf("sender sees %v, want one pending message", senderMessages)
+	}
+
+	peerPage, err := appService.GetMessages(ctx, model.GetMessagesCommand{FromUserId: "bob", ToUserId: "alice"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerMessages := peerPage.Messages
+
+	if len(peerMessages) != 0 {
+		t.Fatalf("peer sees %v pending messages", len(peerMessages))
+	}
+
+	err = appService.CommitMessage(ctx, model.CommitMessageCommand{
+		CorrelationId: "commit-1",
+		MessageId:     senderMessages[0].MessageId,
+	})
+
+	if err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	peerPage, err = appService.GetMessages(ctx, model.GetMessagesCommand{FromUserId: "bob", ToUserId: "alice"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerMessages = peerPage.Messages
+
+	if len(peerMessages) != 1 || peerMessages[0].State != model.MessageStateSent {
+		t.Fatalf("peer sees %v, want one sent message", peerMessages)
+	}
+}
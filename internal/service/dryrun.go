@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// errDryRun rolls back the transaction of a dry-run.
+var errDryRun = errors.New("dry run")
+
+type dryRunKey struct{}
+
+// dryRun collects the outcomes of commands handled in a dry-run that are not reported as errors otherwise.
+type dryRun struct {
+	rejected error
+}
+
+// DryRun calls fn, which handles commands, in a transaction that is rolled back afterwards, so nothing
+// is changed. Commands handled before and transitions the state machine rejects are reported as errors,
+// although handling such commands for real only skips them.
+func (s *AppService) DryRun(ctx context.Context, fn func(ctx context.Context) error) error {
+	report := &dryRun{}
+	ctx = context.WithValue(ctx, dryRunKey{}, report)
+
+	err := s.transactionManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		report.rejected = nil
+
+		err := fn(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return errDryRun
+	})
+
+	if !errors.Is(err, errDryRun) {
+		return err
+	}
+
+	return report.rejected
+}
+
+// reportDryRunError records the reason a command is skipped if it is handled in a dry-run and reports
+// whether it is. The reasons of every command skipped within the dry-run are kept.
+func reportDryRunError(ctx context.Context, rejected error) bool {
+	report, ok := ctx.Value(dryRunKey{}).(*dryRun)
+
+	if ok {
+		report.rejected = errors.Join(report.rejected, rejected)
+	}
+
+	return ok
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/fixture"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+)
+
+func TestDryRun_ReportsOutcomeWithoutChanges(t *testing.T) {
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	commandRepository := memory.NewCommandRepository(store)
+	appService := NewAppService(
+		dialogueRepository,
+		memory.NewOutboxRepository(store),
+		commandRepository,
+		memory.NewUnreadRepository(store),
+		nil,
+		memory.NewTransactionManager(store),
+		newOutboxRegistry(t))
+
+	ctx := context.Background()
+	pending := fixture.AddMessage(t, dialogueRepository, time.Now().UTC(), model.MessageStatePending)
+	removed := fixture.AddMessage(t, dialogueRepository, time.Now().UTC(), model.MessageStateRemoved)
+
+	_, err := commandRepository.Add(ctx, "handled")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(correlationId string, id model.MessageId) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			return appService.CommitMessage(ctx, model.CommitMessageCommand{CorrelationId: correlationId, MessageId: id})
+		}
+	}
+
+	err = appService.DryRun(ctx, commit("commit-pending", pending))
+
+	if err != nil {
+		t.Errorf("dry-run of an applicable command failed: %v", err)
+	}
+
+	err = appService.DryRun(ctx, commit("commit-removed", removed))
+
+	if !errors.Is(err, model.ErrInvalidStateTransition) {
+		t.Errorf("dry-run of a rejected transition got error %v, want %v", err, model.ErrInvalidStateTransition)
+	}
+
+	err = appService.DryRun(ctx, commit("handled", pending))
+
+	if err == nil {
+		t.Errorf("dry-run of a command handled before succeeded")
+	}
+
+	msg, err := dialogueRepository.GetMessage(ctx, pending)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.State != model.MessageStatePending {
+		t.Errorf("dry-run changed the state of the message to %v", msg.State)
+	}
+
+	for _, correlationId := range []string{"commit-pending", "commit-removed"} {
+		added, err := commandRepository.Add(ctx, correlationId)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !added {
+			t.Errorf("dry-run recorded command %v as handled", correlationId)
+		}
+	}
+}
+
+func TestDryRun_ReportsRejectionsOfBatch(t *testing.T) {
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	commandRepository := memory.NewCommandRepository(store)
+	appService := NewAppService(
+		dialogueRepository,
+		memory.NewOutboxRepository(store),
+		commandRepository,
+		memory.NewUnreadRepository(store),
+		nil,
+		memory.NewTransactionManager(store),
+		nil)
+
+	ctx := context.Background()
+	pending := fixture.AddPendingMessage(t, dialogueRepository)
+	removed := fixture.AddMessage(t, dialogueRepository, time.Now().UTC(), model.MessageStateRemoved)
+
+	_, err := commandRepository.Add(ctx, "handled")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle := func(batch model.CommandBatch) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			return appService.HandleCommands(ctx, batch)
+		}
+	}
+
+	err = appService.DryRun(ctx, handle(model.CommandBatch{
+		Commits: []model.CommitMessageCommand{{CorrelationId: "commit-pending", MessageId: pending}},
+	}))
+
+	if err != nil {
+		t.Errorf("dry-run of an applicable batch failed: %v", err)
+	}
+
+	err = appService.DryRun(ctx, handle(model.CommandBatch{
+		Commits:   []model.CommitMessageCommand{{CorrelationId: "commit-pending", MessageId: pending}},
+		Rollbacks: []model.RollbackMessageCommand{{CorrelationId: "rollback-removed", MessageId: removed}},
+	}))
+
+	if !errors.Is(err, model.ErrInvalidStateTransition) {
+		t.Errorf("dry-run of a batch with a rejected transition got error %v, want %v", err, model.ErrInvalidStateTransition)
+	}
+
+	err = appService.DryRun(ctx, handle(model.CommandBatch{
+		Commits: []model.CommitMessageCommand{{CorrelationId: "handled", MessageId: pending}},
+	}))
+
+	if err == nil {
+		t.Errorf("dry-run of a batch with a command handled before succeeded")
+	}
+
+	fixture.AssertState(t, dialogueRepository, pending, model.MessageStatePending)
+}
@@ -0,0 +1,12 @@
+package service
+
+import (
+	"context"
+)
+
+// ILeaderLock lets a single replica at a time run a job that must not run concurrently.
+type ILeaderLock interface {
+	// TryLock takes the lock of the given name unless another replica holds it. The returned
+	// function releases the lock.
+	TryLock(ctx context.Context, name string) (func(), bool, error)
+}
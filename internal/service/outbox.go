@@ -2,17 +2,12 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
 	"github.com/orochi-keydream/dialogue-service/internal/model"
 )
 
-// TODO: Move it somewhere else.
-type ITransactionManager interface {
-	Begin(ctx context.Context) (*sql.Tx, error)
-	Commit(tx *sql.Tx) error
-	Rollback(tx *sql.Tx) error
-}
-
 type OutboxService struct {
 	outboxRepository   IOutboxRepository
 	producer           IOutboxProducer
@@ -36,21 +31,48 @@ func NewOutboxService(
 }
 
 func (s *OutboxService) Send(ctx context.Context) error {
-	messages, err := s.outboxRepository.GetUnsent(ctx, nil)
+	messages, err := s.outboxRepository.GetUnsent(ctx)
 
 	if err != nil {
 		return err
 	}
 
+	metrics.OutboxBatchSize.Observe(float64(len(messages)))
+
 	for _, message := range messages {
+		labels := []string{message.Type.String(), message.Topic}
+		start := time.Now()
+
 		err = s.producer.SendMessage(message)
 
 		if err != nil {
+			metrics.OutboxPublishErrors.WithLabelValues(labels...).Inc()
 			return err
 		}
 
+		metrics.OutboxPublishDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		metrics.OutboxDeliveryLatency.WithLabelValues(labels...).Observe(time.Since(message.CreatedAt).Seconds())
+
 		message.IsSent = true
 	}
 
-	return s.outboxRepository.Update(ctx, messages, nil)
+	return s.outboxRepository.Update(ctx, messages)
+}
+
+func (s *OutboxService) ReportBacklog(ctx context.Context) error {
+	backlog, err := s.outboxRepository.GetBacklog(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	metrics.OutboxUnsentMessages.Set(float64(backlog.UnsentCount))
+
+	if backlog.UnsentCount == 0 {
+		metrics.OutboxOldestUnsentAge.Set(0)
+	} else {
+		metrics.OutboxOldestUnsentAge.Set(time.Now().UTC().Sub(backlog.OldestUnsentAt).Seconds())
+	}
+
+	return nil
 }
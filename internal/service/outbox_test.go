@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/fixture"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOutboxService_SendPublishesAndMarksMessages(t *testing.T) {
+	store := memory.NewStore()
+	outboxRepository := memory.NewOutboxRepository(store)
+	producer := &fakeOutboxProducer{}
+	outboxService := NewOutboxService(outboxRepository, producer, memory.NewTransactionManager(store))
+
+	ctx := context.Background()
+
+	for _, key := range []string{"first", "second"} {
+		err := outboxRepository.Add(ctx, &model.OutboxMessage{
+			Type:  model.OutboxMessageTypeAddNewUnreadMessage,
+			Topic: "publish_duration",
+			Key:   []byte(key),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publishDuration := metrics.OutboxPublishDuration.WithLabelValues(model.OutboxMessageTypeAddNewUnreadMessage.String(), "publish_duration")
+	batchesBefore, _ := fixture.HistogramSamples(t, metrics.OutboxBatchSize)
+
+	err := outboxService.Send(ctx)
+
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if published, _ := fixture.HistogramSamples(t, publishDuration); published != 2 {
+		t.Errorf("got %v publish durations observed, want 2", published)
+	}
+
+	if batches, _ := fixture.HistogramSamples(t, metrics.OutboxBatchSize); batches-batchesBefore != 1 {
+		t.Errorf("got %v batch sizes observed, want 1", batches-batchesBefore)
+	}
+
+	if len(producer.sent) != 2 || string(producer.sent[0].Key) != "first" || string(producer.sent[1].Key) != "second" {
+		t.Errorf("messages are not published in order: %v", producer.sent)
+	}
+
+	unsent, err := outboxRepository.GetUnsent(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unsent) != 0 {
+		t.Errorf("%v messages left unsent", len(unsent))
+	}
+}
+
+func TestOutboxService_SendKeepsMessagesOnFailure(t *testing.T) {
+	store := memory.NewStore()
+	outboxRepository := memory.NewOutboxRepository(store)
+	producer := &fakeOutboxProducer{err: errors.New("broker is down")}
+	outboxService := NewOutboxService(outboxRepository, producer, memory.NewTransactionManager(store))
+
+	ctx := context.Background()
+
+	err := outboxRepository.Add(ctx, &model.OutboxMessage{
+		Type:  model.OutboxMessageTypeAddNewUnreadMessage,
+		Topic: "counter_commands",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publishErrors := metrics.OutboxPublishErrors.WithLabelValues(model.OutboxMessageTypeAddNewUnreadMessage.String(), "counter_commands")
+	errorsBefore := testutil.ToFloat64(publishErrors)
+
+	err = outboxService.Send(ctx)
+
+	if err == nil {
+		t.Fatalf("send succeeded with the producer failing")
+	}
+
+	if got := testutil.ToFloat64(publishErrors) - errorsBefore; got != 1 {
+		t.Errorf("got %v publish errors counted, want 1", got)
+	}
+
+	unsent, err := outboxRepository.GetUnsent(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unsent) != 1 {
+		t.Errorf("%v messages left unsent, want 1", len(unsent))
+	}
+}
+
+func TestOutboxService_SendObservesDeliveryLatency(t *testing.T) {
+	outboxRepository := &fakeOutboxRepository{}
+	outboxService := NewOutboxService(outboxRepository, &fakeOutboxProducer{}, newFakeTransactionManager())
+
+	ctx := context.Background()
+
+	err := outboxRepository.Add(ctx, &model.OutboxMessage{
+		Type:      model.OutboxMessageTypeAddNewUnreadMessage,
+		Topic:     "delivery_latency",
+		CreatedAt: time.Now().UTC().Add(-time.Minute),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latency := metrics.OutboxDeliveryLatency.WithLabelValues(model.OutboxMessageTypeAddNewUnreadMessage.String(), "delivery_latency")
+
+	err = outboxService.Send(ctx)
+
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	count, sum := fixture.HistogramSamples(t, latency)
+
+	if count != 1 || sum < time.Minute.Seconds() {
+		t.Errorf("got %v latency samples summing to %vs, want one of at least a minute", count, sum)
+	}
+}
+
+func TestOutboxService_ReportBacklog(t *testing.T) {
+	store := memory.NewStore()
+	outboxRepository := memory.NewOutboxRepository(store)
+	outboxService := NewOutboxService(outboxRepository, &fakeOutboxProducer{}, memory.NewTransactionManager(store))
+
+	ctx := context.Background()
+
+	err := outboxService.ReportBacklog(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unsent, age := testutil.ToFloat64(metrics.OutboxUnsentMessages), testutil.ToFloat64(metrics.OutboxOldestUnsentAge); unsent != 0 || age != 0 {
+		t.Errorf("got %v unsent messages aged %vs reported for empty outbox", unsent, age)
+	}
+
+	for range 2 {
+		err = outboxRepository.Add(ctx, &model.OutboxMessage{
+			Type:  model.OutboxMessageTypeAddNewUnreadMessage,
+			Topic: "counter_commands",
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = outboxService.ReportBacklog(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unsent := testutil.ToFloat64(metrics.OutboxUnsentMessages); unsent != 2 {
+		t.Errorf("got %v unsent messages reported, want 2", unsent)
+	}
+
+	if age := testutil.ToFloat64(metrics.OutboxOldestUnsentAge); age <= 0 {
+		t.Errorf("got oldest unsent message aged %vs reported, want it positive", age)
+	}
+}
+
+type fakeOutboxProducer struct {
+	sent []*model.OutboxMessage
+	err  error
+}
+
+func (p *fakeOutboxProducer) SendMessage(message *model.OutboxMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	p.sent = append(p.sent, message)
+
+	return nil
+}
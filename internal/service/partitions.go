@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+)
+
+type IPartitionRepository interface {
+	GetMessagePartitions(ctx context.Context) ([]model.MessagePartition, error)
+	CreateMessagePartition(ctx context.Context, partition model.MessagePartition) error
+	HasMessages(ctx context.Context, partition model.MessagePartition) (bool, error)
+	DetachMessagePartition(ctx context.Context, partition model.MessagePartition) error
+}
+
+// PartitionManager keeps monthly partitions of the messages table created ahead of time and detaches
+// the ones past the retention period. A partition is detached only once it has no messages left, that
+// is once the archiver has moved all of them, so that detaching never loses history.
+type PartitionManager struct {
+	partitionRepository IPartitionRepository
+	cfg                 config.PartitioningConfig
+}
+
+func NewPartitionManager(partitionRepository IPartitionRepository, cfg config.PartitioningConfig) *PartitionManager {
+	return &PartitionManager{
+		partitionRepository: partitionRepository,
+		cfg:                 cfg,
+	}
+}
+
+func (m *PartitionManager) Maintain(ctx context.Context) error {
+	return m.maintain(ctx, time.Now().UTC())
+}
+
+func (m *PartitionManager) maintain(ctx context.Context, now time.Time) error {
+	partitions, err := m.partitionRepository.GetMessagePartitions(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	attached := make(map[string]bool, len(partitions))
+
+	for _, partition := range partitions {
+		attached[partition.Name] = true
+	}
+
+	current := model.NewMessagePartition(now)
+
+	for i := 0; i <= m.cfg.PremakeMonths; i++ {
+		partition := model.NewMessagePartition(current.From.AddDate(0, i, 0))
+
+		if attached[partition.Name] {
+			continue
+		}
+
+		err = m.partitionRepository.CreateMessagePartition(ctx, partition)
+
+		if err != nil {
+			return fmt.Errorf("failed to create partition %v: %w", partition.Name, err)
+		}
+
+		attached[partition.Name] = true
+		metrics.MessagePartitionsCreated.Inc()
+
+		slog.InfoContext(ctx, fmt.Sprintf("Partition %v created", partition.Name))
+	}
+
+	if m.cfg.RetentionMonths > 0 {
+		retainedFrom := current.From.AddDate(0, -m.cfg.RetentionMonths, 0)
+
+		for _, partition := range partitions {
+			if partition.To.After(retainedFrom) {
+				continue
+			}
+
+			hasMessages, err := m.partitionRepository.HasMessages(ctx, partition)
+
+			if err != nil {
+				return fmt.Errorf("failed to check messages of partition %v: %w", partition.Name, err)
+			}
+
+			if hasMessages {
+				slog.WarnContext(ctx, fmt.Sprintf("Partition %v past retention is kept since its messages are not archived", partition.Name))
+				continue
+			}
+
+			err = m.partitionRepository.DetachMessagePartition(ctx, partition)
+
+			if err != nil {
+				return fmt.Errorf("failed to detach partition %v: %w", partition.Name, err)
+			}
+
+			delete(attached, partition.Name)
+			metrics.MessagePartitionsDetached.Inc()
+
+			slog.InfoContext(ctx, fmt.Sprintf("Partition %v detached", partition.Name))
+		}
+	}
+
+	metrics.MessagePartitions.Set(float64(len(attached)))
+
+	return nil
+}
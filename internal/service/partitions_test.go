@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMaintain_CreatesPartitionsAhead(t *testing.T) {
+	now := time.Date(2024, time.November, 15, 12, 0, 0, 0, time.UTC)
+
+	partitionRepository := &fakePartitionRepository{}
+	partitionRepository.attach("messages_p2024_11")
+
+	manager := NewPartitionManager(partitionRepository, config.PartitioningConfig{PremakeMonths: 2})
+	createdBefore := testutil.ToFloat64(metrics.MessagePartitionsCreated)
+
+	err := manager.maintain(context.Background(), now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"messages_p2024_12", "messages_p2025_01"}
+
+	if !slices.Equal(partitionRepository.created, want) {
+		t.Errorf("got created partitions %v, want %v", partitionRepository.created, want)
+	}
+
+	if len(partitionRepository.detached) != 0 {
+		t.Errorf("got detached partitions %v without retention configured", partitionRepository.detached)
+	}
+
+	if got := testutil.ToFloat64(metrics.MessagePartitionsCreated) - createdBefore; got != 2 {
+		t.Errorf("got %v created partitions counted, want 2", got)
+	}
+
+	if got := testutil.ToFloat64(metrics.MessagePartitions); got != 3 {
+		t.Errorf("got %v attached partitions reported, want 3", got)
+	}
+}
+
+func TestMaintain_DetachesArchivedPartitionsPastRetention(t *testing.T) {
+	now := time.Date(2024, time.November, 15, 12, 0, 0, 0, time.UTC)
+
+	partitionRepository := &fakePartitionRepository{}
+
+	for _, name := range []string{"messages_p2024_07", "messages_p2024_08", "messages_p2024_09", "messages_p2024_10", "messages_p2024_11"} {
+		partitionRepository.attach(name)
+	}
+
+	// The messages of the oldest partition are all archived, while the next one still has unarchived ones.
+	partitionRepository.nonEmpty = []string{"messages_p2024_08"}
+
+	manager := NewPartitionManager(partitionRepository, config.PartitioningConfig{RetentionMonths: 2})
+	detachedBefore := testutil.ToFloat64(metrics.MessagePartitionsDetached)
+
+	err := manager.maintain(context.Background(), now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"messages_p2024_07"}
+
+	if !slices.Equal(partitionRepository.detached, want) {
+		t.Errorf("got detached partitions %v, want %v", partitionRepository.detached, want)
+	}
+
+	if len(partitionRepository.created) != 0 {
+		t.Errorf("got created partitions %v, want none", partitionRepository.created)
+	}
+
+	if got := testutil.ToFloat64(metrics.MessagePartitionsDetached) - detachedBefore; got != 1 {
+		t.Errorf("got %v detached partitions counted, want 1", got)
+	}
+}
+
+type fakePartitionRepository struct {
+	partitions []model.MessagePartition
+	// nonEmpty holds the names of the partitions with messages left.
+	nonEmpty []string
+	created  []string
+	detached []string
+}
+
+func (r *fakePartitionRepository) attach(name string) {
+	partition, err := model.ParseMessagePartition(name)
+
+	if err != nil {
+		panic(err)
+	}
+
+	r.partitions = append(r.partitions, partition)
+}
+
+func (r *fakePartitionRepository) GetMessagePartitions(context.Context) ([]model.MessagePartition, error) {
+	return slices.Clone(r.partitions), nil
+}
+
+func (r *fakePartitionRepository) CreateMessagePartition(_ context.Context, partition model.MessagePartition) error {
+	r.partitions = append(r.partitions, partition)
+	r.created = append(r.created, partition.Name)
+	return nil
+}
+
+func (r *fakePartitionRepository) HasMessages(_ context.Context, partition model.MessagePartition) (bool, error) {
+	return slices.Contains(r.nonEmpty, partition.Name), nil
+}
+
+func (r *fakePartitionRepository) DetachMessagePartition(_ context.Context, partition model.MessagePartition) error {
+	r.partitions = slices.DeleteFunc(r.partitions, func(p model.MessagePartition) bool { return p.Name == partition.Name })
+	r.detached = append(r.detached, partition.Name)
+	return nil
+}
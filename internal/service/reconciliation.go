@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/outbox"
+)
+
+type IUnreadAggregateRepository interface {
+	GetAggregates(
+		ctx context.Context,
+		after model.UnreadKey,
+		settledBefore time.Time,
+		limit int,
+	) ([]*model.UnreadAggregate, error)
+}
+
+type ICounterClient interface {
+	GetUnreadCounts(ctx context.Context, keys []model.UnreadKey) (map[model.UnreadKey]int64, error)
+}
+
+// Reconciler compares unread counters computed from the messages and read watermarks with the ones
+// the counter service reports and emits corrective commands for the drifted ones. A counter is adjusted
+// once per state of the chat: until a message is sent or read in the chat, later runs skip it even if
+// the counter service has not applied the adjustment yet.
+type Reconciler struct {
+	unreadRepository   IUnreadAggregateRepository
+	outboxRepository   IOutboxRepository
+	commandRepository  ICommandRepository
+	transactionManager ITransactionManager
+	outboxRegistry     *outbox.Registry
+	counterClient      ICounterClient
+	cfg                config.ReconciliationConfig
+}
+
+func NewReconciler(
+	unreadRepository IUnreadAggregateRepository,
+	outboxRepository IOutboxRepository,
+	commandRepository ICommandRepository,
+	transactionManager ITransactionManager,
+	outboxRegistry *outbox.Registry,
+	counterClient ICounterClient,
+	cfg config.ReconciliationConfig,
+) *Reconciler {
+	return &Reconciler{
+		unreadRepository:   unreadRepository,
+		outboxRepository:   outboxRepository,
+		commandRepository:  commandRepository,
+		transactionManager: transactionManager,
+		outboxRegistry:     outboxRegistry,
+		counterClient:      counterClient,
+		cfg:                cfg,
+	}
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	settledBefore := time.Now().UTC().Add(-r.cfg.SettleTime)
+
+	var (
+		after   model.UnreadKey
+		checked int
+		drifted int
+	)
+
+	for {
+		aggregates, err := r.unreadRepository.GetAggregates(ctx, after, settledBefore, r.cfg.BatchSize)
+
+		if err != nil {
+			return err
+		}
+
+		if len(aggregates) == 0 {
+			break
+		}
+
+		batchDrifted, err := r.reconcileBatch(ctx, aggregates)
+
+		if err != nil {
+			return err
+		}
+
+		checked += len(aggregates)
+		drifted += batchDrifted
+		after = aggregates[len(aggregates)-1].Key
+
+		if len(aggregates) < r.cfg.BatchSize {
+			break
+		}
+	}
+
+	slog.InfoContext(ctx, fmt.Sprintf("Reconciled %v unread counters, %v of them adjusted", checked, drifted))
+
+	return nil
+}
+
+func (r *Reconciler) reconcileBatch(ctx context.Context, aggregates []*model.UnreadAggregate) (int, error) {
+	keys := make([]model.UnreadKey, len(aggregates))
+
+	for i, aggregate := range aggregates {
+		keys[i] = aggregate.Key
+	}
+
+	counts, err := r.counterClient.GetUnreadCounts(ctx, keys)
+
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.ReconciliationCheckedCounters.Add(float64(len(aggregates)))
+
+	var adjustments []model.AdjustUnreadCounter
+
+	for _, aggregate := range aggregates {
+		// A counter unknown to the counter service is the same as zero.
+		delta := aggregate.Count - counts[aggregate.Key]
+
+		if delta == 0 {
+			continue
+		}
+
+		slog.WarnContext(
+			ctx,
+			fmt.Sprintf("Unread counter of user %v in chat %v drifted: expected %v, actual %v",
+				aggregate.Key.UserId,
+				aggregate.Key.ChatId,
+				aggregate.Count,
+				counts[aggregate.Key]))
+
+		adjustments = append(adjustments, model.AdjustUnreadCounter{
+			CorrelationId: adjustmentCorrelationId(aggregate),
+			UserId:        aggregate.Key.UserId,
+			ChatId:        aggregate.Key.ChatId,
+			Delta:         delta,
+		})
+	}
+
+	if len(adjustments) == 0 {
+		return 0, nil
+	}
+
+	emitted := 0
+
+	err = r.transactionManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		emitted = 0
+
+		for _, adjustment := range adjustments {
+			added, err := r.commandRepository.Add(ctx, adjustment.CorrelationId)
+
+			if err != nil {
+				return err
+			}
+
+			if !added {
+				slog.InfoContext(
+					ctx,
+					fmt.Sprintf("Unread counter of user %v in chat %v has already been adjusted",
+						adjustment.UserId,
+						adjustment.ChatId))
+
+				continue
+			}
+
+			outboxMessage, err := outbox.NewMessage(ctx, r.outboxRegistry, adjustment)
+
+			if err != nil {
+				return err
+			}
+
+			err = r.outboxRepository.Add(ctx, outboxMessage)
+
+			if err != nil {
+				return err
+			}
+
+			emitted++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.ReconciliationDriftedCounters.Add(float64(emitted))
+
+	return emitted, nil
+}
+
+// adjustmentCorrelationId identifies the adjustment by the state of the chat it was computed for, so
+// the same drift observed again is recognised as already adjusted.
+func adjustmentCorrelationId(aggregate *model.UnreadAggregate) string {
+	return fmt.Sprintf(
+		"adjust-unread-counter:%v:%v:%v:%v",
+		aggregate.Key.ChatId,
+		aggregate.Key.UserId,
+		aggregate.LastMessageId,
+		aggregate.LastReadMessageId)
+}
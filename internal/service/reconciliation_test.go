@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/counter"
+	"github.com/orochi-keydream/dialogue-service/internal/kafka/producer"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/outbox"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReconcile_EmitsAdjustmentsForDriftedCounters(t *testing.T) {
+	inSync := model.UnreadKey{UserId: "alice", ChatId: "alice_bob"}
+	behind := model.UnreadKey{UserId: "bob", ChatId: "alice_bob"}
+	ahead := model.UnreadKey{UserId: "carol", ChatId: "alice_carol"}
+	unknown := model.UnreadKey{UserId: "dave", ChatId: "alice_dave"}
+
+	unreadRepository := &fakeUnreadAggregateRepository{
+		aggregates: []*model.UnreadAggregate{
+			{Key: inSync, Count: 2},
+			{Key: behind, Count: 5},
+			{Key: ahead, Count: 0},
+			{Key: unknown, Count: 1},
+		},
+	}
+
+	counterClient := counter.NewFakeClient()
+	counterClient.Set(inSync, 2)
+	counterClient.Set(behind, 3)
+	counterClient.Set(ahead, 4)
+
+	outboxRepository := &fakeOutboxRepository{}
+
+	reconciler := NewReconciler(
+		unreadRepository,
+		outboxRepository,
+		newFakeCommandRepository(),
+		newFakeTransactionManager(),
+		newOutboxRegistry(t),
+		counterClient,
+		config.ReconciliationConfig{BatchSize: 2})
+
+	checkedBefore := testutil.ToFloat64(metrics.ReconciliationCheckedCounters)
+	driftedBefore := testutil.ToFloat64(metrics.ReconciliationDriftedCounters)
+
+	err := reconciler.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("reconciliation failed: %v", err)
+	}
+
+	want := map[model.UnreadKey]int64{
+		behind:  2,
+		ahead:   -4,
+		unknown: 1,
+	}
+
+	got := make(map[model.UnreadKey]int64)
+
+	for _, message := range outboxRepository.messages {
+		if message.Type != model.OutboxMessageTypeAdjustUnreadCounter {
+			t.Fatalf("unexpected outbox message type %v", message.Type)
+		}
+
+		var dto outbox.AdjustUnreadCounterDto
+
+		err = json.Unmarshal(message.Value, &dto)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got[model.UnreadKey{UserId: model.UserId(dto.UserId), ChatId: model.ChatId(dto.ChatId)}] = dto.Delta
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %v adjustments, want %v", got, want)
+	}
+
+	for key, delta := range want {
+		if got[key] != delta {
+			t.Errorf("adjustment of %v is %v, want %v", key, got[key], delta)
+		}
+	}
+
+	if checked := testutil.ToFloat64(metrics.ReconciliationCheckedCounters) - checkedBefore; checked != 4 {
+		t.Errorf("got %v checked counters counted, want 4", checked)
+	}
+
+	if drifted := testutil.ToFloat64(metrics.ReconciliationDriftedCounters) - driftedBefore; drifted != 3 {
+		t.Errorf("got %v drifted counters counted, want 3", drifted)
+	}
+}
+
+func TestReconcile_AdjustsUnchangedChatOnce(t *testing.T) {
+	key := model.UnreadKey{UserId: "bob", ChatId: "alice_bob"}
+
+	unreadRepository := &fakeUnreadAggregateRepository{
+		aggregates: []*model.UnreadAggregate{
+			{Key: key, Count: 5, LastMessageId: 7, LastReadMessageId: 2},
+		},
+	}
+
+	// The counter service never applies the adjustment, so the drift is observed on every run.
+	counterClient := counter.NewFakeClient()
+	counterClient.Set(key, 3)
+
+	outboxRepository := &fakeOutboxRepository{}
+
+	reconciler := NewReconciler(
+		unreadRepository,
+		outboxRepository,
+		newFakeCommandRepository(),
+		newFakeTransactionManager(),
+		newOutboxRegistry(t),
+		counterClient,
+		config.ReconciliationConfig{BatchSize: 10})
+
+	for range 2 {
+		err := reconciler.Reconcile(context.Background())
+
+		if err != nil {
+			t.Fatalf("reconciliation failed: %v", err)
+		}
+	}
+
+	if len(outboxRepository.messages) != 1 {
+		t.Fatalf("got %v adjustments, want 1", len(outboxRepository.messages))
+	}
+
+	// A message read in the chat changes its state, so the drift observed after that is adjusted again.
+	unreadRepository.aggregates[0].LastReadMessageId = 3
+	unreadRepository.aggregates[0].Count = 4
+
+	err := reconciler.Reconcile(context.Background())
+
+	if err != nil {
+		t.Fatalf("reconciliation failed: %v", err)
+	}
+
+	if len(outboxRepository.messages) != 2 {
+		t.Fatalf("got %v adjustments, want 2", len(outboxRepository.messages))
+	}
+}
+
+func newOutboxRegistry(t *testing.T) *outbox.Registry {
+	configs := config.ProducerConfigs{}
+
+	for _, messageType := range model.OutboxMessageTypes() {
+		configs[messageType.String()] = config.ProducerConfig{Topic: "counter_commands"}
+	}
+
+	router, err := producer.NewRouter(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := outbox.NewRegistry("dialogue-service", router, nil)
+	err = outbox.RegisterEvents(context.Background(), registry)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return registry
+}
+
+type fakeUnreadAggregateRepository struct {
+	aggregates []*model.UnreadAggregate
+}
+
+func (r *fakeUnreadAggregateRepository) GetAggregates(
+	_ context.Context,
+	after model.UnreadKey,
+	_ time.Time,
+	limit int,
+) ([]*model.UnreadAggregate, error) {
+	sorted := append([]*model.UnreadAggregate(nil), r.aggregates...)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return unreadKeyLess(sorted[i].Key, sorted[j].Key)
+	})
+
+	var page []*model.UnreadAggregate
+
+	for _, aggregate := range sorted {
+		if !unreadKeyLess(after, aggregate.Key) {
+			continue
+		}
+
+		if len(page) == limit {
+			break
+		}
+
+		page = append(page, aggregate)
+	}
+
+	return page, nil
+}
+
+func unreadKeyLess(a, b model.UnreadKey) bool {
+	if a.ChatId != b.ChatId {
+		return a.ChatId < b.ChatId
+	}
+
+	return a.UserId < b.UserId
+}
+
+type fakeOutboxRepository struct {
+	mu       sync.Mutex
+	messages []*model.OutboxMessage
+}
+
+func (r *fakeOutboxRepository) Add(_ context.Context, message *model.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, message)
+
+	return nil
+}
+
+func (r *fakeOutboxRepository) GetUnsent(context.Context) ([]*model.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unsent []*model.OutboxMessage
+
+	for _, message := range r.messages {
+		if !message.IsSent {
+			unsent = append(unsent, message)
+		}
+	}
+
+	return unsent, nil
+}
+
+// Update keeps nothing, the messages passed are the ones the repository holds.
+func (r *fakeOutboxRepository) Update(context.Context, []*model.OutboxMessage) error {
+	return nil
+}
+
+func (r *fakeOutboxRepository) GetBacklog(context.Context) (model.OutboxBacklog, error) {
+	return model.OutboxBacklog{}, errors.New("not implemented")
+}
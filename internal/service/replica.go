@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+)
+
+type IReplicaRouter interface {
+	GetReplicaLag(ctx context.Context) (time.Duration, error)
+	UseReplica(use bool)
+}
+
+// ReplicaMonitor lets the history of chats be read from the replica only while it keeps up with
+// the primary. The primary serves the reads while the replica lags behind or cannot be reached.
+type ReplicaMonitor struct {
+	router IReplicaRouter
+	maxLag time.Duration
+	inUse  atomic.Bool
+}
+
+func NewReplicaMonitor(router IReplicaRouter, cfg config.ReplicaConfig) *ReplicaMonitor {
+	return &ReplicaMonitor{
+		router: router,
+		maxLag: cfg.MaxLag,
+	}
+}
+
+func (m *ReplicaMonitor) Check(ctx context.Context) error {
+	lag, err := m.router.GetReplicaLag(ctx)
+
+	if err != nil {
+		m.use(ctx, false)
+		return fmt.Errorf("failed to get replica lag: %w", err)
+	}
+
+	metrics.ReplicaLag.Set(lag.Seconds())
+
+	if lag > m.maxLag && m.inUse.Load() {
+		slog.WarnContext(ctx, fmt.Sprintf("Replica lags behind by %v, reading from the primary", lag))
+	}
+
+	m.use(ctx, lag <= m.maxLag)
+
+	return nil
+}
+
+func (m *ReplicaMonitor) use(ctx context.Context, use bool) {
+	if wasInUse := m.inUse.Swap(use); use && !wasInUse {
+		slog.InfoContext(ctx, "Replica is up to date, reading from the replica")
+	}
+
+	m.router.UseReplica(use)
+
+	if use {
+		metrics.ReplicaInUse.Set(1)
+	} else {
+		metrics.ReplicaInUse.Set(0)
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReplicaMonitor_ReadsFromReplicaOnlyWhileItKeepsUp(t *testing.T) {
+	router := &fakeReplicaRouter{}
+	monitor := NewReplicaMonitor(router, config.ReplicaConfig{MaxLag: 5 * time.Second})
+	ctx := context.Background()
+
+	steps := []struct {
+		lag  time.Duration
+		err  error
+		want bool
+	}{
+		{lag: 10 * time.Second, want: false},
+		{lag: time.Second, want: true},
+		{lag: 10 * time.Second, want: false},
+		{lag: 5 * time.Second, want: true},
+		{err: errors.New("connection refused"), want: false},
+		{err: errors.New("connection refused"), want: false},
+		{lag: 0, want: true},
+		{lag: 0, want: true},
+	}
+
+	for i, step := range steps {
+		router.lag, router.err = step.lag, step.err
+
+		err := monitor.Check(ctx)
+
+		if !errors.Is(err, step.err) {
+			t.Fatalf("step %v: got error %v, want %v", i, err, step.err)
+		}
+
+		if router.useReplica != step.want {
+			t.Errorf("step %v: replica in use is %v, want %v", i, router.useReplica, step.want)
+		}
+
+		if monitor.inUse.Load() != step.want {
+			t.Errorf("step %v: monitor sees replica in use %v, want %v", i, monitor.inUse.Load(), step.want)
+		}
+
+		if inUse := testutil.ToFloat64(metrics.ReplicaInUse) == 1; inUse != step.want {
+			t.Errorf("step %v: replica in use reported as %v, want %v", i, inUse, step.want)
+		}
+
+		if lag := testutil.ToFloat64(metrics.ReplicaLag); step.err == nil && lag != step.lag.Seconds() {
+			t.Errorf("step %v: got replica lag %vs reported, want %vs", i, lag, step.lag.Seconds())
+		}
+	}
+
+	if router.calls != len(steps) {
+		t.Errorf("expected the router to be told on every check, got %v of %v", router.calls, len(steps))
+	}
+}
+
+type fakeReplicaRouter struct {
+	lag        time.Duration
+	err        error
+	useReplica bool
+	calls      int
+}
+
+func (r *fakeReplicaRouter) GetReplicaLag(context.Context) (time.Duration, error) {
+	return r.lag, r.err
+}
+
+func (r *fakeReplicaRouter) UseReplica(use bool) {
+	r.useReplica = use
+	r.calls++
+}
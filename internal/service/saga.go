@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/outbox"
+)
+
+const (
+	SagaResolutionRollback = "rollback"
+	SagaResolutionCommit   = "commit"
+)
+
+type IPendingMessageRepository interface {
+	GetStuckMessages(ctx context.Context, deadline time.Time, limit int) ([]*model.PendingMessage, error)
+	MarkReemitted(ctx context.Context, msg *model.PendingMessage, emittedAt time.Time) (bool, error)
+}
+
+// SagaReaper finishes sagas the counter service has not answered in time. It re-emits the saga
+// command a limited number of times and then resolves the message through AppService.
+type SagaReaper struct {
+	appService         *AppService
+	pendingRepository  IPendingMessageRepository
+	outboxRepository   IOutboxRepository
+	transactionManager ITransactionManager
+	outboxRegistry     *outbox.Registry
+	cfg                config.SagaConfig
+}
+
+func NewSagaReaper(
+	appService *AppService,
+	pendingRepository IPendingMessageRepository,
+	outboxRepository IOutboxRepository,
+	transactionManager ITransactionManager,
+	outboxRegistry *outbox.Registry,
+	cfg config.SagaConfig,
+) (*SagaReaper, error) {
+	if cfg.Resolution != SagaResolutionRollback && cfg.Resolution != SagaResolutionCommit {
+		return nil, fmt.Errorf("unknown saga resolution: %v", cfg.Resolution)
+	}
+
+	return &SagaReaper{
+		appService:         appService,
+		pendingRepository:  pendingRepository,
+		outboxRepository:   outboxRepository,
+		transactionManager: transactionManager,
+		outboxRegistry:     outboxRegistry,
+		cfg:                cfg,
+	}, nil
+}
+
+func (r *SagaReaper) Reap(ctx context.Context) error {
+	deadline := time.Now().UTC().Add(-r.cfg.PendingTimeout)
+
+	messages, err := r.pendingRepository.GetStuckMessages(ctx, deadline, r.cfg.BatchSize)
+
+	if err != nil {
+		return err
+	}
+
+	metrics.SagaStuckMessages.Set(float64(len(messages)))
+
+	// A message that fails is left for the next pass, so that it does not hold up the ones behind it.
+	for _, message := range messages {
+		action := "reemit"
+
+		if message.EmitAttempts < r.cfg.MaxReemits {
+			err = r.reemit(ctx, message)
+		} else {
+			action = "resolve"
+			err = r.resolve(ctx, message)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			metrics.SagaReapFailures.WithLabelValues(action).Inc()
+
+			slog.ErrorContext(
+				ctx,
+				fmt.Sprintf("Failed to %v stuck message %v: %v", action, message.Message.MessageId, err))
+		}
+	}
+
+	return nil
+}
+
+func (r *SagaReaper) reemit(ctx context.Context, message *model.PendingMessage) error {
+	// Messages created before correlation IDs were stored get one on the first re-emit.
+	if message.Message.CorrelationId == "" {
+		message.Message.CorrelationId = uuid.New().String()
+	}
+
+	marked := false
+
+	err := r.transactionManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		marked, err = r.pendingRepository.MarkReemitted(ctx, message, time.Now().UTC())
+
+		// The message has been resolved or re-emitted by someone else in the meantime.
+		if err != nil || !marked {
+			return err
+		}
+
+		outboxMessage, err := outbox.NewMessage(ctx, r.outboxRegistry, model.AddNewUnreadMessage{
+			CorrelationId: message.Message.CorrelationId,
+			UserId:        message.Message.ToUserId,
+			ChatId:        message.Message.ChatId,
+			MessageId:     message.Message.MessageId,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return r.outboxRepository.Add(ctx, outboxMessage)
+	})
+
+	if err != nil || !marked {
+		return err
+	}
+
+	metrics.SagaReemits.Inc()
+
+	slog.InfoContext(
+		ctx,
+		fmt.Sprintf("Re-emitted saga command for message %v, attempt %v of %v",
+			message.Message.MessageId,
+			message.EmitAttempts+1,
+			r.cfg.MaxReemits))
+
+	return nil
+}
+
+func (r *SagaReaper) resolve(ctx context.Context, message *model.PendingMessage) error {
+	messageId := message.Message.MessageId
+
+	// The correlation ID is derived from the message, so resolving the same message twice is
+	// recognized as a duplicate command.
+	correlationId := fmt.Sprintf("saga-reaper-%v-%v", r.cfg.Resolution, messageId)
+
+	var err error
+
+	switch r.cfg.Resolution {
+	case SagaResolutionCommit:
+		err = r.appService.CommitMessage(ctx, model.CommitMessageCommand{
+			CorrelationId: correlationId,
+			MessageId:     messageId,
+		})
+	default:
+		err = r.appService.RollbackStuckMessage(ctx, model.RollbackMessageCommand{
+			CorrelationId: correlationId,
+			MessageId:     messageId,
+		}, message.Message)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	metrics.SagaForcedResolutions.WithLabelValues(r.cfg.Resolution).Inc()
+
+	slog.WarnContext(
+		ctx,
+		fmt.Sprintf("Message %v stuck in pending state after %v re-emits, resolved by %v",
+			messageId,
+			message.EmitAttempts,
+			r.cfg.Resolution))
+
+	return nil
+}
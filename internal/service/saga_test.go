@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/orochi-keydream/dialogue-service/internal/config"
+	"github.com/orochi-keydream/dialogue-service/internal/fixture"
+	"github.com/orochi-keydream/dialogue-service/internal/metrics"
+	"github.com/orochi-keydream/dialogue-service/internal/model"
+	"github.com/orochi-keydream/dialogue-service/internal/repository/memory"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReap_ReemitsAndThenResolvesStuckMessages(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	outboxRepository := memory.NewOutboxRepository(store)
+	transactionManager := memory.NewTransactionManager(store)
+	registry := newOutboxRegistry(t)
+
+	appService := NewAppService(
+		dialogueRepository,
+		outboxRepository,
+		memory.NewCommandRepository(store),
+		memory.NewUnreadRepository(store),
+		nil,
+		transactionManager,
+		registry)
+
+	newReaper := func(maxReemits int) *SagaReaper {
+		reaper, err := NewSagaReaper(appService, dialogueRepository, outboxRepository, transactionManager, registry, config.SagaConfig{
+			PendingTimeout: time.Minute,
+			MaxReemits:     maxReemits,
+			Resolution:     SagaResolutionRollback,
+			BatchSize:      10,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return reaper
+	}
+
+	id := fixture.AddMessage(t, dialogueRepository, time.Now().UTC().Add(-time.Hour), model.MessageStatePending)
+
+	reemits := metrics.SagaReemits
+	resolutions := metrics.SagaForcedResolutions.WithLabelValues(SagaResolutionRollback)
+	reemitsBefore, resolutionsBefore := testutil.ToFloat64(reemits), testutil.ToFloat64(resolutions)
+
+	err := newReaper(1).Reap(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.AssertState(t, dialogueRepository, id, model.MessageStatePending)
+
+	if got := testutil.ToFloat64(reemits) - reemitsBefore; got != 1 {
+		t.Errorf("got %v re-emits counted, want 1", got)
+	}
+
+	if got := testutil.ToFloat64(metrics.SagaStuckMessages); got != 1 {
+		t.Errorf("got %v stuck messages reported, want 1", got)
+	}
+
+	// The re-emitted message is stuck again only once the timeout passes since the re-emit.
+	err = newReaper(0).Reap(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.AssertState(t, dialogueRepository, id, model.MessageStatePending)
+
+	if got := testutil.ToFloat64(metrics.SagaStuckMessages); got != 0 {
+		t.Errorf("got %v stuck messages reported, want 0", got)
+	}
+
+	stuck := fixture.AddMessage(t, dialogueRepository, time.Now().UTC().Add(-time.Hour), model.MessageStatePending)
+
+	err = newReaper(0).Reap(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.AssertState(t, dialogueRepository, stuck, model.MessageStateRemoved)
+
+	unsent, err := outboxRepository.GetUnsent(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compensations := 0
+
+	for _, message := range unsent {
+		if message.Type == model.OutboxMessageTypeRemoveUnreadMessage {
+			compensations++
+		}
+	}
+
+	if compensations != 1 {
+		t.Errorf("got %v compensations of the rolled back message, want 1", compensations)
+	}
+
+	if got := testutil.ToFloat64(resolutions) - resolutionsBefore; got != 1 {
+		t.Errorf("got %v forced resolutions counted, want 1", got)
+	}
+}
+
+func TestReap_ContinuesPastMessageThatFails(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	dialogueRepository := memory.NewDialogueRepository(store)
+	outboxRepository := memory.NewOutboxRepository(store)
+	transactionManager := memory.NewTransactionManager(store)
+
+	sentAt := time.Now().UTC().Add(-time.Hour)
+	failing := fixture.AddMessage(t, dialogueRepository, sentAt, model.MessageStatePending)
+	reemitted := fixture.AddMessage(t, dialogueRepository, sentAt.Add(time.Second), model.MessageStatePending)
+
+	pendingRepository := &failingPendingRepository{DialogueRepository: dialogueRepository, failing: failing}
+
+	reaper, err := NewSagaReaper(nil, pendingRepository, outboxRepository, transactionManager, newOutboxRegistry(t), config.SagaConfig{
+		PendingTimeout: time.Minute,
+		MaxReemits:     1,
+		Resolution:     SagaResolutionRollback,
+		BatchSize:      10,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures := metrics.SagaReapFailures.WithLabelValues("reemit")
+	failuresBefore := testutil.ToFloat64(failures)
+
+	err = reaper.Reap(ctx)
+
+	if err != nil {
+		t.Fatalf("reap failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(failures) - failuresBefore; got != 1 {
+		t.Errorf("got %v failures counted, want 1", got)
+	}
+
+	unsent, err := outboxRepository.GetUnsent(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unsent) != 1 {
+		t.Fatalf("got %v saga commands re-emitted, want the one of message %v", len(unsent), reemitted)
+	}
+}
+
+// failingPendingRepository fails to mark the failing message as re-emitted.
+type failingPendingRepository struct {
+	*memory.DialogueRepository
+	failing model.MessageId
+}
+
+func (r *failingPendingRepository) MarkReemitted(ctx context.Context, msg *model.PendingMessage, emittedAt time.Time) (bool, error) {
+	if msg.Message.MessageId == r.failing {
+		return false, errors.New("row is locked")
+	}
+
+	return r.DialogueRepository.MarkReemitted(ctx, msg, emittedAt)
+}
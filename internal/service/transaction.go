@@ -0,0 +1,9 @@
+package service
+
+import "context"
+
+// ITransactionManager runs fn in a transaction carried by the context passed to it, so that the
+// repositories called with that context take part in the transaction.
+type ITransactionManager interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	RequestIdKey   = "x-request-id"
+	TraceParentKey = "traceparent"
+	TraceStateKey  = "tracestate"
+)
+
+type ctxKey string
+
+const (
+	requestIdCtxKey    ctxKey = "request_id"
+	traceContextCtxKey ctxKey = "trace_context"
+)
+
+// TraceContext holds the W3C trace context headers of the operation.
+type TraceContext struct {
+	TraceParent string
+	TraceState  string
+}
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdCtxKey, requestId)
+}
+
+func RequestId(ctx context.Context) (string, bool) {
+	requestId, ok := ctx.Value(requestIdCtxKey).(string)
+	return requestId, ok && requestId != ""
+}
+
+func WithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextCtxKey, tc)
+}
+
+func GetTraceContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextCtxKey).(TraceContext)
+	return tc, ok && tc.TraceParent != ""
+}
+
+// NewTraceParent starts a new sampled trace when the caller did not provide one.
+func NewTraceParent() string {
+	traceId := make([]byte, 16)
+	_, _ = rand.Read(traceId)
+
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(traceId), newSpanId())
+}
+
+// ChildTraceParent continues the trace of the caller's traceparent with a new span of the service,
+// keeping the trace ID and the flags. It reports false if the traceparent is not valid, in which case
+// the caller's trace context must be dropped.
+func ChildTraceParent(traceParent string) (string, bool) {
+	traceId, flags, ok := parseTraceParent(traceParent)
+
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", traceId, newSpanId(), flags), true
+}
+
+// parseTraceParent returns the trace ID and the flags of a traceparent following the W3C Trace Context
+// format. Versions after 00 are parsed as 00, ignoring the fields they append.
+func parseTraceParent(traceParent string) (traceId string, flags string, ok bool) {
+	const length = len("00-") + 32 + len("-") + 16 + len("-") + 2
+
+	if len(traceParent) < length {
+		return "", "", false
+	}
+
+	version := traceParent[:2]
+
+	if !isLowerHex(version) || version == "ff" {
+		return "", "", false
+	}
+
+	if len(traceParent) > length && (version == "00" || traceParent[length] != '-') {
+		return "", "", false
+	}
+
+	if traceParent[2] != '-' || traceParent[35] != '-' || traceParent[52] != '-' {
+		return "", "", false
+	}
+
+	traceId, parentId, flags := traceParent[3:35], traceParent[36:52], traceParent[53:55]
+
+	if !isLowerHex(traceId) || isZero(traceId) || !isLowerHex(parentId) || isZero(parentId) || !isLowerHex(flags) {
+		return "", "", false
+	}
+
+	return traceId, flags, true
+}
+
+func newSpanId() string {
+	spanId := make([]byte, 8)
+
+	for {
+		_, _ = rand.Read(spanId)
+
+		// An all-zero span ID is invalid.
+		if id := hex.EncodeToString(spanId); !isZero(id) {
+			return id
+		}
+	}
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
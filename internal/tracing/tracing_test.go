@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChildTraceParent(t *testing.T) {
+	const (
+		traceId  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentId = "00f067aa0ba902b7"
+	)
+
+	cases := []struct {
+		name        string
+		traceParent string
+		valid       bool
+		flags       string
+	}{
+		{name: "sampled", traceParent: "00-" + traceId + "-" + parentId + "-01", valid: true, flags: "01"},
+		{name: "not sampled", traceParent: "00-" + traceId + "-" + parentId + "-00", valid: true, flags: "00"},
+		{name: "future version with extra fields", traceParent: "01-" + traceId + "-" + parentId + "-01-extra", valid: true, flags: "01"},
+		{name: "version 00 with extra fields", traceParent: "00-" + traceId + "-" + parentId + "-01-extra"},
+		{name: "future version with extra characters", traceParent: "01-" + traceId + "-" + parentId + "-01extra"},
+		{name: "forbidden version", traceParent: "ff-" + traceId + "-" + parentId + "-01"},
+		{name: "upper case", traceParent: "00-" + strings.ToUpper(traceId) + "-" + parentId + "-01"},
+		{name: "zero trace ID", traceParent: "00-" + strings.Repeat("0", 32) + "-" + parentId + "-01"},
+		{name: "zero parent ID", traceParent: "00-" + traceId + "-" + strings.Repeat("0", 16) + "-01"},
+		{name: "short trace ID", traceParent: "00-" + traceId[1:] + "-" + parentId + "-01"},
+		{name: "wrong separator", traceParent: "00_" + traceId + "-" + parentId + "-01"},
+		{name: "empty", traceParent: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			child, valid := ChildTraceParent(c.traceParent)
+
+			if valid != c.valid {
+				t.Fatalf("got valid %v, want %v", valid, c.valid)
+			}
+
+			if !valid {
+				return
+			}
+
+			childTraceId, flags, ok := parseTraceParent(child)
+
+			if !ok {
+				t.Fatalf("child traceparent %v is not valid", child)
+			}
+
+			if childTraceId != traceId || flags != c.flags {
+				t.Errorf("got child traceparent %v, want trace ID %v and flags %v", child, traceId, c.flags)
+			}
+
+			if strings.Contains(child, parentId) {
+				t.Errorf("child traceparent %v keeps the parent span ID", child)
+			}
+		})
+	}
+}
+
+func TestNewTraceParent(t *testing.T) {
+	traceParent := NewTraceParent()
+
+	if _, flags, ok := parseTraceParent(traceParent); !ok || flags != "01" {
+		t.Errorf("got traceparent %v, want a valid sampled one", traceParent)
+	}
+}
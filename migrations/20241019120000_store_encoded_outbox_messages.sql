@@ -0,0 +1,26 @@
+-- +goose Up
+-- Messages stored before have no topic, they are published to the topic configured for their type.
+-- +goose StatementBegin
+alter table outbox
+add topic text not null default '',
+add headers jsonb not null default '{}';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+alter table outbox
+alter column message_key type bytea using convert_to(message_key, 'UTF8'),
+alter column message_value type bytea using convert_to(message_value, 'UTF8');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table outbox
+alter column message_key type text using convert_from(message_key, 'UTF8'),
+alter column message_value type text using convert_from(message_value, 'UTF8');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+alter table outbox
+drop column topic,
+drop column headers;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table outbox
+add created_at timestamp not null default (now() at time zone 'utc');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create index outbox_unsent_idx on outbox (created_at) where is_sent = false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index outbox_unsent_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+alter table outbox
+drop column created_at;
+-- +goose StatementEnd
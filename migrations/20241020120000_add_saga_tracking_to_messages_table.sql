@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table messages
+add correlation_id text,
+add emit_attempts integer not null default 0,
+add last_emitted_at timestamp;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create index messages_pending_idx on messages (sent_at) where state = 2;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index messages_pending_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+alter table messages
+drop column last_emitted_at,
+drop column emit_attempts,
+drop column correlation_id;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+create table read_watermarks
+(
+    chat_id text not null,
+    user_id text not null,
+    last_read_message_id bigint not null,
+    updated_at timestamp not null,
+    primary key (chat_id, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table read_watermarks;
+-- +goose StatementEnd
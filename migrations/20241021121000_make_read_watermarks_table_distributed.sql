@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+select create_distributed_table('read_watermarks', 'chat_id', colocate_with => 'messages')
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+select undistribute_table('read_watermarks')
+-- +goose StatementEnd
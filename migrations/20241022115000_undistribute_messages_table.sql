@@ -0,0 +1,28 @@
+-- The messages table is turned into a local one before it is partitioned and distributed again after
+-- that. Rolling back the partitioning distributes the restored messages table again. The migration
+-- does nothing unless Citus is installed and the table is distributed.
+-- +goose Up
+-- +goose StatementBegin
+do $$
+begin
+    if exists (select from pg_extension where extname = 'citus') then
+        if exists (select from pg_dist_partition where logicalrelid = 'messages'::regclass) then
+            perform undistribute_table('messages');
+        end if;
+    end if;
+end
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+do $$
+begin
+    if exists (select from pg_extension where extname = 'citus') then
+        if exists (select from pg_dist_partition where logicalrelid = 'read_watermarks'::regclass) then
+            perform create_distributed_table('messages', 'chat_id', colocate_with => 'read_watermarks');
+        end if;
+    end if;
+end
+$$;
+-- +goose StatementEnd
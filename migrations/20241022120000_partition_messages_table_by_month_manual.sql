@@ -0,0 +1,120 @@
+-- +goose Up
+-- The migration copies every message into the partitioned table within its transaction. Writes to
+-- messages are blocked by the lock below until it commits, which takes time proportional to the size
+-- of the table. It is therefore never applied on startup, see "Partitioning of messages" in README.
+-- +goose StatementBegin
+lock table messages in exclusive mode;
+-- +goose StatementEnd
+
+-- A primary key of a partitioned table must include the partition key, so sent_at is added to the
+-- key. The uniqueness of message_id alone is no longer enforced and relies on the sequence, and
+-- lookups by message_id without sent_at check the primary key index of every partition.
+-- +goose StatementBegin
+create table messages_partitioned
+(
+    message_id bigint not null default nextval('messages_message_id_seq'),
+    chat_id text not null,
+    sent_at timestamp not null,
+    from_user_id text not null,
+    to_user_id text not null,
+    text text not null,
+    state integer not null default 1,
+    correlation_id text,
+    emit_attempts integer not null default 0,
+    last_emitted_at timestamp,
+    primary key (message_id, chat_id, sent_at)
+) partition by range (sent_at);
+-- +goose StatementEnd
+
+-- Partitions cover the months of existing messages and three months ahead, the next ones are
+-- created by the partition maintenance job.
+-- +goose StatementBegin
+do $$
+declare
+    month timestamp;
+    last_month timestamp := date_trunc('month', now() at time zone 'utc') + interval '3 months';
+begin
+    select date_trunc('month', coalesce(min(sent_at), now() at time zone 'utc')) into month from messages;
+
+    while month <= last_month loop
+        execute format(
+            'create table %I partition of messages_partitioned for values from (%L) to (%L)',
+            'messages_p' || to_char(month, 'YYYY_MM'),
+            month,
+            month + interval '1 month');
+
+        month := month + interval '1 month';
+    end loop;
+end
+$$;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+insert into messages_partitioned
+select message_id, chat_id, sent_at, from_user_id, to_user_id, text, state, correlation_id, emit_attempts, last_emitted_at
+from messages;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+alter sequence messages_message_id_seq owned by messages_partitioned.message_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+drop table messages;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+alter table messages_partitioned rename to messages;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create index messages_pending_idx on messages (sent_at) where state = 2;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create index messages_chat_id_state_sent_at_idx on messages (chat_id, state, sent_at desc);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+lock table messages in exclusive mode;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create table messages_unpartitioned
+(
+    message_id bigint not null default nextval('messages_message_id_seq'),
+    chat_id text not null,
+    sent_at timestamp not null,
+    from_user_id text not null,
+    to_user_id text not null,
+    text text not null,
+    state integer not null default 1,
+    correlation_id text,
+    emit_attempts integer not null default 0,
+    last_emitted_at timestamp,
+    primary key (message_id, chat_id)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+insert into messages_unpartitioned
+select message_id, chat_id, sent_at, from_user_id, to_user_id, text, state, correlation_id, emit_attempts, last_emitted_at
+from messages;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+alter sequence messages_message_id_seq owned by messages_unpartitioned.message_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+drop table messages;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+alter table messages_unpartitioned rename to messages;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create index messages_pending_idx on messages (sent_at) where state = 2;
+-- +goose StatementEnd
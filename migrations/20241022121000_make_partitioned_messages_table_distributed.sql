@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+select create_distributed_table('messages', 'chat_id', colocate_with => 'read_watermarks')
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+select undistribute_table('messages')
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+create table archive_blobs
+(
+    chat_id text not null,
+    month date not null,
+    blob_key text not null,
+    from_sent_at timestamp not null,
+    to_sent_at timestamp not null,
+    message_count integer not null,
+    updated_at timestamp not null,
+    primary key (chat_id, month)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table archive_blobs;
+-- +goose StatementEnd
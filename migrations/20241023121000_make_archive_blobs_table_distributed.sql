@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+select create_distributed_table('archive_blobs', 'chat_id', colocate_with => 'messages')
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+select undistribute_table('archive_blobs')
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+// Package migrations embeds the SQL migrations into the binary. Migrations distributing tables with
+// Citus are named *_distributed.sql, so that they can be skipped on plain Postgres, unless they check
+// for the Citus extension themselves. Migrations blocking writes for a time proportional to the size
+// of a table are named *_manual.sql and are never applied when the service starts.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
+
+// DistributedPattern matches the names of the migrations that require Citus.
+const DistributedPattern = "*_distributed.sql"
+
+// ManualPattern matches the names of the migrations that must be applied with the service stopped.
+const ManualPattern = "*_manual.sql"
+
+// CitusCheck is the condition of the migrations that distribute tables only if Citus is installed.
+const CitusCheck = "select from pg_extension where extname = 'citus'"